@@ -0,0 +1,204 @@
+// Package app wires the API service from its repository dependencies so it
+// can be run by cmd or embedded in another process.
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/lioarce01/remote-patient-monitoring-system/api-service/internal/application"
+	httpHandler "github.com/lioarce01/remote-patient-monitoring-system/api-service/internal/infrastructure/http"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/audit"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/webhook"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/ws"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type App struct {
+	Router *gin.Engine
+	WS     *ws.WSHandler
+}
+
+// Security configures authentication and auditing. Verifier and Audit are
+// required; use auth.AllowAll() to run without authentication.
+type Security struct {
+	Verifier       auth.Verifier
+	CareTeams      repository.CareTeamRepository
+	AllowedOrigins []string
+	// Audit records every access to patient data
+	Audit repository.AuditRepository
+	// Patients resolves ward subscriptions on /ws/alerts and /sse/alerts;
+	// nil disables them
+	Patients repository.PatientRepository
+	// Webhooks stores the subscriptions admins manage on /admin/webhooks,
+	// which acknowledgements are published to; nil disables them
+	Webhooks repository.WebhookRepository
+}
+
+// New builds the REST, WebSocket, metrics and health routes. wsOpts tune
+// the WebSocket handler, e.g. ws.WithConfig.
+func New(obsRepo repository.ObservationRepository, alertRepo repository.AlertRepository, sec Security, wsOpts ...ws.Option) *App {
+	if sec.Verifier == nil {
+		log.Fatal("API security must provide a token verifier")
+	}
+	if sec.Audit == nil {
+		log.Fatal("API security must provide an audit log")
+	}
+	access := auth.NewAccess(sec.CareTeams)
+
+	// initialize services
+	apiService := application.NewQueryService(obsRepo, alertRepo)
+
+	// initialize handlers
+	queryHandler := httpHandler.NewQueryHandler(apiService, access)
+	alertService := application.NewAlertService(alertRepo)
+	var webhookService *application.WebhookService
+	if sec.Webhooks != nil {
+		alertService.Webhooks = webhook.NewPublisher(sec.Webhooks, sec.Patients)
+		webhookService = application.NewWebhookService(sec.Webhooks)
+	}
+	alertHandler := httpHandler.NewAlertHandler(alertService, access)
+	adminHandler := httpHandler.NewAdminHandler(application.NewAuditService(sec.Audit), webhookService)
+
+	// start websocket
+	wsHandler := ws.NewWSHandler(append([]ws.Option{
+		ws.WithOriginCheck(auth.OriginChecker(sec.AllowedOrigins)),
+		ws.WithAuthorizer(alertAuthorizer(sec.Verifier, access, sec.Audit)),
+		ws.WithPatientLookup(patientLookup(sec.Patients, sec.CareTeams)),
+		ws.WithAlertHistory(alertRepo.FetchSince),
+	}, wsOpts...)...)
+
+	// gin's default logger prints query strings, which may carry tokens
+	router := gin.New()
+	router.Use(httpHandler.Logger(), gin.Recovery())
+
+	// prometheus route
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// audit wraps authentication so rejected requests are recorded too
+	api := router.Group("/", httpHandler.Audit(sec.Audit), httpHandler.Authenticate(sec.Verifier))
+	queryHandler.RegisterRoutes(api)
+	alerts := router.Group("/", httpHandler.Audit(sec.Audit), httpHandler.Authenticate(sec.Verifier))
+	alertHandler.RegisterRoutes(alerts)
+	admin := router.Group("/admin", httpHandler.Audit(sec.Audit), httpHandler.Authenticate(sec.Verifier))
+	adminHandler.RegisterRoutes(admin)
+
+	// websocket and server-sent events endpoints, sharing one hub
+	router.GET("/ws/alerts", gin.WrapF(wsHandler.Handler()))
+	router.GET("/sse/alerts", gin.WrapF(wsHandler.SSE()))
+
+	// healthcheck
+	router.GET("/health", func(c *gin.Context) {
+		c.String(http.StatusOK, "OK")
+	})
+
+	return &App{Router: router, WS: wsHandler}
+}
+
+// alertAuthorizer admits clinical staff and admins to /ws/alerts and
+// /sse/alerts and only forwards alerts and vitals of patients they may
+// read. Every attempt is audited.
+func alertAuthorizer(v auth.Verifier, access *auth.Access, auditLog repository.AuditRepository) ws.Authorizer {
+	return func(r *http.Request) (filter ws.AccessFilter, status int, err error) {
+		start := time.Now()
+		p, err := v.Verify(r.Context(), auth.StreamToken(r))
+		defer func() {
+			recorded := status
+			if recorded == 0 {
+				recorded = http.StatusOK
+				if websocket.IsWebSocketUpgrade(r) {
+					recorded = http.StatusSwitchingProtocols
+				}
+			}
+			audit.Record(r.Context(), auditLog, audit.Event(r, p, recorded, start))
+		}()
+		if err != nil {
+			return nil, http.StatusUnauthorized, auth.ErrUnauthenticated
+		}
+		if !p.HasRole(auth.RoleNurse, auth.RolePhysician, auth.RoleAdmin) {
+			return nil, http.StatusForbidden, auth.ErrForbidden
+		}
+		if p.Unrestricted() {
+			return nil, 0, nil
+		}
+		return func(patientID string) bool {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			ok, err := access.CanReadPatient(ctx, p, patientID)
+			if err != nil {
+				log.Printf("[WS] care team lookup for %s failed: %v", patientID, err)
+			}
+			return ok
+		}, 0, nil
+	}
+}
+
+// patientLookup resolves the ward and care teams that alert subscriptions
+// select on
+func patientLookup(patients repository.PatientRepository, teams repository.CareTeamRepository) ws.PatientLookup {
+	return func(ctx context.Context, patientID string) (ws.PatientInfo, error) {
+		var info ws.PatientInfo
+		if patients != nil {
+			p, err := patients.FetchByID(ctx, patientID)
+			if err != nil {
+				return info, err
+			}
+			if p != nil {
+				info.Ward = p.Ward
+			}
+		}
+		if teams != nil {
+			var err error
+			if info.CareTeams, err = teams.CareTeams(ctx, patientID); err != nil {
+				return info, err
+			}
+		}
+		return info, nil
+	}
+}
+
+// RelayAlerts forwards alerts from consumer to WebSocket clients until ctx
+// is cancelled
+func (a *App) RelayAlerts(ctx context.Context, consumer repository.Subscriber) error {
+	return consumer.Consume(ctx, func(key, value []byte) error {
+		var alert entities.Alert
+		if err := json.Unmarshal(value, &alert); err != nil {
+			log.Println("Invalid alert message:", err)
+			return nil
+		}
+		a.WS.BroadcastAlert(&alert)
+		return nil
+	})
+}
+
+// RelayObservations forwards the observations ingest publishes from
+// consumer to WebSocket clients subscribed to vitals until ctx is cancelled
+func (a *App) RelayObservations(ctx context.Context, consumer repository.Subscriber) error {
+	return consumer.Consume(ctx, func(key, value []byte) error {
+		var obs entities.Observation
+		if err := json.Unmarshal(value, &obs); err != nil {
+			log.Println("Invalid observation message:", err)
+			return nil
+		}
+		record, err := entities.ToObservationRecord(&obs)
+		if err != nil {
+			log.Println("Invalid observation message:", err)
+			return nil
+		}
+		a.WS.BroadcastVital(ws.VitalFromRecord(record))
+		return nil
+	})
+}
+
+// Close disconnects WebSocket clients
+func (a *App) Close() error {
+	return a.WS.Close()
+}
@@ -2,37 +2,46 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
 
-	"github.com/gin-gonic/gin"
-	"github.com/lioarce01/remote-patient-monitoring-system/api-service/internal/application"
-	httpHandler "github.com/lioarce01/remote-patient-monitoring-system/api-service/internal/infrastructure/http"
-	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/api-service/app"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/broker"
 	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db"
-	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/kafka"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/lifecycle"
 	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/ws"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
 	conn := os.Getenv("POSTGRES_CONN")
-	influxAddr := os.Getenv("INFLUX_ADDR")
-	influxDB := os.Getenv("INFLUX_DB")
-	influxUser := os.Getenv("INFLUX_USER")
-	influxPass := os.Getenv("INFLUX_PASS")
-	brokers := strings.Split(os.Getenv("KAFKA_BROKERS"), ",")
+
+	// "migrate ..." manages the Postgres schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := db.Migrate(context.Background(), conn, os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	obsCfg := db.ObservationConfigFromEnv()
+	brokerCfg := broker.ConfigFromEnv()
+	authCfg := auth.ConfigFromEnv()
 	alertTopic := os.Getenv("ALERT_TOPIC")
+	obsTopic := os.Getenv("OBS_TOPIC")
 	apiPort := os.Getenv("API_PORT")
 	groupID := os.Getenv("GROUP_ID")
+	replicaID := broker.ReplicaID()
+	shutdown := lifecycle.NewDeadline(lifecycle.ShutdownTimeout())
 
 	// initialize repositories
-	obsRepo, err := db.NewInfluxRepo(influxAddr, influxDB, influxUser, influxPass)
+	obsRepo, err := db.NewObservationStore(obsCfg, false)
 	if err != nil {
-		log.Fatalf("cannot initialize InfluxDB repo: %v", err)
+		log.Fatalf("cannot initialize observation store: %v", err)
 	}
 
 	alertRepo, err := db.NewPostgresRepo(conn)
@@ -40,46 +49,86 @@ func main() {
 		log.Fatalf("cannot initialize Postgres repo: %v", err)
 	}
 
-	// initialize services
-	apiService := application.NewQueryService(obsRepo, alertRepo)
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
 
-	// initialize handlers
-	queryHandler := httpHandler.NewQueryHandler(apiService)
+	// bearer token verification
+	verifier, err := auth.NewVerifier(ctx, authCfg)
+	if err != nil {
+		log.Fatalf("cannot initialize authentication: %v", err)
+	}
+	if authCfg.Mode == auth.ModeOff {
+		log.Printf("WARNING: AUTH_MODE=off, every request is treated as an admin")
+	}
 
-	// start websocket
-	wsHandler := ws.NewWSHandler()
+	// initialize services, handlers and websocket
+	api := app.New(obsRepo, alertRepo, app.Security{
+		Verifier:       verifier,
+		CareTeams:      alertRepo,
+		AllowedOrigins: authCfg.AllowedOrigins,
+		Audit:          alertRepo.AuditLog(),
+		Patients:       alertRepo.Patients(),
+		Webhooks:       alertRepo.Webhooks(),
+	}, ws.WithConfig(ws.ConfigFromEnv()))
 
+	// every replica consumes in its own group so each alert reaches the
+	// clients of all replicas
+	log.Printf("API replica %s consumes alerts as %s", replicaID, broker.BroadcastGroup(groupID, replicaID))
+	consumer, err := broker.NewBroadcastSubscriber(ctx, brokerCfg, alertTopic, groupID, replicaID)
+	if err != nil {
+		log.Fatalf("cannot initialize alert subscriber: %v", err)
+	}
+	consumerDone := make(chan struct{})
 	go func() {
-		consumer := kafka.NewKafkaConsumer(brokers, alertTopic, groupID)
-		consumer.Consume(context.Background(), func(key, value []byte) {
-			var alert entities.Alert
-			if err := json.Unmarshal(value, &alert); err != nil {
-				log.Println("Invalid alert message:", err)
-				return
-			}
-			wsHandler.BroadcastAlert(&alert)
-		})
+		defer close(consumerDone)
+		err := api.RelayAlerts(ctx, consumer)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("alert consumer stopped: %v", err)
+		}
 	}()
 
-	router := gin.Default()
-
-	// prometheus route
-	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
-
-	api := router.Group("/")
-	queryHandler.RegisterRoutes(api)
-
-	// websocket endpoint
-	router.GET("/ws/alerts", gin.WrapF(wsHandler.Handler()))
+	// live vitals read the observation topic in groups of their own so
+	// processing still receives every observation
+	var obsConsumer repository.Subscriber
+	obsConsumerDone := make(chan struct{})
+	if obsTopic == "" {
+		log.Printf("OBS_TOPIC is not set, live vitals are disabled")
+		close(obsConsumerDone)
+	} else {
+		obsConsumer, err = broker.NewBroadcastSubscriber(ctx, brokerCfg, obsTopic, groupID+"-vitals", replicaID)
+		if err != nil {
+			log.Fatalf("cannot initialize observation subscriber: %v", err)
+		}
+		go func() {
+			defer close(obsConsumerDone)
+			err := api.RelayObservations(ctx, obsConsumer)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("observation consumer stopped: %v", err)
+			}
+		}()
+	}
 
-	// healthcheck
-	router.GET("/health", func(c *gin.Context) {
-		c.String(http.StatusOK, "OK")
-	})
+	srv := &http.Server{Addr: ":" + apiPort, Handler: api.Router}
+	// websocket connections are hijacked and ignored by Shutdown
+	srv.RegisterOnShutdown(func() { api.Close() })
 
 	// initialize server
 	log.Printf("API service listening on :%s\n", apiPort)
-	if err := router.Run(":" + apiPort); err != nil {
-		log.Fatal(err)
+	if err := lifecycle.Serve(ctx, srv, shutdown); err != nil {
+		log.Printf("API server error: %v", err)
+		cancel()
 	}
+
+	if !lifecycle.Wait(consumerDone, shutdown.Remaining()) {
+		log.Printf("shutdown deadline exceeded while stopping alert consumer")
+	}
+	if !lifecycle.Wait(obsConsumerDone, shutdown.Remaining()) {
+		log.Printf("shutdown deadline exceeded while stopping observation consumer")
+	}
+
+	lifecycle.Close("alert subscriber", consumer)
+	lifecycle.Close("observation subscriber", obsConsumer)
+	lifecycle.Close("observation store", obsRepo)
+	lifecycle.Close("Postgres pool", alertRepo)
+	log.Println("API service stopped")
 }
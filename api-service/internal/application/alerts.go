@@ -0,0 +1,79 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/webhook"
+)
+
+// ErrAlertNotFound is returned for alert IDs that are not stored
+var ErrAlertNotFound = errors.New("alert not found")
+
+// AlertService moves alerts through their lifecycle
+type AlertService struct {
+	AlertRepo repository.AlertRepository
+	// Webhooks, when set, publishes alert.acknowledged and alert.resolved
+	// to webhook subscriptions
+	Webhooks *webhook.Publisher
+}
+
+func NewAlertService(aRepo repository.AlertRepository) *AlertService {
+	return &AlertService{AlertRepo: aRepo}
+}
+
+func (s *AlertService) GetAlert(ctx context.Context, id string) (*entities.Alert, error) {
+	alert, err := s.AlertRepo.FetchByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if alert == nil {
+		return nil, ErrAlertNotFound
+	}
+	return alert, nil
+}
+
+// Acknowledge records that by has seen the alert, which stops its
+// escalation. Acknowledging twice keeps the first acknowledgement, so a
+// caller getting an error because the webhook event was not queued
+// retries to queue it.
+func (s *AlertService) Acknowledge(ctx context.Context, id, by string) (*entities.Alert, error) {
+	alert, err := s.AlertRepo.Acknowledge(ctx, id, by, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	if alert == nil {
+		return nil, ErrAlertNotFound
+	}
+	if s.Webhooks != nil {
+		// the event ID is stable, so acknowledging twice publishes once
+		if _, err := s.Webhooks.Publish(ctx, webhook.Event{Type: entities.EventAlertAcknowledged, Alert: alert}); err != nil {
+			return nil, fmt.Errorf("alert %s acknowledged, but publishing its webhook event failed: %w", alert.ID, err)
+		}
+	}
+	return alert, nil
+}
+
+// Resolve records that by has dealt with the alert, which also stops its
+// escalation. Resolving twice keeps the first resolution and is retried
+// the same way as Acknowledge.
+func (s *AlertService) Resolve(ctx context.Context, id, by string) (*entities.Alert, error) {
+	alert, err := s.AlertRepo.Resolve(ctx, id, by, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	if alert == nil {
+		return nil, ErrAlertNotFound
+	}
+	if s.Webhooks != nil {
+		// the event ID is stable, so resolving twice publishes once
+		if _, err := s.Webhooks.Publish(ctx, webhook.Event{Type: entities.EventAlertResolved, Alert: alert}); err != nil {
+			return nil, fmt.Errorf("alert %s resolved, but publishing its webhook event failed: %w", alert.ID, err)
+		}
+	}
+	return alert, nil
+}
@@ -0,0 +1,59 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+)
+
+// AuditService lets admins search and verify the audit log
+type AuditService struct {
+	AuditRepo repository.AuditRepository
+}
+
+// AuditParams are the raw audit query parameters; empty values do not
+// filter
+type AuditParams struct {
+	Actor     string
+	PatientID string
+	Action    string
+	From      string
+	To        string
+	Cursor    string
+	Limit     string
+}
+
+func NewAuditService(repo repository.AuditRepository) *AuditService {
+	return &AuditService{AuditRepo: repo}
+}
+
+func (s *AuditService) QueryAudit(ctx context.Context, params AuditParams) (repository.AuditPage, error) {
+	q := repository.AuditQuery{
+		Actor:     params.Actor,
+		PatientID: params.PatientID,
+		Action:    params.Action,
+		Cursor:    params.Cursor,
+	}
+	var err error
+	if q.From, err = parseTime("from", params.From); err != nil {
+		return repository.AuditPage{}, err
+	}
+	if q.To, err = parseTime("to", params.To); err != nil {
+		return repository.AuditPage{}, err
+	}
+	if params.Limit != "" {
+		if q.Limit, err = strconv.Atoi(params.Limit); err != nil {
+			return repository.AuditPage{}, fmt.Errorf("%w: limit must be an integer", repository.ErrInvalidQuery)
+		}
+	}
+	if err := q.Validate(); err != nil {
+		return repository.AuditPage{}, err
+	}
+	return s.AuditRepo.Query(ctx, q)
+}
+
+func (s *AuditService) VerifyAudit(ctx context.Context) (repository.AuditVerification, error) {
+	return s.AuditRepo.Verify(ctx)
+}
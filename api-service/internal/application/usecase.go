@@ -2,6 +2,9 @@ package application
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
 	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
@@ -12,14 +15,164 @@ type QueryService struct {
 	AlertRepo   repository.AlertRepository
 }
 
+// ObservationParams are the raw observation query parameters; empty values
+// select the defaults
+type ObservationParams struct {
+	From      string
+	To        string
+	Code      string
+	Interval  string
+	Aggregate string
+	Limit     string
+}
+
+// AlertParams are the raw alert query parameters; empty values do not
+// filter
+type AlertParams struct {
+	PatientID    string
+	Ward         string
+	Unit         string
+	Type         string
+	Severity     string
+	Acknowledged string
+	Resolved     string
+	From         string
+	To           string
+	Sort         string
+	Cursor       string
+	Limit        string
+	// CareTeams restricts results to these teams' patients; nil does not
+	CareTeams []string
+}
+
 func NewQueryService(mRepo repository.ObservationRepository, aRepo repository.AlertRepository) *QueryService {
 	return &QueryService{MetricsRepo: mRepo, AlertRepo: aRepo}
 }
 
-func (s *QueryService) GetPatientObservations(ctx context.Context, patientID, from, to string) ([]entities.Observation, error) {
-	return s.MetricsRepo.FetchObservations(ctx, patientID, from, to)
+func (s *QueryService) GetPatientObservations(ctx context.Context, patientID string, params ObservationParams) ([]entities.Observation, error) {
+	q, err := parseObservationQuery(patientID, params)
+	if err != nil {
+		return nil, err
+	}
+	return s.MetricsRepo.FetchObservations(ctx, q)
+}
+
+func (s *QueryService) GetPatientAlerts(ctx context.Context, patientID string, params AlertParams) (repository.AlertPage, error) {
+	params.PatientID = patientID
+	return s.QueryAlerts(ctx, params)
+}
+
+// GetAllPatientAlerts returns every alert of the patient matching params,
+// for clients of the plain array the endpoint served before it was paged
+func (s *QueryService) GetAllPatientAlerts(ctx context.Context, patientID string, params AlertParams) ([]entities.Alert, error) {
+	params.PatientID = patientID
+	params.Limit = strconv.Itoa(repository.MaxAlertLimit)
+	alerts := []entities.Alert{}
+	for {
+		page, err := s.QueryAlerts(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, page.Alerts...)
+		if page.NextCursor == "" {
+			return alerts, nil
+		}
+		params.Cursor = page.NextCursor
+	}
+}
+
+// QueryAlerts pages through alerts across patients, e.g. every open alert
+// of a ward
+func (s *QueryService) QueryAlerts(ctx context.Context, params AlertParams) (repository.AlertPage, error) {
+	q, err := parseAlertQuery(params)
+	if err != nil {
+		return repository.AlertPage{}, err
+	}
+	return s.AlertRepo.Query(ctx, q)
+}
+
+func parseObservationQuery(patientID string, p ObservationParams) (repository.ObservationQuery, error) {
+	from, to, err := repository.ParseTimeRange(p.From, p.To, time.Now())
+	if err != nil {
+		return repository.ObservationQuery{}, err
+	}
+	q := repository.ObservationQuery{
+		PatientID: patientID,
+		From:      from,
+		To:        to,
+		Code:      p.Code,
+		Aggregate: repository.Aggregate(p.Aggregate),
+	}
+	if p.Interval != "" {
+		if q.Interval, err = time.ParseDuration(p.Interval); err != nil {
+			return q, fmt.Errorf("%w: interval must be a duration such as 1m or 1h", repository.ErrInvalidQuery)
+		}
+	}
+	if p.Limit != "" {
+		if q.Limit, err = strconv.Atoi(p.Limit); err != nil {
+			return q, fmt.Errorf("%w: limit must be an integer", repository.ErrInvalidQuery)
+		}
+	}
+	return q, q.Validate()
+}
+
+func parseAlertQuery(p AlertParams) (repository.AlertQuery, error) {
+	q := repository.AlertQuery{
+		PatientID: p.PatientID,
+		Ward:      p.Ward,
+		Unit:      p.Unit,
+		Type:      p.Type,
+		Severity:  p.Severity,
+		Cursor:    p.Cursor,
+		CareTeams: p.CareTeams,
+	}
+
+	parseBool := func(name, v string) (*bool, error) {
+		if v == "" {
+			return nil, nil
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s must be true or false", repository.ErrInvalidQuery, name)
+		}
+		return &b, nil
+	}
+	var err error
+	if q.Acknowledged, err = parseBool("acknowledged", p.Acknowledged); err != nil {
+		return q, err
+	}
+	if q.Resolved, err = parseBool("resolved", p.Resolved); err != nil {
+		return q, err
+	}
+	if q.From, err = parseTime("from", p.From); err != nil {
+		return q, err
+	}
+	if q.To, err = parseTime("to", p.To); err != nil {
+		return q, err
+	}
+	switch p.Sort {
+	case "", "desc":
+	case "asc":
+		q.Ascending = true
+	default:
+		return q, fmt.Errorf("%w: sort must be asc or desc", repository.ErrInvalidQuery)
+	}
+	if p.Limit != "" {
+		if q.Limit, err = strconv.Atoi(p.Limit); err != nil {
+			return q, fmt.Errorf("%w: limit must be an integer", repository.ErrInvalidQuery)
+		}
+	}
+	return q, q.Validate()
 }
 
-func (s *QueryService) GetPatientAlerts(ctx context.Context, patientID string) ([]entities.Alert, error) {
-	return s.AlertRepo.FetchByPatient(ctx, patientID)
+// parseTime reads an optional RFC3339 query parameter
+func parseTime(name, v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, fmt.Errorf("%w: %s must be an RFC3339 timestamp", repository.ErrInvalidQuery, name)
+	}
+	return t.UTC(), nil
 }
@@ -0,0 +1,194 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/webhook"
+)
+
+var (
+	// ErrWebhookNotFound is returned for subscription IDs that are not
+	// stored
+	ErrWebhookNotFound = errors.New("webhook subscription not found")
+	// ErrDeliveryNotFound is returned for delivery IDs that are not in the
+	// subscription's log
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+// WebhookService lets admins manage webhook subscriptions and inspect and
+// replay their deliveries
+type WebhookService struct {
+	Repo repository.WebhookRepository
+}
+
+// WebhookParams describe a new subscription; empty filters match every
+// event
+type WebhookParams struct {
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	EventTypes  []string `json:"event_types"`
+	PatientIDs  []string `json:"patient_ids"`
+	Wards       []string `json:"wards"`
+	MinSeverity string   `json:"min_severity"`
+}
+
+// CreatedWebhook is a new subscription together with its signing secret,
+// which is not shown again
+type CreatedWebhook struct {
+	*entities.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// DeliveryParams are the raw delivery log query parameters
+type DeliveryParams struct {
+	Status string
+	Cursor string
+	Limit  string
+}
+
+func NewWebhookService(repo repository.WebhookRepository) *WebhookService {
+	return &WebhookService{Repo: repo}
+}
+
+func (s *WebhookService) Create(ctx context.Context, params WebhookParams, createdBy string) (*CreatedWebhook, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	id, err := webhook.NewSubscriptionID()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	sub := &entities.WebhookSubscription{
+		ID:          id,
+		URL:         params.URL,
+		Description: params.Description,
+		Secret:      secret,
+		EventTypes:  nonNil(params.EventTypes),
+		PatientIDs:  nonNil(params.PatientIDs),
+		Wards:       nonNil(params.Wards),
+		MinSeverity: params.MinSeverity,
+		CreatedBy:   createdBy,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.Repo.CreateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	return &CreatedWebhook{WebhookSubscription: sub, Secret: secret}, nil
+}
+
+func (p WebhookParams) validate() error {
+	u, err := url.Parse(p.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", repository.ErrInvalidQuery)
+	}
+	for _, t := range p.EventTypes {
+		if !contains(entities.WebhookEventTypes, t) {
+			return fmt.Errorf("%w: unknown event type %q", repository.ErrInvalidQuery, t)
+		}
+	}
+	if p.MinSeverity != "" && entities.SeverityRank(p.MinSeverity) == 0 {
+		return fmt.Errorf("%w: min_severity must be info, warning or critical", repository.ErrInvalidQuery)
+	}
+	return nil
+}
+
+func (s *WebhookService) List(ctx context.Context) ([]entities.WebhookSubscription, error) {
+	subs, err := s.Repo.Subscriptions(ctx)
+	if subs == nil {
+		subs = []entities.WebhookSubscription{}
+	}
+	return subs, err
+}
+
+func (s *WebhookService) Get(ctx context.Context, id string) (*entities.WebhookSubscription, error) {
+	sub, err := s.Repo.FetchSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, ErrWebhookNotFound
+	}
+	return sub, nil
+}
+
+// Delete removes the subscription; its pending deliveries are dead-lettered
+// when next due
+func (s *WebhookService) Delete(ctx context.Context, id string) error {
+	ok, err := s.Repo.DeleteSubscription(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// Deliveries pages the delivery log of a subscription, newest first. The
+// log outlives a deleted subscription.
+func (s *WebhookService) Deliveries(ctx context.Context, id string, params DeliveryParams) (repository.WebhookDeliveryPage, error) {
+	q := repository.WebhookDeliveryQuery{SubscriptionID: id, Status: params.Status, Cursor: params.Cursor}
+	if params.Limit != "" {
+		var err error
+		if q.Limit, err = strconv.Atoi(params.Limit); err != nil {
+			return repository.WebhookDeliveryPage{}, fmt.Errorf("%w: limit must be an integer", repository.ErrInvalidQuery)
+		}
+	}
+	if err := q.Validate(); err != nil {
+		return repository.WebhookDeliveryPage{}, err
+	}
+	return s.Repo.Deliveries(ctx, q)
+}
+
+// Redeliver queues a delivery again with a fresh set of attempts, e.g. a
+// dead-lettered one after the receiver was fixed
+func (s *WebhookService) Redeliver(ctx context.Context, id, deliveryID string) (*entities.WebhookDelivery, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	d, err := s.Repo.FetchDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil || d.SubscriptionID != id {
+		return nil, ErrDeliveryNotFound
+	}
+	now := time.Now().UTC()
+	d.Status = entities.WebhookPending
+	d.Attempts = 0
+	d.NextAttemptAt = now
+	d.UpdatedAt = now
+	if err := s.Repo.UpdateDelivery(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lioarce01/remote-patient-monitoring-system/api-service/internal/application"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+)
+
+type AlertHandler struct {
+	Service *application.AlertService
+	Access  *auth.Access
+}
+
+func NewAlertHandler(svc *application.AlertService, access *auth.Access) *AlertHandler {
+	return &AlertHandler{Service: svc, Access: access}
+}
+
+// RegisterRoutes expects r to run Authenticate; clinical staff may
+// acknowledge and resolve alerts of the patients they may read
+func (h *AlertHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.Use(RequireRole(auth.RoleNurse, auth.RolePhysician, auth.RoleAdmin))
+	r.POST("/alerts/:alert_id/acknowledge", h.transition(h.Service.Acknowledge))
+	r.POST("/alerts/:alert_id/resolve", h.transition(h.Service.Resolve))
+}
+
+// transition serves a lifecycle change of the alert, made by the caller,
+// once the caller is found to be allowed to read its patient
+func (h *AlertHandler) transition(apply func(ctx context.Context, id, by string) (*entities.Alert, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		alert, err := h.Service.GetAlert(ctx, c.Param("alert_id"))
+		if errors.Is(err, application.ErrAlertNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(auditPatientKey, alert.PatientID)
+		if !canReadPatient(c, h.Access, alert.PatientID) {
+			return
+		}
+
+		alert, err = apply(ctx, alert.ID, auth.FromContext(ctx).Subject)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, alert)
+	}
+}
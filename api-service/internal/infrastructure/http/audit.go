@@ -0,0 +1,35 @@
+package http
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/audit"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+)
+
+// auditPatientKey is the gin context key of the patient a request
+// concerns, for handlers whose route does not name the patient
+const auditPatientKey = "audit.patient_id"
+
+// Audit records every request once it has been served, rejected ones
+// included. It must run before Authenticate so that failed logins are
+// recorded too.
+func Audit(repo repository.AuditRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		e := audit.Event(c.Request, auth.FromContext(c.Request.Context()), c.Writer.Status(), start)
+		e.ClientIP = c.ClientIP()
+		e.PatientID = c.GetString(auditPatientKey)
+		if e.PatientID == "" {
+			e.PatientID = c.Param("id")
+		}
+		if e.PatientID == "" {
+			e.PatientID = c.Query("patient_id")
+		}
+		audit.Record(c.Request.Context(), repo, e)
+	}
+}
@@ -0,0 +1,40 @@
+package http
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+)
+
+// Authenticate verifies the bearer token and stores the principal in the
+// request context
+func Authenticate(v auth.Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, err := v.Verify(c.Request.Context(), auth.BearerToken(c.Request))
+		if err != nil {
+			if !errors.Is(err, auth.ErrUnauthenticated) {
+				log.Printf("[Authenticate] %v", err)
+			}
+			c.Header("WWW-Authenticate", `Bearer realm="rpm"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), p))
+		c.Next()
+	}
+}
+
+// RequireRole rejects principals holding none of roles
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := auth.FromContext(c.Request.Context())
+		if p == nil || !p.HasRole(roles...) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": auth.ErrForbidden.Error()})
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,41 +1,75 @@
 package http
 
 import (
-	"log"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lioarce01/remote-patient-monitoring-system/api-service/internal/application"
 	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
 )
 
 type QueryHandler struct {
 	Service *application.QueryService
+	Access  *auth.Access
 }
 
-func NewQueryHandler(svc *application.QueryService) *QueryHandler {
-	return &QueryHandler{Service: svc}
+func NewQueryHandler(svc *application.QueryService, access *auth.Access) *QueryHandler {
+	return &QueryHandler{Service: svc, Access: access}
 }
 
+// RegisterRoutes expects r to run Authenticate; patient data is readable
+// by clinical staff within their care teams and by admins
 func (h *QueryHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.Use(RequireRole(auth.RoleNurse, auth.RolePhysician, auth.RoleAdmin))
 	r.GET("/patients/:id/observations", h.getObservations)
 	r.GET("/patients/:id/alerts", h.getAlerts)
+	r.GET("/alerts", h.listAlerts)
 }
 
-func (h *QueryHandler) getObservations(c *gin.Context) {
-	id := c.Param("id")
-	from := c.Query("from")
-	to := c.Query("to")
+func (h *QueryHandler) canReadPatient(c *gin.Context, patientID string) bool {
+	return canReadPatient(c, h.Access, patientID)
+}
 
-	data, err := h.Service.GetPatientObservations(c.Request.Context(), id, from, to)
+// canReadPatient writes 403 or 500 and returns false when the caller may
+// not read the patient's data
+func canReadPatient(c *gin.Context, access *auth.Access, patientID string) bool {
+	ok, err := access.CanReadPatient(c.Request.Context(), auth.FromContext(c.Request.Context()), patientID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": auth.ErrForbidden.Error()})
+		return false
+	}
+	return true
+}
+
+func (h *QueryHandler) getObservations(c *gin.Context) {
+	id := c.Param("id")
+	if !h.canReadPatient(c, id) {
 		return
 	}
+	params := application.ObservationParams{
+		From:      c.Query("from"),
+		To:        c.Query("to"),
+		Code:      c.Query("code"),
+		Interval:  c.Query("interval"),
+		Aggregate: c.Query("agg"),
+		Limit:     c.Query("limit"),
+	}
 
-	log.Printf("[getObservations] returning %d observations", len(data))
-	for i, obs := range data {
-		log.Printf("Observation %d: %+v", i, obs)
+	data, err := h.Service.GetPatientObservations(c.Request.Context(), id, params)
+	if errors.Is(err, repository.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	if len(data) == 0 {
@@ -47,11 +81,60 @@ func (h *QueryHandler) getObservations(c *gin.Context) {
 
 func (h *QueryHandler) getAlerts(c *gin.Context) {
 	id := c.Param("id")
+	if !h.canReadPatient(c, id) {
+		return
+	}
+
+	params := alertParams(c)
+	// without paging parameters the response stays the array it was before
+	// paging was added, so existing clients keep working
+	if params.Cursor == "" && params.Limit == "" {
+		alerts, err := h.Service.GetAllPatientAlerts(c.Request.Context(), id, params)
+		if err != nil {
+			writeAlertPage(c, repository.AlertPage{}, err)
+			return
+		}
+		c.JSON(http.StatusOK, alerts)
+		return
+	}
+	page, err := h.Service.GetPatientAlerts(c.Request.Context(), id, params)
+	writeAlertPage(c, page, err)
+}
 
-	data, err := h.Service.GetPatientAlerts(c.Request.Context(), id)
+// listAlerts serves cross-patient views, e.g. /alerts?ward=icu&resolved=false
+func (h *QueryHandler) listAlerts(c *gin.Context) {
+	params := alertParams(c)
+	params.PatientID = c.Query("patient_id")
+	params.CareTeams = h.Access.PatientScope(auth.FromContext(c.Request.Context()))
+
+	page, err := h.Service.QueryAlerts(c.Request.Context(), params)
+	writeAlertPage(c, page, err)
+}
+
+func alertParams(c *gin.Context) application.AlertParams {
+	return application.AlertParams{
+		Ward:         c.Query("ward"),
+		Unit:         c.Query("unit"),
+		Type:         c.Query("type"),
+		Severity:     c.Query("severity"),
+		Acknowledged: c.Query("acknowledged"),
+		Resolved:     c.Query("resolved"),
+		From:         c.Query("from"),
+		To:           c.Query("to"),
+		Sort:         c.Query("sort"),
+		Cursor:       c.Query("cursor"),
+		Limit:        c.Query("limit"),
+	}
+}
+
+func writeAlertPage(c *gin.Context, page repository.AlertPage, err error) {
+	if errors.Is(err, repository.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, data)
+	c.JSON(http.StatusOK, page)
 }
@@ -0,0 +1,29 @@
+package http
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/audit"
+)
+
+// Logger logs every request like gin's default logger, except that
+// credentials in the query string are redacted the way audit events
+// redact them
+func Logger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(p gin.LogFormatterParams) string {
+		path := p.Request.URL.Path
+		if query := p.Request.URL.Query(); len(query) > 0 {
+			path += "?" + audit.RedactQuery(query)
+		}
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+			p.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			p.StatusCode,
+			p.Latency,
+			p.ClientIP,
+			p.Method,
+			path,
+			p.ErrorMessage,
+		)
+	})
+}
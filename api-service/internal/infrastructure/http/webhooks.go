@@ -0,0 +1,89 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lioarce01/remote-patient-monitoring-system/api-service/internal/application"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+)
+
+// createWebhook answers 201 with the subscription and its signing secret,
+// the only time the secret is shown
+func (h *AdminHandler) createWebhook(c *gin.Context) {
+	var params application.WebhookParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	created, err := h.Webhooks.Create(ctx, params, auth.FromContext(ctx).Subject)
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+func (h *AdminHandler) listWebhooks(c *gin.Context) {
+	subs, err := h.Webhooks.List(c.Request.Context())
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, subs)
+}
+
+func (h *AdminHandler) getWebhook(c *gin.Context) {
+	sub, err := h.Webhooks.Get(c.Request.Context(), c.Param("webhook_id"))
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+func (h *AdminHandler) deleteWebhook(c *gin.Context) {
+	if err := h.Webhooks.Delete(c.Request.Context(), c.Param("webhook_id")); err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// webhookDeliveries serves the delivery log, e.g.
+// /admin/webhooks/wh-1/deliveries?status=dead
+func (h *AdminHandler) webhookDeliveries(c *gin.Context) {
+	page, err := h.Webhooks.Deliveries(c.Request.Context(), c.Param("webhook_id"), application.DeliveryParams{
+		Status: c.Query("status"),
+		Cursor: c.Query("cursor"),
+		Limit:  c.Query("limit"),
+	})
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *AdminHandler) redeliverWebhook(c *gin.Context) {
+	d, err := h.Webhooks.Redeliver(c.Request.Context(), c.Param("webhook_id"), c.Param("delivery_id"))
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, d)
+}
+
+func writeWebhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrInvalidQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, application.ErrWebhookNotFound), errors.Is(err, application.ErrDeliveryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,33 @@
+package e2e
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestScenarios runs every scenario against a fresh Harness
+func TestScenarios(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	for _, sc := range scenarios {
+		t.Run(sc.name, func(t *testing.T) {
+			h, err := Start()
+			if err != nil {
+				t.Fatalf("start harness: %v", err)
+			}
+			t.Cleanup(h.Close)
+			sc.run(t, h)
+		})
+	}
+}
+
+// testContext bounds a scenario's requests and is cancelled when it ends
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
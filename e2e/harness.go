@@ -0,0 +1,853 @@
+// Package e2e wires ingest, processing, API and notification services in
+// one process on top of the in-memory fakes and stand-ins from
+// pkg/common/testing, so the full telemetry to alert path can be exercised
+// without Kafka, InfluxDB, PostgreSQL or real notification providers.
+package e2e
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	apiapp "github.com/lioarce01/remote-patient-monitoring-system/api-service/app"
+	ingestapp "github.com/lioarce01/remote-patient-monitoring-system/ingest-service/app"
+	notificationapp "github.com/lioarce01/remote-patient-monitoring-system/notification-service/app"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/notify"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/webhook"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/ws"
+	rpmtesting "github.com/lioarce01/remote-patient-monitoring-system/pkg/common/testing"
+	processingapp "github.com/lioarce01/remote-patient-monitoring-system/processing-service/app"
+)
+
+const (
+	ObservationTopic = "observations"
+	AlertTopic       = "alerts"
+	// HeartbeatInterval is how often the API pings WebSocket clients and
+	// sends SSE heartbeats
+	HeartbeatInterval = 500 * time.Millisecond
+)
+
+// Devices registered with ingest. The gateway may report for any patient,
+// the others only for DevicePatient; SignedDevice must sign its payloads.
+const (
+	GatewayDevice = "e2e-gateway"
+	MonitorDevice = "e2e-monitor"
+	SignedDevice  = "e2e-signed"
+	DevicePatient = "patient-e2e-5"
+)
+
+// Notification routes only match NotifyPatient. Critical alerts are
+// emailed to OnCallEmail and RejectedEmail, which the SMTP stand-in
+// refuses, texted to OnCallPhone and paged to PagerRoutingKey; every alert
+// is posted to the webhook stand-in.
+const (
+	NotifyPatient   = "patient-e2e-17"
+	OnCallEmail     = "oncall@e2e.test"
+	RejectedEmail   = "retired@e2e.test"
+	OnCallPhone     = "+15550100"
+	PagerRoutingKey = "e2e-routing-key"
+	// NotifyRetries is the attempts every channel gets, NotifyBackoff the
+	// wait before the first retry
+	NotifyRetries = 4
+	NotifyBackoff = 50 * time.Millisecond
+)
+
+// Critical alerts of EscalationWard patients escalate from the primary
+// nurse to the charge nurse to the physician on call, EscalationWait
+// apart. The primary nurse rotation has two nurses; OnDutyNurse holds it
+// now. Critical alerts of WardRoutePatient, who is in EscalationWard, are
+// also routed to OnDutyNurse.
+const (
+	EscalationWard   = "e2e-escalation-ward"
+	WardRoutePatient = "patient-e2e-22"
+	EscalationWait   = 500 * time.Millisecond
+	OffDutyNurse     = "nurse-a@e2e.test"
+	OnDutyNurse      = "nurse-b@e2e.test"
+	ChargeNurse      = "charge@e2e.test"
+	PhysicianPager   = "physician-routing-key"
+)
+
+// Webhook subscriptions are posted to the EHR stand-ins. Deliveries are
+// tried WebhookAttempts times, WebhookBackoff apart at first, before they
+// are dead-lettered.
+const (
+	WebhookAttempts = 3
+	WebhookBackoff  = 50 * time.Millisecond
+)
+
+// Telemetry is the JSON body accepted by ingest's POST /observations
+type Telemetry struct {
+	PatientID string    `json:"patient_id"`
+	Type      string    `json:"type"`
+	Value     float64   `json:"value"`
+	Unit      string    `json:"unit"`
+	DeviceID  string    `json:"device_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type Harness struct {
+	Bus             *rpmtesting.Bus
+	ObservationRepo *rpmtesting.ObservationRepo
+	AlertRepo       *rpmtesting.AlertRepo
+	AuditLog        *rpmtesting.AuditLog
+	// Deliveries and Escalations record the notifier's deliveries and
+	// escalation timers; SMTP, Webhooks, SMS and Pager stand in for the
+	// providers it sends to
+	Deliveries  *rpmtesting.NotificationRepo
+	Escalations *rpmtesting.EscalationRepo
+	SMTP        *rpmtesting.SMTPServer
+	Webhooks    *rpmtesting.HTTPSink
+	SMS         *rpmtesting.HTTPSink
+	Pager       *rpmtesting.HTTPSink
+	// WebhookStore holds the webhook subscriptions admins register and
+	// their delivery log; EHR and BrokenEHR receive the deliveries
+	WebhookStore *rpmtesting.WebhookRepo
+	EHR          *rpmtesting.HTTPSink
+	BrokenEHR    *rpmtesting.HTTPSink
+	// Tokens signs the bearer tokens the API accepts; AdminToken is used
+	// by helpers that do not take a token
+	Tokens     *rpmtesting.TokenIssuer
+	AdminToken string
+	// DeviceKeys holds the current API key of each device; RetiredKey is
+	// MonitorDevice's expired key and SigningSecret is SignedDevice's
+	// HMAC secret
+	DeviceKeys    map[string]string
+	RetiredKey    string
+	SigningSecret string
+
+	Ingest *httptest.Server
+	// API is the first of Replicas
+	API      *httptest.Server
+	Replicas []*APIReplica
+
+	verifier auth.Verifier
+	ctx      context.Context
+	cancel   context.CancelFunc
+	// relays tracks the processor and every replica's consumers
+	relays  sync.WaitGroup
+	tempDir string
+}
+
+// APIReplica is one instance of the API service. Like api-service with
+// REPLICA_ID, each replica consumes alerts and observations in groups of
+// its own, so it receives every message.
+type APIReplica struct {
+	ID     string
+	Server *httptest.Server
+	app    *apiapp.App
+}
+
+// Start runs ingest, processing, API and notification services
+// in-process. Call Close when done.
+func Start() (*Harness, error) {
+	h := &Harness{
+		Bus:             rpmtesting.NewBus(),
+		ObservationRepo: rpmtesting.NewObservationRepo(),
+		AlertRepo:       rpmtesting.NewAlertRepo(),
+		AuditLog:        rpmtesting.NewAuditLog(),
+		Deliveries:      rpmtesting.NewNotificationRepo(),
+		Escalations:     rpmtesting.NewEscalationRepo(),
+		Webhooks:        rpmtesting.NewHTTPSink(),
+		SMS:             rpmtesting.NewHTTPSink(),
+		Pager:           rpmtesting.NewHTTPSink(),
+		WebhookStore:    rpmtesting.NewWebhookRepo(),
+		EHR:             rpmtesting.NewHTTPSink(),
+		BrokenEHR:       rpmtesting.NewHTTPSink(),
+	}
+
+	// the API verifies real tokens signed by a local key
+	var err error
+	if h.tempDir, err = os.MkdirTemp("", "rpm-e2e"); err != nil {
+		return nil, err
+	}
+	if h.Tokens, err = rpmtesting.NewTokenIssuer(h.tempDir); err != nil {
+		return nil, err
+	}
+	if h.verifier, err = h.Tokens.Verifier(); err != nil {
+		return nil, err
+	}
+	if h.AdminToken, err = h.Tokens.Token("e2e-admin", []string{auth.RoleAdmin}, nil); err != nil {
+		return nil, err
+	}
+
+	devices, err := h.registerDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+
+	notifier, err := h.notifier()
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	// consumers subscribe before anything is published
+	obsConsumer := h.Bus.Subscriber(ObservationTopic, "processing")
+	notifyConsumer := h.Bus.Subscriber(AlertTopic, "notifications")
+	processor := processingapp.NewProcessor(h.Bus.Publisher(AlertTopic), h.AlertRepo, h.ObservationRepo, nil)
+	first, err := h.StartReplica("a")
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	h.API = first.Server
+
+	h.Ingest = httptest.NewServer(ingestapp.NewRouter(h.Bus.Publisher(ObservationTopic), h.ObservationRepo, devices, h.AuditLog))
+
+	// webhook retries are quick so dead-lettering can be observed
+	sender := webhook.NewSender(h.WebhookStore, webhook.Config{
+		MaxAttempts:  WebhookAttempts,
+		Backoff:      WebhookBackoff,
+		MaxBackoff:   4 * WebhookBackoff,
+		Timeout:      5 * time.Second,
+		PollInterval: WebhookBackoff / 2,
+	})
+
+	h.relays.Add(3)
+	go func() {
+		defer h.relays.Done()
+		processor.Run(h.ctx, obsConsumer)
+	}()
+	go func() {
+		defer h.relays.Done()
+		notifier.Run(h.ctx, notifyConsumer)
+	}()
+	go func() {
+		defer h.relays.Done()
+		sender.Run(h.ctx)
+	}()
+
+	return h, nil
+}
+
+// notifier routes NotifyPatient's alerts to the stand-ins and escalates
+// EscalationWard's, retrying and escalating quickly so both can be
+// observed
+func (h *Harness) notifier() (*notificationapp.Notifier, error) {
+	var err error
+	if h.SMTP, err = rpmtesting.NewSMTPServer(); err != nil {
+		return nil, err
+	}
+	h.SMTP.Reject(RejectedEmail)
+	sms, err := notify.NewSMS(notify.SMSConfig{Provider: notify.SMSHTTP, URL: h.SMS.URL + "/messages", Token: "e2e-sms-token"})
+	if err != nil {
+		return nil, err
+	}
+	channels := map[string]notify.Channel{
+		entities.ChannelEmail:   notify.NewEmail(notify.SMTPConfig{Host: h.SMTP.Host, Port: h.SMTP.Port, From: "rpm@e2e.test"}),
+		entities.ChannelSMS:     sms,
+		entities.ChannelWebhook: notify.NewWebhook(),
+		entities.ChannelPager:   notify.NewPager(h.Pager.URL + "/v2/enqueue"),
+	}
+
+	patients := []string{NotifyPatient}
+	retry := notificationapp.RetryPolicy{
+		Attempts:   NotifyRetries,
+		Backoff:    notificationapp.Duration(NotifyBackoff),
+		MaxBackoff: notificationapp.Duration(4 * NotifyBackoff),
+	}
+	cfg := notificationapp.Config{
+		Routes: []notificationapp.Route{
+			{Name: "oncall-email", Channel: entities.ChannelEmail, To: []string{OnCallEmail, RejectedEmail}, MinSeverity: entities.SeverityCritical, PatientIDs: patients},
+			{Name: "oncall-sms", Channel: entities.ChannelSMS, To: []string{OnCallPhone}, MinSeverity: entities.SeverityCritical, PatientIDs: patients},
+			{Name: "oncall-pager", Channel: entities.ChannelPager, To: []string{PagerRoutingKey}, MinSeverity: entities.SeverityCritical, PatientIDs: patients},
+			{Name: "ehr-webhook", Channel: entities.ChannelWebhook, To: []string{h.Webhooks.URL + "/hooks/alerts"}, PatientIDs: patients},
+			{Name: "ward-email", Channel: entities.ChannelEmail, To: []string{OnDutyNurse}, MinSeverity: entities.SeverityCritical, PatientIDs: []string{WardRoutePatient}},
+		},
+		Retry: map[string]notificationapp.RetryPolicy{
+			entities.ChannelEmail:   retry,
+			entities.ChannelSMS:     retry,
+			entities.ChannelWebhook: retry,
+			entities.ChannelPager:   retry,
+		},
+		PollInterval: notificationapp.Duration(NotifyBackoff / 2),
+		OnCall: map[string]map[string]notificationapp.Rotation{
+			EscalationWard: {
+				"primary_nurse": {
+					// the second shift of two started half a shift ago
+					Start: time.Now().Add(-36 * time.Hour),
+					Shift: notificationapp.Duration(24 * time.Hour),
+					Staff: []notificationapp.Contact{
+						{Name: "Nurse A", Channel: entities.ChannelEmail, To: OffDutyNurse},
+						{Name: "Nurse B", Channel: entities.ChannelEmail, To: OnDutyNurse},
+					},
+				},
+				"charge_nurse": {Staff: []notificationapp.Contact{{Name: "Charge Nurse", Channel: entities.ChannelEmail, To: ChargeNurse}}},
+				"physician":    {Staff: []notificationapp.Contact{{Name: "Physician", Channel: entities.ChannelPager, To: PhysicianPager}}},
+			},
+		},
+		Escalations: []notificationapp.EscalationPolicy{{
+			Name:        "critical-unacknowledged",
+			MinSeverity: entities.SeverityCritical,
+			Wards:       []string{EscalationWard},
+			Steps: []notificationapp.EscalationStep{
+				{Role: "primary_nurse", Wait: notificationapp.Duration(EscalationWait)},
+				{Role: "charge_nurse", Wait: notificationapp.Duration(EscalationWait)},
+				{Role: "physician"},
+			},
+		}},
+	}
+	return notificationapp.NewNotifier(notificationapp.Stores{
+		Deliveries:  h.Deliveries,
+		Escalations: h.Escalations,
+		Alerts:      h.AlertRepo,
+		Patients:    h.AlertRepo.Patients(),
+		CareTeams:   h.AlertRepo,
+		Webhooks:    h.WebhookStore,
+	}, channels, cfg)
+}
+
+// StartReplica runs another API service instance on the same stores and
+// bus. It only receives messages published after it started.
+func (h *Harness) StartReplica(id string) (*APIReplica, error) {
+	for _, r := range h.Replicas {
+		if r.ID == id {
+			return nil, fmt.Errorf("replica %s is already running", id)
+		}
+	}
+	alertConsumer := h.Bus.Subscriber(AlertTopic, "api-"+id)
+	vitalsConsumer := h.Bus.Subscriber(ObservationTopic, "api-vitals-"+id)
+
+	// frequent keepalives so SSE heartbeats can be observed
+	wsConfig := ws.DefaultConfig()
+	wsConfig.PingInterval = HeartbeatInterval
+	api := apiapp.New(h.ObservationRepo, h.AlertRepo, apiapp.Security{
+		Verifier:  h.verifier,
+		CareTeams: h.AlertRepo,
+		Audit:     h.AuditLog,
+		Patients:  h.AlertRepo.Patients(),
+		Webhooks:  h.WebhookStore,
+	}, ws.WithConfig(wsConfig))
+	r := &APIReplica{ID: id, Server: httptest.NewServer(api.Router), app: api}
+	h.Replicas = append(h.Replicas, r)
+
+	h.relays.Add(2)
+	go func() {
+		defer h.relays.Done()
+		api.RelayAlerts(h.ctx, alertConsumer)
+	}()
+	go func() {
+		defer h.relays.Done()
+		api.RelayObservations(h.ctx, vitalsConsumer)
+	}()
+	return r, nil
+}
+
+// registerDevices writes the device registry used by ingest
+func (h *Harness) registerDevices() (*auth.DeviceRegistry, error) {
+	h.DeviceKeys = make(map[string]string)
+	h.SigningSecret = "e2e-signing-secret"
+	var file struct {
+		Devices []auth.Device `json:"devices"`
+	}
+	for _, d := range []auth.Device{
+		{ID: GatewayDevice, Patients: []string{auth.AnyPatient}},
+		{ID: MonitorDevice, Patients: []string{DevicePatient}},
+		{ID: SignedDevice, Patients: []string{DevicePatient}, HMACSecret: h.SigningSecret},
+	} {
+		key, hash, err := auth.NewDeviceKey()
+		if err != nil {
+			return nil, err
+		}
+		h.DeviceKeys[d.ID] = key
+		d.Keys = []auth.DeviceKey{{ID: "current", SHA256: hash}}
+		if d.ID == MonitorDevice {
+			retired, hash, err := auth.NewDeviceKey()
+			if err != nil {
+				return nil, err
+			}
+			h.RetiredKey = retired
+			d.Keys = append(d.Keys, auth.DeviceKey{ID: "retired", SHA256: hash, NotAfter: time.Now().Add(-time.Hour)})
+		}
+		file.Devices = append(file.Devices, d)
+	}
+
+	raw, err := json.Marshal(file)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(h.tempDir, "devices.json")
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		return nil, err
+	}
+	return auth.OpenDeviceRegistry(path, time.Minute, rpmtesting.NewNonceRepo())
+}
+
+// Close stops the consumers and every HTTP server
+func (h *Harness) Close() {
+	h.cancel()
+	h.relays.Wait()
+	for _, r := range h.Replicas {
+		r.app.Close()
+		r.Server.Close()
+	}
+	if h.Ingest != nil {
+		h.Ingest.Close()
+	}
+	if h.SMTP != nil {
+		h.SMTP.Close()
+	}
+	for _, sink := range []*rpmtesting.HTTPSink{h.Webhooks, h.SMS, h.Pager, h.EHR, h.BrokenEHR} {
+		sink.Close()
+	}
+	os.RemoveAll(h.tempDir)
+}
+
+// Get sends an authenticated GET to the API, decodes a 200 response into
+// out and returns the status code
+func (h *Harness) Get(ctx context.Context, path, token string, out interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.API.URL+path, nil)
+	if err != nil {
+		return 0, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || out == nil {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Post sends an authenticated POST without a body to the API, decodes a
+// 200 response into out and returns the status code
+func (h *Harness) Post(ctx context.Context, path, token string, out interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.API.URL+path, nil)
+	if err != nil {
+		return 0, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || out == nil {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Send sends an authenticated request with body, if not nil, as JSON to
+// the API, decodes a 2xx response into out and returns the status code
+func (h *Harness) Send(ctx context.Context, method, path, token string, body, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.API.URL+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || out == nil {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// PostTelemetry sends t to the ingest service as the gateway device and
+// expects 202 Accepted
+func (h *Harness) PostTelemetry(ctx context.Context, t Telemetry) error {
+	body, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	header := http.Header{auth.HeaderDeviceKey: {h.DeviceKeys[GatewayDevice]}}
+	status, err := h.PostObservation(ctx, body, header)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusAccepted {
+		return fmt.Errorf("ingest returned %d", status)
+	}
+	return nil
+}
+
+// PostObservation sends a raw body with the given headers to ingest and
+// returns the status code
+func (h *Harness) PostObservation(ctx context.Context, body []byte, header http.Header) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.Ingest.URL+"/observations", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// AlertStream is a WebSocket client of the API service's /ws/alerts
+type AlertStream struct {
+	conn *websocket.Conn
+	// frames read while waiting for something else
+	pending []ws.ServerMessage
+}
+
+// DialAlerts connects to the alert WebSocket as an admin and subscribes to
+// every alert
+func (h *Harness) DialAlerts(ctx context.Context) (*AlertStream, error) {
+	return h.DialAlertsAs(ctx, h.AdminToken)
+}
+
+// DialAlertsAs connects with token and subscribes to every alert the token
+// may read
+func (h *Harness) DialAlertsAs(ctx context.Context, token string) (*AlertStream, error) {
+	s, err := h.OpenAlertStream(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Subscribe("all", ws.Subscription{}); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenAlertStream connects with token without subscribing
+func (h *Harness) OpenAlertStream(ctx context.Context, token string) (*AlertStream, error) {
+	return h.Replicas[0].OpenAlertStream(ctx, token)
+}
+
+// OpenAlertStream connects to this replica with token without subscribing
+func (r *APIReplica) OpenAlertStream(ctx context.Context, token string) (*AlertStream, error) {
+	url := "ws" + strings.TrimPrefix(r.Server.URL, "http") + "/ws/alerts?access_token=" + token
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("%w (%s)", err, resp.Status)
+		}
+		return nil, err
+	}
+	return &AlertStream{conn: conn}, nil
+}
+
+// Subscribe adds or replaces subscription id and waits for the reply
+func (s *AlertStream) Subscribe(id string, sub ws.Subscription) error {
+	return s.request(ws.ClientMessage{Type: ws.TypeSubscribe, ID: id, Subscription: sub}, ws.TypeSubscribed)
+}
+
+// SubscribeSince is Subscribe that first replays stored alerts with a Seq
+// above since; read them with Expect and the end of the replay with
+// Replayed
+func (s *AlertStream) SubscribeSince(id string, sub ws.Subscription, since int64) error {
+	return s.request(ws.ClientMessage{Type: ws.TypeSubscribe, ID: id, Since: since, Subscription: sub}, ws.TypeSubscribed)
+}
+
+// Unsubscribe removes subscription id and waits for the reply
+func (s *AlertStream) Unsubscribe(id string) error {
+	return s.request(ws.ClientMessage{Type: ws.TypeUnsubscribe, ID: id}, ws.TypeUnsubscribed)
+}
+
+func (s *AlertStream) request(msg ws.ClientMessage, reply string) error {
+	if err := s.conn.WriteJSON(msg); err != nil {
+		return err
+	}
+	s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var m ws.ServerMessage
+		if err := s.conn.ReadJSON(&m); err != nil {
+			return fmt.Errorf("no %s reply: %w", reply, err)
+		}
+		switch {
+		case m.Type == ws.TypeError:
+			return fmt.Errorf("%s %s: %s", msg.Type, msg.ID, m.Error)
+		case m.Type == reply && m.ID == msg.ID:
+			return nil
+		default:
+			s.pending = append(s.pending, m)
+		}
+	}
+}
+
+// next returns the first frame of type typ that satisfies match, pending
+// frames first. Frames of that type that do not match are dropped; other
+// frames are kept for later calls.
+func (s *AlertStream) next(timeout time.Duration, typ string, match func(ws.ServerMessage) bool) (ws.ServerMessage, error) {
+	kept := s.pending[:0]
+	for i, m := range s.pending {
+		if m.Type != typ {
+			kept = append(kept, m)
+			continue
+		}
+		if match(m) {
+			s.pending = append(kept, s.pending[i+1:]...)
+			return m, nil
+		}
+	}
+	s.pending = kept
+
+	s.conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		var m ws.ServerMessage
+		if err := s.conn.ReadJSON(&m); err != nil {
+			return m, fmt.Errorf("no matching %s before deadline: %w", typ, err)
+		}
+		if m.Type != typ {
+			s.pending = append(s.pending, m)
+			continue
+		}
+		if match(m) {
+			return m, nil
+		}
+	}
+}
+
+// Expect reads alerts until one satisfies match or timeout elapses
+func (s *AlertStream) Expect(timeout time.Duration, match func(*entities.Alert) bool) (*entities.Alert, error) {
+	m, err := s.next(timeout, ws.TypeAlert, func(m ws.ServerMessage) bool { return m.Alert != nil && match(m.Alert) })
+	return m.Alert, err
+}
+
+// ExpectVital reads live vitals until one satisfies match or timeout
+// elapses
+func (s *AlertStream) ExpectVital(timeout time.Duration, match func(ws.Vital) bool) (*ws.Vital, error) {
+	m, err := s.next(timeout, ws.TypeVital, func(m ws.ServerMessage) bool { return m.Vital != nil && match(*m.Vital) })
+	return m.Vital, err
+}
+
+// Replayed waits for the end of subscription id's replay. Alerts read
+// meanwhile stay pending for Expect.
+func (s *AlertStream) Replayed(timeout time.Duration, id string) (ws.ServerMessage, error) {
+	return s.next(timeout, ws.TypeReplayed, func(m ws.ServerMessage) bool { return m.ID == id })
+}
+
+// Snapshot returns the snapshot sent after subscribing id to vitals
+func (s *AlertStream) Snapshot(timeout time.Duration, id string) ([]ws.Vital, error) {
+	m, err := s.next(timeout, ws.TypeSnapshot, func(m ws.ServerMessage) bool { return m.ID == id })
+	return m.Vitals, err
+}
+
+// ExpectNone fails if an alert satisfying match arrives within wait. The
+// stream cannot be read afterwards, since the deadline has passed.
+func (s *AlertStream) ExpectNone(wait time.Duration, match func(*entities.Alert) bool) error {
+	if alert, err := s.Expect(wait, match); err == nil {
+		return fmt.Errorf("unexpected alert %s for %s (%s)", alert.Type, alert.PatientID, alert.Severity)
+	}
+	return nil
+}
+
+// ExpectNoVital is ExpectNone for vitals
+func (s *AlertStream) ExpectNoVital(wait time.Duration, match func(ws.Vital) bool) error {
+	if v, err := s.ExpectVital(wait, match); err == nil {
+		return fmt.Errorf("unexpected %s vital for %s", v.Code, v.PatientID)
+	}
+	return nil
+}
+
+func (s *AlertStream) Close() error {
+	return s.conn.Close()
+}
+
+// EventStream is a Server-Sent Events client of the API service's
+// /sse/alerts
+type EventStream struct {
+	body   io.ReadCloser
+	events chan Event
+	done   chan struct{}
+	// LastEventID is the ID of the last event read that had one, as an
+	// EventSource would resend it when reconnecting
+	LastEventID string
+	// Heartbeats counts the heartbeat comments read so far
+	Heartbeats int
+}
+
+// Event is one server-sent event. Heartbeat comments are events of type
+// "heartbeat".
+type Event struct {
+	ID      string
+	Type    string
+	Message ws.ServerMessage
+}
+
+// OpenEventStream opens /sse/alerts with token and the subscription in
+// query, resuming after lastEventID if it is set, and waits for the
+// subscribed event. A refused request returns its status code.
+func (h *Harness) OpenEventStream(ctx context.Context, token string, query url.Values, lastEventID string) (*EventStream, int, error) {
+	return h.Replicas[0].OpenEventStream(ctx, token, query, lastEventID)
+}
+
+// OpenEventStream is Harness.OpenEventStream on this replica
+func (r *APIReplica) OpenEventStream(ctx context.Context, token string, query url.Values, lastEventID string) (*EventStream, int, error) {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("access_token", token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.Server.URL+"/sse/alerts?"+q.Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, resp.StatusCode, fmt.Errorf("event stream refused: %s", resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		resp.Body.Close()
+		return nil, resp.StatusCode, fmt.Errorf("event stream has content type %q", ct)
+	}
+
+	s := &EventStream{body: resp.Body, events: make(chan Event, 64), done: make(chan struct{}), LastEventID: lastEventID}
+	go s.read()
+	if _, err := s.next(5*time.Second, ws.TypeSubscribed, func(Event) bool { return true }); err != nil {
+		s.Close()
+		return nil, resp.StatusCode, err
+	}
+	return s, resp.StatusCode, nil
+}
+
+// read parses events until the body is closed
+func (s *EventStream) read() {
+	defer close(s.events)
+	scanner := bufio.NewScanner(s.body)
+	var ev Event
+	var data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch {
+		case line == "":
+			if data == "" {
+				continue
+			}
+			if err := json.Unmarshal([]byte(data), &ev.Message); err != nil {
+				return
+			}
+			if !s.emit(ev) {
+				return
+			}
+			ev, data = Event{}, ""
+		case field == "" && strings.TrimSpace(value) == "heartbeat":
+			if !s.emit(Event{Type: "heartbeat"}) {
+				return
+			}
+		case field == "id":
+			ev.ID = value
+		case field == "event":
+			ev.Type = value
+		case field == "data":
+			data += value
+		}
+	}
+}
+
+func (s *EventStream) emit(ev Event) bool {
+	select {
+	case s.events <- ev:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// next returns the first event of type typ satisfying match. Events of
+// other types are skipped.
+func (s *EventStream) next(timeout time.Duration, typ string, match func(Event) bool) (Event, error) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case ev, ok := <-s.events:
+			if !ok {
+				return ev, fmt.Errorf("event stream ended while waiting for %s", typ)
+			}
+			if ev.ID != "" {
+				s.LastEventID = ev.ID
+			}
+			if ev.Type == "heartbeat" {
+				s.Heartbeats++
+			}
+			if ev.Type == ws.TypeError {
+				return ev, fmt.Errorf("event stream error: %s", ev.Message.Error)
+			}
+			if ev.Type == typ && match(ev) {
+				return ev, nil
+			}
+		case <-deadline:
+			return Event{}, fmt.Errorf("no matching %s before deadline", typ)
+		}
+	}
+}
+
+// Expect reads events until an alert satisfies match or timeout elapses
+func (s *EventStream) Expect(timeout time.Duration, match func(*entities.Alert) bool) (*entities.Alert, error) {
+	ev, err := s.next(timeout, ws.TypeAlert, func(ev Event) bool { return ev.Message.Alert != nil && match(ev.Message.Alert) })
+	return ev.Message.Alert, err
+}
+
+// ExpectNone fails if an alert satisfying match arrives within wait
+func (s *EventStream) ExpectNone(wait time.Duration, match func(*entities.Alert) bool) error {
+	if alert, err := s.Expect(wait, match); err == nil {
+		return fmt.Errorf("unexpected alert %s for %s (%s)", alert.Type, alert.PatientID, alert.Severity)
+	}
+	return nil
+}
+
+// Replayed waits for the end of the replay requested by Last-Event-ID
+func (s *EventStream) Replayed(timeout time.Duration) (ws.ServerMessage, error) {
+	ev, err := s.next(timeout, ws.TypeReplayed, func(Event) bool { return true })
+	return ev.Message, err
+}
+
+// Heartbeat waits for the next heartbeat comment
+func (s *EventStream) Heartbeat(timeout time.Duration) error {
+	_, err := s.next(timeout, "heartbeat", func(Event) bool { return true })
+	return err
+}
+
+func (s *EventStream) Close() error {
+	close(s.done)
+	return s.body.Close()
+}
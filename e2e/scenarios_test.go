@@ -0,0 +1,1421 @@
+package e2e
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/webhook"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/ws"
+)
+
+// scenario is one end-to-end check run against a fresh Harness
+type scenario struct {
+	name string
+	run  func(t *testing.T, h *Harness)
+}
+
+// scenarios is the end-to-end suite run by TestScenarios
+var scenarios = []scenario{
+	{name: "high heart rate raises alert over websocket", run: highHeartRateAlert},
+	{name: "normal heart rate is stored without threshold alert", run: normalHeartRateStored},
+	{name: "care teams scope patient data and alert streams", run: careTeamScoping},
+	{name: "ingest authenticates devices and their patients", run: deviceAuthentication},
+	{name: "patient data access is audited in a verifiable chain", run: auditTrail},
+	{name: "alert streams only carry subscribed patients and severities", run: alertSubscriptions},
+	{name: "live vitals are pushed, decimated and snapshotted on subscribe", run: liveVitals},
+	{name: "reconnecting clients replay missed alerts once", run: alertReplay},
+	{name: "server-sent events filter, heartbeat and resume from Last-Event-ID", run: eventStream},
+	{name: "every API replica delivers every alert and vital", run: replicaFanOut},
+	{name: "alert fan-out does not wait on care team lookups", run: fanOutDuringOutage},
+	{name: "alerts are notified once per recipient with retries", run: alertNotifications},
+	{name: "unacknowledged critical alerts escalate through the ward's on-call", run: alertEscalation},
+	{name: "route recipients who are on call are still escalated to until the alert is resolved", run: routedEscalation},
+	{name: "webhook subscriptions receive signed, retried and dead-lettered events", run: webhookSubscriptions},
+}
+
+func fanOutDuringOutage(t *testing.T, h *Harness) {
+	ctx := testContext(t)
+	nurse, err := h.Tokens.Token("nurse-outage", []string{auth.RoleNurse}, []string{"team-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restricted, err := h.DialAlertsAs(ctx, nurse)
+	if err != nil {
+		t.Fatalf("dial alerts: %v", err)
+	}
+	defer restricted.Close()
+	admin, err := h.DialAlerts(ctx)
+	if err != nil {
+		t.Fatalf("dial alerts: %v", err)
+	}
+	defer admin.Close()
+
+	// every care team lookup of the nurse's filter now takes its full
+	// timeout; the broadcaster must not wait for either of them
+	h.AlertRepo.StallCareTeams(true)
+	defer h.AlertRepo.StallCareTeams(false)
+	patients := []string{"patient-e2e-23", "patient-e2e-24"}
+	start := time.Now()
+	for _, patientID := range patients {
+		err := h.PostTelemetry(ctx, Telemetry{PatientID: patientID, Type: "heart-rate", Value: 150, Unit: "bpm", Timestamp: time.Now().UTC().Truncate(time.Second)})
+		if err != nil {
+			t.Fatalf("post telemetry: %v", err)
+		}
+	}
+	for _, patientID := range patients {
+		if _, err := admin.Expect(5*time.Second, func(a *entities.Alert) bool { return a.PatientID == patientID }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 1500*time.Millisecond {
+		t.Fatalf("admin received both alerts after %s, held up by the nurse's lookups", elapsed)
+	}
+}
+
+func highHeartRateAlert(t *testing.T, h *Harness) {
+	ctx := testContext(t)
+	stream, err := h.DialAlerts(ctx)
+	if err != nil {
+		t.Fatalf("dial alerts: %v", err)
+	}
+	defer stream.Close()
+
+	err = h.PostTelemetry(ctx, Telemetry{
+		PatientID: "patient-e2e-1",
+		Type:      "heart-rate",
+		Value:     140,
+		Unit:      "bpm",
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+	})
+	if err != nil {
+		t.Fatalf("post telemetry: %v", err)
+	}
+
+	alert, err := stream.Expect(5*time.Second, func(a *entities.Alert) bool {
+		return a.PatientID == "patient-e2e-1" && strings.Contains(a.Type, "HighHeartRate")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alert.Source != entities.SourceRule || alert.RuleID != "heart-rate-max" || alert.Code != "heart-rate" ||
+		alert.Severity != entities.SeverityWarning || alert.Value != 140 || alert.Threshold != 100 {
+		t.Fatalf("alert lacks structured context: %+v", alert)
+	}
+
+	stored, err := h.AlertRepo.FetchByPatient(ctx, "patient-e2e-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range stored {
+		if a.ID == alert.ID {
+			return
+		}
+	}
+	t.Fatalf("alert %s was broadcast but not stored", alert.ID)
+}
+
+func normalHeartRateStored(t *testing.T, h *Harness) {
+	ctx := testContext(t)
+	err := h.PostTelemetry(ctx, Telemetry{
+		PatientID: "patient-e2e-2",
+		Type:      "heart-rate",
+		Value:     72,
+		Unit:      "bpm",
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+	})
+	if err != nil {
+		t.Fatalf("post telemetry: %v", err)
+	}
+
+	// ingest and processing both write the observation
+	if err := waitFor(5*time.Second, func() bool { return len(h.ObservationRepo.Records()) >= 2 }); err != nil {
+		t.Fatalf("observation not stored by both services: %v", err)
+	}
+	for _, a := range h.AlertRepo.Alerts() {
+		if a.PatientID == "patient-e2e-2" && strings.Contains(a.Type, "HighHeartRate") {
+			t.Fatalf("unexpected threshold alert %s", a.ID)
+		}
+	}
+}
+
+func careTeamScoping(t *testing.T, h *Harness) {
+	ctx := testContext(t)
+	h.AlertRepo.AssignCareTeam("patient-e2e-3", "team-a")
+	h.AlertRepo.AssignCareTeam("patient-e2e-4", "team-b")
+
+	nurse, err := h.Tokens.Token("nurse-a", []string{auth.RoleNurse}, []string{"team-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := h.Tokens.Token("device-1", []string{auth.RoleDevice}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h.DialAlertsAs(ctx, device); err == nil {
+		t.Fatal("device token opened the alert stream")
+	}
+	stream, err := h.DialAlertsAs(ctx, nurse)
+	if err != nil {
+		t.Fatalf("dial alerts: %v", err)
+	}
+	defer stream.Close()
+
+	// the other team's alert is raised first so a leak would arrive first
+	for _, patientID := range []string{"patient-e2e-4", "patient-e2e-3"} {
+		err := h.PostTelemetry(ctx, Telemetry{
+			PatientID: patientID,
+			Type:      "heart-rate",
+			Value:     150,
+			Unit:      "bpm",
+			Timestamp: time.Now().UTC().Truncate(time.Second),
+		})
+		if err != nil {
+			t.Fatalf("post telemetry: %v", err)
+		}
+	}
+	alert, err := stream.Expect(5*time.Second, func(a *entities.Alert) bool {
+		return a.PatientID == "patient-e2e-3" || a.PatientID == "patient-e2e-4"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alert.PatientID != "patient-e2e-3" {
+		t.Fatalf("nurse of team-a received alert for %s", alert.PatientID)
+	}
+
+	checks := []struct {
+		path, token string
+		want        int
+	}{
+		{"/patients/patient-e2e-3/alerts", nurse, http.StatusOK},
+		{"/patients/patient-e2e-4/alerts", nurse, http.StatusForbidden},
+		{"/patients/patient-e2e-4/observations", nurse, http.StatusForbidden},
+		{"/patients/patient-e2e-3/alerts", "", http.StatusUnauthorized},
+		{"/patients/patient-e2e-3/alerts", device, http.StatusForbidden},
+		{"/patients/patient-e2e-4/alerts", h.AdminToken, http.StatusOK},
+	}
+	for _, c := range checks {
+		status, err := h.Get(ctx, c.path, c.token, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != c.want {
+			t.Fatalf("GET %s returned %d, want %d", c.path, status, c.want)
+		}
+	}
+
+	// cross-patient listing only counts the nurse's patients
+	if err := waitFor(5*time.Second, func() bool { return len(h.AlertRepo.Alerts()) >= 2 }); err != nil {
+		t.Fatalf("alerts not stored: %v", err)
+	}
+
+	// a patient's alerts are a plain array unless paging is asked for
+	var all []entities.Alert
+	if _, err := h.Get(ctx, "/patients/patient-e2e-3/alerts", nurse, &all); err != nil {
+		t.Fatalf("patient alerts are not an array: %v", err)
+	}
+	var first repository.AlertPage
+	if _, err := h.Get(ctx, "/patients/patient-e2e-3/alerts?limit=1", nurse, &first); err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || len(first.Alerts) != 1 || first.Total != 1 || all[0].ID != first.Alerts[0].ID {
+		t.Fatalf("patient alerts %+v and first page %+v differ", all, first)
+	}
+
+	var page repository.AlertPage
+	if _, err := h.Get(ctx, "/alerts?resolved=false", nurse, &page); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range page.Alerts {
+		if a.PatientID != "patient-e2e-3" {
+			t.Fatalf("/alerts returned alert for %s to team-a", a.PatientID)
+		}
+	}
+	if page.Total != 1 {
+		t.Fatalf("/alerts total = %d, want 1", page.Total)
+	}
+}
+
+func deviceAuthentication(t *testing.T, h *Harness) {
+	ctx := testContext(t)
+	telemetry := func(patientID, deviceID string) []byte {
+		body, _ := json.Marshal(Telemetry{
+			PatientID: patientID,
+			Type:      "heart-rate",
+			Value:     72,
+			Unit:      "bpm",
+			DeviceID:  deviceID,
+			Timestamp: time.Now().UTC().Truncate(time.Second),
+		})
+		return body
+	}
+	keyed := func(key string) http.Header {
+		return http.Header{auth.HeaderDeviceKey: {key}}
+	}
+	signed := func(body []byte, ts time.Time, nonce string) http.Header {
+		header := keyed(h.DeviceKeys[SignedDevice])
+		stamp := fmt.Sprint(ts.Unix())
+		header.Set(auth.HeaderSignatureTimestamp, stamp)
+		header.Set(auth.HeaderSignatureNonce, nonce)
+		header.Set(auth.HeaderSignature, auth.SignPayload(h.SigningSecret, stamp, nonce, body))
+		return header
+	}
+
+	monitorKey := h.DeviceKeys[MonitorDevice]
+	signedBody := telemetry(DevicePatient, "")
+	checks := []struct {
+		name   string
+		body   []byte
+		header http.Header
+		want   int
+	}{
+		{"no credentials", telemetry(DevicePatient, ""), nil, http.StatusUnauthorized},
+		{"unknown key", telemetry(DevicePatient, ""), keyed("rpmdev_unknown"), http.StatusUnauthorized},
+		{"retired key", telemetry(DevicePatient, ""), keyed(h.RetiredKey), http.StatusUnauthorized},
+		{"current key", telemetry(DevicePatient, ""), keyed(monitorKey), http.StatusAccepted},
+		{"other patient", telemetry("patient-e2e-6", ""), keyed(monitorKey), http.StatusForbidden},
+		{"other device id", telemetry(DevicePatient, GatewayDevice), keyed(monitorKey), http.StatusForbidden},
+		{"unsigned payload", telemetry(DevicePatient, ""), keyed(h.DeviceKeys[SignedDevice]), http.StatusUnauthorized},
+		{"stale signature", signedBody, signed(signedBody, time.Now().Add(-time.Hour), "n-0"), http.StatusUnauthorized},
+		{"tampered payload", telemetry(DevicePatient, SignedDevice), signed(signedBody, time.Now(), "n-1"), http.StatusUnauthorized},
+		{"signed payload", signedBody, signed(signedBody, time.Now(), "n-2"), http.StatusAccepted},
+		{"replayed nonce", signedBody, signed(signedBody, time.Now(), "n-2"), http.StatusUnauthorized},
+	}
+	for _, c := range checks {
+		status, err := h.PostObservation(ctx, c.body, c.header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != c.want {
+			t.Fatalf("%s: ingest returned %d, want %d", c.name, status, c.want)
+		}
+	}
+
+	// accepted observations carry the authenticated device
+	if err := waitFor(5*time.Second, func() bool {
+		seen := map[string]bool{}
+		for _, o := range h.ObservationRepo.Records() {
+			if o.PatientID == DevicePatient {
+				seen[o.DeviceID] = true
+			}
+		}
+		return seen[MonitorDevice] && seen[SignedDevice]
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func auditTrail(t *testing.T, h *Harness) {
+	ctx := testContext(t)
+	h.AlertRepo.AssignCareTeam("patient-e2e-7", "team-c")
+	nurse, err := h.Tokens.Token("nurse-c", []string{auth.RoleNurse}, []string{"team-c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = h.PostTelemetry(ctx, Telemetry{
+		PatientID: "patient-e2e-7",
+		Type:      "heart-rate",
+		Value:     80,
+		Unit:      "bpm",
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+	})
+	if err != nil {
+		t.Fatalf("post telemetry: %v", err)
+	}
+	for _, c := range []struct {
+		path, token string
+		want        int
+	}{
+		{"/patients/patient-e2e-7/observations?code=heart-rate", nurse, http.StatusOK},
+		{"/patients/patient-e2e-8/alerts", nurse, http.StatusForbidden},
+		{"/patients/patient-e2e-7/alerts", "", http.StatusUnauthorized},
+		// query tokens are only accepted by the alert streams
+		{"/patients/patient-e2e-7/alerts?access_token=" + nurse, "", http.StatusUnauthorized},
+		{"/admin/audit", nurse, http.StatusForbidden},
+	} {
+		status, err := h.Get(ctx, c.path, c.token, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != c.want {
+			t.Fatalf("GET %s returned %d, want %d", c.path, status, c.want)
+		}
+	}
+
+	want := []struct{ actor, action, patient, outcome string }{
+		{GatewayDevice, entities.AuditWrite, "patient-e2e-7", entities.OutcomeSuccess},
+		{"nurse-c", entities.AuditRead, "patient-e2e-7", entities.OutcomeSuccess},
+		{"nurse-c", entities.AuditRead, "patient-e2e-8", entities.OutcomeDenied},
+		{"anonymous", entities.AuditRead, "patient-e2e-7", entities.OutcomeDenied},
+	}
+	var page repository.AuditPage
+	if _, err := h.Get(ctx, "/admin/audit?limit=500", h.AdminToken, &page); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range want {
+		found := false
+		for _, e := range page.Events {
+			if e.Actor == w.actor && e.Action == w.action && e.PatientID == w.patient && e.Outcome == w.outcome {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("no audit event %+v", w)
+		}
+	}
+	for _, e := range page.Events {
+		if strings.Contains(e.Query, "access_token=e") {
+			t.Fatalf("audit event %d recorded a token", e.Seq)
+		}
+	}
+
+	var verification repository.AuditVerification
+	if _, err := h.Get(ctx, "/admin/audit/verify", h.AdminToken, &verification); err != nil {
+		t.Fatal(err)
+	}
+	if !verification.Valid || verification.Events < int64(len(want)) {
+		t.Fatalf("audit chain verification: %+v", verification)
+	}
+}
+
+func alertSubscriptions(t *testing.T, h *Harness) {
+	ctx := testContext(t)
+	const ward3Patient, icuPatient = "patient-e2e-9", "patient-e2e-10"
+	h.AlertRepo.SavePatient(entities.Patient{ID: ward3Patient, Ward: "ward-3"})
+	h.AlertRepo.SavePatient(entities.Patient{ID: icuPatient, Ward: "icu"})
+	ours := func(a *entities.Alert) bool { return a.PatientID == ward3Patient || a.PatientID == icuPatient }
+
+	ward, err := h.OpenAlertStream(ctx, h.AdminToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ward.Close()
+	if err := ward.Subscribe("ward-3", ws.Subscription{Wards: []string{"ward-3"}}); err != nil {
+		t.Fatal(err)
+	}
+	critical, err := h.OpenAlertStream(ctx, h.AdminToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer critical.Close()
+	if err := critical.Subscribe("bed", ws.Subscription{MinSeverity: "urgent"}); err == nil {
+		t.Fatal("unknown min_severity was accepted")
+	}
+	if err := critical.Subscribe("bed", ws.Subscription{PatientIDs: []string{icuPatient}, MinSeverity: entities.SeverityCritical}); err != nil {
+		t.Fatal(err)
+	}
+	silent, err := h.OpenAlertStream(ctx, h.AdminToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	// unwanted alerts are raised first so a leak would arrive first
+	post := func(patientID, code string, value float64) error {
+		return h.PostTelemetry(ctx, Telemetry{
+			PatientID: patientID,
+			Type:      code,
+			Value:     value,
+			Unit:      "x",
+			Timestamp: time.Now().UTC().Truncate(time.Second),
+		})
+	}
+	if err := post(icuPatient, "heart-rate", 150); err != nil {
+		t.Fatal(err)
+	}
+	if err := post(ward3Patient, "heart-rate", 150); err != nil {
+		t.Fatal(err)
+	}
+	if err := post(icuPatient, "spo2", 80); err != nil {
+		t.Fatal(err)
+	}
+
+	alert, err := ward.Expect(5*time.Second, ours)
+	if err != nil {
+		t.Fatalf("ward subscription: %v", err)
+	}
+	if alert.PatientID != ward3Patient {
+		t.Fatalf("ward-3 subscription received alert for %s", alert.PatientID)
+	}
+	alert, err = critical.Expect(5*time.Second, ours)
+	if err != nil {
+		t.Fatalf("critical subscription: %v", err)
+	}
+	if alert.PatientID != icuPatient || alert.Severity != entities.SeverityCritical {
+		t.Fatalf("critical subscription received %s alert for %s", alert.Severity, alert.PatientID)
+	}
+
+	// after unsubscribing nothing more arrives
+	if err := ward.Unsubscribe("ward-3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := post(ward3Patient, "spo2", 80); err != nil {
+		t.Fatal(err)
+	}
+	if err := ward.ExpectNone(500*time.Millisecond, ours); err != nil {
+		t.Fatalf("after unsubscribe: %v", err)
+	}
+	if err := silent.ExpectNone(100*time.Millisecond, ours); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func liveVitals(t *testing.T, h *Harness) {
+	ctx := testContext(t)
+	const bedPatient, otherPatient = "patient-e2e-11", "patient-e2e-12"
+	h.AlertRepo.SavePatient(entities.Patient{ID: bedPatient, Ward: "ward-5"})
+	h.AlertRepo.AssignCareTeam(bedPatient, "team-c")
+	nurse, err := h.Tokens.Token("nurse-c", []string{auth.RoleNurse}, []string{"team-c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vitals := []string{ws.StreamVitals}
+	is := func(patientID, code string) func(ws.Vital) bool {
+		return func(v ws.Vital) bool { return v.PatientID == patientID && v.Code == code }
+	}
+
+	bed, err := h.OpenAlertStream(ctx, h.AdminToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bed.Close()
+	if err := bed.Subscribe("bed", ws.Subscription{PatientIDs: []string{bedPatient}, Streams: vitals}); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot, err := bed.Snapshot(5*time.Second, "bed"); err != nil {
+		t.Fatal(err)
+	} else if len(snapshot) != 0 {
+		t.Fatalf("snapshot before any observation has %d vitals", len(snapshot))
+	}
+
+	// the nurse may only read bedPatient; the ward subscription is limited
+	// to one spo2 sample every two seconds
+	team, err := h.OpenAlertStream(ctx, nurse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer team.Close()
+	if err := team.Subscribe("hr", ws.Subscription{PatientIDs: []string{otherPatient, bedPatient}, Streams: vitals, Codes: []string{"heart-rate"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := team.Subscribe("bed", ws.Subscription{Streams: []string{"waveforms"}}); err == nil {
+		t.Fatal("unknown stream was accepted")
+	}
+	ward, err := h.OpenAlertStream(ctx, h.AdminToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ward.Close()
+	if err := ward.Subscribe("ward-5", ws.Subscription{Wards: []string{"ward-5"}, Streams: vitals, Codes: []string{"spo2"}, MaxRate: 0.5}); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(patientID, code string, value float64) error {
+		return h.PostTelemetry(ctx, Telemetry{
+			PatientID: patientID,
+			Type:      code,
+			Value:     value,
+			Unit:      "x",
+			Timestamp: time.Now().UTC().Truncate(time.Second),
+		})
+	}
+	if err := post(otherPatient, "heart-rate", 70); err != nil {
+		t.Fatal(err)
+	}
+	if err := post(bedPatient, "heart-rate", 72); err != nil {
+		t.Fatal(err)
+	}
+	for _, spo2 := range []float64{97, 96, 95} {
+		if err := post(bedPatient, "spo2", spo2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := bed.ExpectVital(5*time.Second, is(bedPatient, "heart-rate")); err != nil {
+		t.Fatalf("bed subscription: %v", err)
+	}
+	if _, err := bed.ExpectVital(5*time.Second, func(v ws.Vital) bool { return is(bedPatient, "spo2")(v) && v.Value == 95 }); err != nil {
+		t.Fatalf("bed subscription: %v", err)
+	}
+	v, err := team.ExpectVital(5*time.Second, func(v ws.Vital) bool { return v.Code == "heart-rate" })
+	if err != nil {
+		t.Fatalf("care team subscription: %v", err)
+	}
+	if v.PatientID != bedPatient {
+		t.Fatalf("nurse of team-c received vitals for %s", v.PatientID)
+	}
+	v, err = ward.ExpectVital(5*time.Second, is(bedPatient, "spo2"))
+	if err != nil {
+		t.Fatalf("ward subscription: %v", err)
+	}
+	if v.Value != 97 {
+		t.Fatalf("decimated subscription started at spo2 %v, want 97", v.Value)
+	}
+
+	// a late subscriber starts from the latest values
+	late, err := h.OpenAlertStream(ctx, h.AdminToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer late.Close()
+	if err := late.Subscribe("bed", ws.Subscription{PatientIDs: []string{bedPatient}, Streams: vitals}); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := late.Snapshot(5*time.Second, "bed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot) != 2 || snapshot[0].Code != "heart-rate" || snapshot[0].Value != 72 || snapshot[1].Code != "spo2" || snapshot[1].Value != 95 {
+		t.Fatalf("snapshot = %+v, want heart-rate 72 and spo2 95", snapshot)
+	}
+
+	if err := ward.ExpectNoVital(500*time.Millisecond, is(bedPatient, "spo2")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func alertReplay(t *testing.T, h *Harness) {
+	ctx := testContext(t)
+	const patientID = "patient-e2e-13"
+	ours := func(a *entities.Alert) bool { return a.PatientID == patientID }
+	post := func(code string, value float64) error {
+		return h.PostTelemetry(ctx, Telemetry{
+			PatientID: patientID,
+			Type:      code,
+			Value:     value,
+			Unit:      "x",
+			Timestamp: time.Now().UTC().Truncate(time.Second),
+		})
+	}
+	stored := func() []entities.Alert {
+		var out []entities.Alert
+		for _, a := range h.AlertRepo.Alerts() {
+			if ours(&a) {
+				out = append(out, a)
+			}
+		}
+		return out
+	}
+
+	first, err := h.DialAlerts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := post("heart-rate", 150); err != nil {
+		t.Fatal(err)
+	}
+	seen, err := first.Expect(5*time.Second, ours)
+	first.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen.Seq == 0 {
+		t.Fatal("live alert carries no seq")
+	}
+
+	// alerts raised while disconnected
+	if err := post("spo2", 80); err != nil {
+		t.Fatal(err)
+	}
+	if err := post("heart-rate", 155); err != nil {
+		t.Fatal(err)
+	}
+	var missed []entities.Alert
+	if err := waitFor(5*time.Second, func() bool {
+		missed = nil
+		for _, a := range stored() {
+			if a.Seq > seen.Seq {
+				missed = append(missed, a)
+			}
+		}
+		return len(missed) >= 2
+	}); err != nil {
+		t.Fatalf("missed alerts were not stored: %v", err)
+	}
+
+	stream, err := h.OpenAlertStream(ctx, h.AdminToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if err := stream.SubscribeSince("bed", ws.Subscription{}, -1); err == nil {
+		t.Fatal("negative since was accepted")
+	}
+	if err := stream.SubscribeSince("bed", ws.Subscription{PatientIDs: []string{patientID}}, seen.Seq); err != nil {
+		t.Fatal(err)
+	}
+	end, err := stream.Replayed(5*time.Second, "bed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end.More || end.Seq < missed[len(missed)-1].Seq {
+		t.Fatalf("replay ended at seq %d (more=%v), want %d", end.Seq, end.More, missed[len(missed)-1].Seq)
+	}
+	// the replay overlaps what the first connection saw; those repeats
+	// are dropped by ID as clients do
+	delivered := make(map[string]bool)
+	for _, want := range missed {
+		got, err := stream.Expect(time.Second, func(a *entities.Alert) bool { return ours(a) && a.ID != seen.ID })
+		if err != nil {
+			t.Fatalf("replay: %v", err)
+		}
+		if got.ID != want.ID {
+			t.Fatalf("replayed %s (seq %d), want %s (seq %d)", got.ID, got.Seq, want.ID, want.Seq)
+		}
+		delivered[got.ID] = true
+	}
+
+	// then live delivery resumes, without repeating replayed alerts
+	if err := post("spo2", 79); err != nil {
+		t.Fatal(err)
+	}
+	live, err := stream.Expect(5*time.Second, ours)
+	if err != nil {
+		t.Fatalf("after replay: %v", err)
+	}
+	if delivered[live.ID] || live.Seq <= end.Seq {
+		t.Fatalf("alert %s (seq %d) was delivered again", live.ID, live.Seq)
+	}
+	if err := stream.ExpectNone(300*time.Millisecond, func(a *entities.Alert) bool { return delivered[a.ID] }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func eventStream(t *testing.T, h *Harness) {
+	ctx := testContext(t)
+	const patientID, otherID = "patient-e2e-14", "patient-e2e-15"
+	ours := func(a *entities.Alert) bool { return a.PatientID == patientID }
+	post := func(patientID, code string, value float64) error {
+		return h.PostTelemetry(ctx, Telemetry{
+			PatientID: patientID,
+			Type:      code,
+			Value:     value,
+			Unit:      "x",
+			Timestamp: time.Now().UTC().Truncate(time.Second),
+		})
+	}
+	query := url.Values{"patient_ids": {patientID}}
+
+	if _, status, err := h.OpenEventStream(ctx, "", query, ""); status != http.StatusUnauthorized {
+		t.Fatalf("anonymous event stream: status %d (%v), want 401", status, err)
+	}
+	if _, status, err := h.OpenEventStream(ctx, h.AdminToken, url.Values{"streams": {"bogus"}}, ""); status != http.StatusBadRequest {
+		t.Fatalf("unknown stream: status %d (%v), want 400", status, err)
+	}
+
+	stream, _, err := h.OpenEventStream(ctx, h.AdminToken, query, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := post(otherID, "heart-rate", 150); err != nil {
+		stream.Close()
+		t.Fatal(err)
+	}
+	if err := post(patientID, "heart-rate", 150); err != nil {
+		stream.Close()
+		t.Fatal(err)
+	}
+	first, err := stream.Expect(5*time.Second, func(a *entities.Alert) bool { return true })
+	if err != nil {
+		stream.Close()
+		t.Fatal(err)
+	}
+	if !ours(first) {
+		stream.Close()
+		t.Fatalf("stream for %s carried an alert for %s", patientID, first.PatientID)
+	}
+	if stream.LastEventID != fmt.Sprint(first.Seq) {
+		stream.Close()
+		t.Fatalf("alert seq %d sent with event ID %q", first.Seq, stream.LastEventID)
+	}
+	if err := stream.Heartbeat(3 * HeartbeatInterval); err != nil {
+		stream.Close()
+		t.Fatal(err)
+	}
+	lastEventID := stream.LastEventID
+	stream.Close()
+
+	// an alert raised while disconnected is replayed on reconnect
+	if err := post(patientID, "spo2", 80); err != nil {
+		t.Fatal(err)
+	}
+	var missed entities.Alert
+	if err := waitFor(5*time.Second, func() bool {
+		for _, a := range h.AlertRepo.Alerts() {
+			if ours(&a) && a.Seq > first.Seq {
+				missed = a
+				return true
+			}
+		}
+		return false
+	}); err != nil {
+		t.Fatalf("missed alert was not stored: %v", err)
+	}
+
+	resumed, _, err := h.OpenEventStream(ctx, h.AdminToken, query, lastEventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Close()
+	// alerts up to Last-Event-ID may be repeated by the replay overlap
+	got, err := resumed.Expect(5*time.Second, func(a *entities.Alert) bool { return a.Seq > first.Seq })
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if got.ID != missed.ID {
+		t.Fatalf("resumed with %s (seq %d), want %s (seq %d)", got.ID, got.Seq, missed.ID, missed.Seq)
+	}
+	end, err := resumed.Replayed(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end.Seq < missed.Seq {
+		t.Fatalf("replay ended at seq %d, want %d", end.Seq, missed.Seq)
+	}
+	if err := resumed.ExpectNone(300*time.Millisecond, func(a *entities.Alert) bool { return a.ID == first.ID }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func replicaFanOut(t *testing.T, h *Harness) {
+	ctx := testContext(t)
+	const patientID = "patient-e2e-16"
+	ours := func(a *entities.Alert) bool { return a.PatientID == patientID }
+	second, err := h.StartReplica("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := h.StartReplica("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := ws.Subscription{PatientIDs: []string{patientID}, Streams: []string{ws.StreamAlerts, ws.StreamVitals}}
+	var streams []*AlertStream
+	defer func() {
+		for _, s := range streams {
+			s.Close()
+		}
+	}()
+	for _, r := range []*APIReplica{h.Replicas[0], second} {
+		s, err := r.OpenAlertStream(ctx, h.AdminToken)
+		if err != nil {
+			t.Fatalf("replica %s: %v", r.ID, err)
+		}
+		streams = append(streams, s)
+		if err := s.Subscribe("bed", sub); err != nil {
+			t.Fatalf("replica %s: %v", r.ID, err)
+		}
+	}
+	events, _, err := third.OpenEventStream(ctx, h.AdminToken, url.Values{"patient_ids": {patientID}}, "")
+	if err != nil {
+		t.Fatalf("replica %s: %v", third.ID, err)
+	}
+	defer events.Close()
+
+	if err := h.PostTelemetry(ctx, Telemetry{
+		PatientID: patientID,
+		Type:      "heart-rate",
+		Value:     150,
+		Unit:      "bpm",
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var alertID string
+	for i, s := range streams {
+		id := h.Replicas[i].ID
+		alert, err := s.Expect(5*time.Second, ours)
+		if err != nil {
+			t.Fatalf("replica %s: %v", id, err)
+		}
+		if alertID == "" {
+			alertID = alert.ID
+		} else if alert.ID != alertID {
+			t.Fatalf("replica %s delivered %s, want %s", id, alert.ID, alertID)
+		}
+		if _, err := s.ExpectVital(5*time.Second, func(v ws.Vital) bool { return v.PatientID == patientID }); err != nil {
+			t.Fatalf("replica %s: %v", id, err)
+		}
+		if err := s.ExpectNone(200*time.Millisecond, ours); err != nil {
+			t.Fatalf("replica %s: %v", id, err)
+		}
+	}
+	alert, err := events.Expect(5*time.Second, ours)
+	if err != nil {
+		t.Fatalf("replica %s: %v", third.ID, err)
+	}
+	if alert.ID != alertID {
+		t.Fatalf("replica %s delivered %s, want %s", third.ID, alert.ID, alertID)
+	}
+}
+
+func alertNotifications(t *testing.T, h *Harness) {
+	ctx := testContext(t)
+	// the SMS provider is down for two attempts, and the notification store
+	// rejects the first alert once, so it is only notified when redelivered
+	h.SMS.FailNext(http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	h.Deliveries.FailEnqueue(errors.New("database is unavailable"))
+	for _, v := range []struct {
+		code  string
+		value float64
+		unit  string
+	}{{"spo2", 85, "%"}, {"heart-rate", 150, "bpm"}} {
+		if err := h.PostTelemetry(ctx, Telemetry{
+			PatientID: NotifyPatient,
+			Type:      v.code,
+			Value:     v.value,
+			Unit:      v.unit,
+			Timestamp: time.Now().UTC().Truncate(time.Second),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// two emails, an SMS and a page for the critical alert and a webhook
+	// for each alert
+	settled := func() bool {
+		ds := h.Deliveries.Deliveries()
+		for _, d := range ds {
+			if d.Status == entities.DeliveryPending {
+				return false
+			}
+		}
+		return len(ds) == 6
+	}
+	if err := waitFor(5*time.Second+repository.RedeliveryDelay(1), settled); err != nil {
+		t.Fatalf("deliveries did not settle: %+v", h.Deliveries.Deliveries())
+	}
+
+	alerts, err := h.AlertRepo.FetchByPatient(ctx, NotifyPatient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var critical, warning *entities.Alert
+	for i := range alerts {
+		switch alerts[i].Severity {
+		case entities.SeverityCritical:
+			critical = &alerts[i]
+		case entities.SeverityWarning:
+			warning = &alerts[i]
+		}
+	}
+	if critical == nil || warning == nil {
+		t.Fatalf("want a critical and a warning alert, got %+v", alerts)
+	}
+
+	byID := make(map[string]entities.NotificationDelivery)
+	for _, d := range h.Deliveries.Deliveries() {
+		byID[d.ID] = d
+	}
+	for _, want := range []struct {
+		alert     *entities.Alert
+		channel   string
+		recipient string
+		status    string
+		attempts  int
+	}{
+		{critical, entities.ChannelEmail, OnCallEmail, entities.DeliverySent, 1},
+		{critical, entities.ChannelEmail, RejectedEmail, entities.DeliveryFailed, 1},
+		{critical, entities.ChannelSMS, OnCallPhone, entities.DeliverySent, 3},
+		{critical, entities.ChannelPager, PagerRoutingKey, entities.DeliverySent, 1},
+		{critical, entities.ChannelWebhook, h.Webhooks.URL + "/hooks/alerts", entities.DeliverySent, 1},
+		{warning, entities.ChannelWebhook, h.Webhooks.URL + "/hooks/alerts", entities.DeliverySent, 1},
+	} {
+		d, ok := byID[entities.DeliveryID(want.alert.ID, want.channel, want.recipient)]
+		if !ok {
+			t.Fatalf("no %s delivery of %s to %s", want.channel, want.alert.ID, want.recipient)
+		}
+		if d.Status != want.status || d.Attempts != want.attempts {
+			t.Fatalf("%s delivery to %s is %s after %d attempts, want %s after %d (last error %q)",
+				d.Channel, d.Recipient, d.Status, d.Attempts, want.status, want.attempts, d.LastError)
+		}
+	}
+
+	mails := h.SMTP.Messages()
+	if len(mails) != 1 || len(mails[0].To) != 1 || mails[0].To[0] != OnCallEmail {
+		t.Fatalf("want one email to %s, got %+v", OnCallEmail, mails)
+	}
+	subject := "Subject: [CRITICAL] LowSpO2 for patient " + NotifyPatient
+	if !strings.Contains(mails[0].Data, subject) {
+		t.Fatalf("email lacks %q:\n%s", subject, mails[0].Data)
+	}
+
+	// retries of one delivery share its idempotency key
+	texts := h.SMS.Requests()
+	smsID := entities.DeliveryID(critical.ID, entities.ChannelSMS, OnCallPhone)
+	if len(texts) != 3 {
+		t.Fatalf("SMS provider received %d requests, want 3", len(texts))
+	}
+	for _, r := range texts {
+		if key := r.Header.Get("Idempotency-Key"); key != smsID {
+			t.Fatalf("SMS idempotency key %q, want %q", key, smsID)
+		}
+	}
+
+	hooks := h.Webhooks.Requests()
+	if len(hooks) != 2 || hooks[0].Header.Get("Idempotency-Key") == hooks[1].Header.Get("Idempotency-Key") {
+		t.Fatalf("want two webhooks with distinct idempotency keys, got %d", len(hooks))
+	}
+	for _, r := range hooks {
+		var event struct {
+			Event string          `json:"event"`
+			Alert *entities.Alert `json:"alert"`
+		}
+		if err := json.Unmarshal(r.Body, &event); err != nil || event.Event != "alert.raised" || event.Alert == nil || event.Alert.PatientID != NotifyPatient {
+			t.Fatalf("unexpected webhook body %s", r.Body)
+		}
+	}
+
+	pages := h.Pager.Requests()
+	if len(pages) != 1 {
+		t.Fatalf("pager received %d events, want 1", len(pages))
+	}
+	var page struct {
+		RoutingKey string `json:"routing_key"`
+		DedupKey   string `json:"dedup_key"`
+	}
+	if err := json.Unmarshal(pages[0].Body, &page); err != nil || page.RoutingKey != PagerRoutingKey || page.DedupKey != critical.ID {
+		t.Fatalf("unexpected pager event %s", pages[0].Body)
+	}
+
+	// a redelivered alert is not notified again
+	if err := h.Bus.Publisher(AlertTopic).PublishAlert(ctx, critical); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * NotifyBackoff)
+	if n := len(h.Deliveries.Deliveries()); n != 6 {
+		t.Fatalf("redelivered alert added deliveries: %d, want 6", n)
+	}
+	if n := len(h.SMTP.Messages()) + len(h.SMS.Requests()) + len(h.Webhooks.Requests()) + len(h.Pager.Requests()); n != 7 {
+		t.Fatalf("redelivered alert was sent again: %d requests, want 7", n)
+	}
+}
+
+func alertEscalation(t *testing.T, h *Harness) {
+	ctx := testContext(t)
+	const ignored, acknowledged = "patient-e2e-18", "patient-e2e-19"
+	h.AlertRepo.SavePatient(entities.Patient{ID: ignored, Ward: EscalationWard})
+	h.AlertRepo.SavePatient(entities.Patient{ID: acknowledged, Ward: EscalationWard})
+	h.AlertRepo.AssignCareTeam(acknowledged, "team-e")
+	nurse, err := h.Tokens.Token("nurse-e", []string{auth.RoleNurse}, []string{"team-e"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a critical alert for each patient; the warning does not escalate
+	for _, tel := range []Telemetry{
+		{PatientID: ignored, Type: "spo2", Value: 85, Unit: "%"},
+		{PatientID: ignored, Type: "heart-rate", Value: 150, Unit: "bpm"},
+		{PatientID: acknowledged, Type: "spo2", Value: 85, Unit: "%"},
+	} {
+		tel.Timestamp = time.Now().UTC().Truncate(time.Second)
+		if err := h.PostTelemetry(ctx, tel); err != nil {
+			t.Fatal(err)
+		}
+	}
+	critical := make(map[string]*entities.Alert)
+	var warning *entities.Alert
+	if err := waitFor(5*time.Second, func() bool {
+		for _, a := range h.AlertRepo.Alerts() {
+			switch {
+			case a.Severity == entities.SeverityCritical:
+				critical[a.PatientID] = &a
+			case a.PatientID == ignored:
+				warning = &a
+			}
+		}
+		return len(critical) == 2 && warning != nil
+	}); err != nil {
+		t.Fatalf("alerts were not raised: %v", err)
+	}
+
+	delivered := func(alertID, recipient string) *entities.NotificationDelivery {
+		for _, d := range h.Deliveries.Deliveries() {
+			if d.AlertID == alertID && d.Recipient == recipient && d.Status == entities.DeliverySent {
+				return &d
+			}
+		}
+		return nil
+	}
+	// the nurse on duty is told first and acknowledges one alert before it
+	// escalates
+	if err := waitFor(EscalationWait, func() bool { return delivered(critical[acknowledged].ID, OnDutyNurse) != nil }); err != nil {
+		t.Fatalf("primary nurse was not notified: %v", err)
+	}
+	for _, c := range []struct {
+		alertID, token string
+		want           int
+	}{
+		{"alert-missing", nurse, http.StatusNotFound},
+		{critical[ignored].ID, nurse, http.StatusForbidden},
+		{critical[acknowledged].ID, "", http.StatusUnauthorized},
+		{critical[acknowledged].ID, nurse, http.StatusOK},
+	} {
+		status, err := h.Post(ctx, "/alerts/"+c.alertID+"/acknowledge", c.token, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != c.want {
+			t.Fatalf("acknowledging %s returned %d, want %d", c.alertID, status, c.want)
+		}
+	}
+	// acknowledging again keeps the first acknowledgement
+	var acked entities.Alert
+	if _, err := h.Post(ctx, "/alerts/"+critical[acknowledged].ID+"/acknowledge", h.AdminToken, &acked); err != nil {
+		t.Fatal(err)
+	}
+	if !acked.Acknowledged || acked.AcknowledgedBy != "nurse-e" || acked.AcknowledgedAt == nil {
+		t.Fatalf("acknowledgement not kept: %+v", acked)
+	}
+
+	escalation := func(alertID string) *entities.Escalation {
+		e, _ := h.Escalations.FetchByAlert(ctx, alertID)
+		return e
+	}
+	if err := waitFor(5*time.Second, func() bool {
+		e1, e2 := escalation(critical[ignored].ID), escalation(critical[acknowledged].ID)
+		return e1 != nil && e1.Status == entities.EscalationExhausted && e2 != nil && e2.Status == entities.EscalationAcknowledged
+	}); err != nil {
+		t.Fatalf("escalations did not finish: %+v, %+v", escalation(critical[ignored].ID), escalation(critical[acknowledged].ID))
+	}
+	if e := escalation(warning.ID); e != nil {
+		t.Fatalf("warning alert was escalated: %+v", e)
+	}
+
+	// the ignored alert went up the chain, one wait apart
+	if err := waitFor(5*time.Second, func() bool { return delivered(critical[ignored].ID, PhysicianPager) != nil }); err != nil {
+		t.Fatalf("physician was not paged: %v", err)
+	}
+	var previous *entities.NotificationDelivery
+	for _, recipient := range []string{OnDutyNurse, ChargeNurse, PhysicianPager} {
+		d := delivered(critical[ignored].ID, recipient)
+		if d == nil {
+			t.Fatalf("%s was not notified of the ignored alert", recipient)
+		}
+		if previous != nil && d.CreatedAt.Sub(previous.CreatedAt) < EscalationWait {
+			t.Fatalf("%s was notified %s after %s, before the wait", recipient, d.CreatedAt.Sub(previous.CreatedAt), previous.Recipient)
+		}
+		previous = d
+	}
+	for _, d := range h.Deliveries.Deliveries() {
+		switch {
+		case d.Recipient == OffDutyNurse:
+			t.Fatal("off-duty nurse was notified")
+		case d.AlertID == critical[acknowledged].ID && d.Recipient != OnDutyNurse:
+			t.Fatalf("acknowledged alert escalated to %s", d.Recipient)
+		}
+	}
+	subject := "Subject: [ESCALATED] [CRITICAL] LowSpO2 for patient " + ignored
+	for _, m := range h.SMTP.Messages() {
+		if len(m.To) == 1 && m.To[0] == ChargeNurse && !strings.Contains(m.Data, subject) {
+			t.Fatalf("charge nurse email lacks %q:\n%s", subject, m.Data)
+		}
+	}
+
+	var page repository.AuditPage
+	if _, err := h.Get(ctx, "/admin/audit?patient_id="+acknowledged+"&action=write", h.AdminToken, &page); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range page.Events {
+		if e.Actor == "nurse-e" && strings.HasSuffix(e.Resource, "/acknowledge") && e.Outcome == entities.OutcomeSuccess {
+			return
+		}
+	}
+	t.Fatalf("acknowledgement was not audited: %+v", page.Events)
+}
+
+func routedEscalation(t *testing.T, h *Harness) {
+	ctx := testContext(t)
+	h.AlertRepo.SavePatient(entities.Patient{ID: WardRoutePatient, Ward: EscalationWard})
+	if err := h.PostTelemetry(ctx, Telemetry{
+		PatientID: WardRoutePatient,
+		Type:      "spo2",
+		Value:     85,
+		Unit:      "%",
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the on-duty nurse gets the routed notification at once and the
+	// escalation as the first step, as two deliveries
+	sent := func() []entities.NotificationDelivery {
+		var out []entities.NotificationDelivery
+		for _, d := range h.Deliveries.Deliveries() {
+			if d.PatientID == WardRoutePatient && d.Recipient == OnDutyNurse && d.Status == entities.DeliverySent {
+				out = append(out, d)
+			}
+		}
+		return out
+	}
+	if err := waitFor(5*time.Second, func() bool { return len(sent()) == 2 }); err != nil {
+		t.Fatalf("want a routed and an escalated delivery to %s, got %+v", OnDutyNurse, sent())
+	}
+	ds := sent()
+	routes := map[string]bool{ds[0].Route: true, ds[1].Route: true}
+	if ds[0].AlertID != ds[1].AlertID || !routes["ward-email"] || !routes["critical-unacknowledged/primary_nurse"] {
+		t.Fatalf("unexpected deliveries to %s: %+v", OnDutyNurse, ds)
+	}
+
+	var mails int
+	for _, m := range h.SMTP.Messages() {
+		if len(m.To) == 1 && m.To[0] == OnDutyNurse && strings.Contains(m.Data, "for patient "+WardRoutePatient) {
+			mails++
+		}
+	}
+	if mails != 2 {
+		t.Fatalf("%s received %d emails, want 2", OnDutyNurse, mails)
+	}
+
+	// resolving the alert ends its escalation and its open state
+	var resolved entities.Alert
+	if _, err := h.Post(ctx, "/alerts/"+ds[0].AlertID+"/resolve", h.AdminToken, &resolved); err != nil {
+		t.Fatal(err)
+	}
+	if !resolved.Resolved || resolved.ResolvedBy != "e2e-admin" || resolved.ResolvedAt == nil {
+		t.Fatalf("resolution not recorded: %+v", resolved)
+	}
+	if err := waitFor(5*time.Second, func() bool {
+		e, _ := h.Escalations.FetchByAlert(ctx, resolved.ID)
+		return e != nil && e.Status == entities.EscalationResolved
+	}); err != nil {
+		t.Fatalf("escalation of the resolved alert did not stop: %v", err)
+	}
+	for state, want := range map[string]int64{"false": 0, "true": 1} {
+		var page repository.AlertPage
+		if _, err := h.Get(ctx, "/alerts?patient_id="+WardRoutePatient+"&resolved="+state, h.AdminToken, &page); err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != want {
+			t.Fatalf("/alerts?resolved=%s total = %d, want %d", state, page.Total, want)
+		}
+	}
+}
+
+func webhookSubscriptions(t *testing.T, h *Harness) {
+	ctx := testContext(t)
+	const subscribed, unsubscribed = "patient-e2e-20", "patient-e2e-21"
+	h.AlertRepo.SavePatient(entities.Patient{ID: subscribed, Ward: EscalationWard})
+	nurse, err := h.Tokens.Token("nurse-w", []string{auth.RoleNurse}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only admins manage subscriptions, and only valid ones
+	for _, c := range []struct {
+		token string
+		body  map[string]interface{}
+		want  int
+	}{
+		{nurse, map[string]interface{}{"url": h.EHR.URL}, http.StatusForbidden},
+		{h.AdminToken, map[string]interface{}{"url": "ftp://ehr.test"}, http.StatusBadRequest},
+		{h.AdminToken, map[string]interface{}{"url": h.EHR.URL, "event_types": []string{"alert.deleted"}}, http.StatusBadRequest},
+		{h.AdminToken, map[string]interface{}{"url": h.EHR.URL, "min_severity": "urgent"}, http.StatusBadRequest},
+	} {
+		status, err := h.Send(ctx, http.MethodPost, "/admin/webhooks", c.token, c.body, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != c.want {
+			t.Fatalf("creating webhook %v returned %d, want %d", c.body, status, c.want)
+		}
+	}
+
+	// the EHR takes every critical event of one patient; the broken
+	// receiver takes alerts raised in the escalation ward
+	type created struct {
+		entities.WebhookSubscription
+		Secret string `json:"secret"`
+	}
+	var ehr, broken created
+	for _, c := range []struct {
+		body map[string]interface{}
+		out  *created
+	}{
+		{map[string]interface{}{"url": h.EHR.URL + "/rpm", "patient_ids": []string{subscribed}, "min_severity": entities.SeverityCritical}, &ehr},
+		{map[string]interface{}{"url": h.BrokenEHR.URL + "/rpm", "wards": []string{EscalationWard}, "event_types": []string{entities.EventAlertRaised}}, &broken},
+	} {
+		status, err := h.Send(ctx, http.MethodPost, "/admin/webhooks", h.AdminToken, c.body, c.out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != http.StatusCreated || !strings.HasPrefix(c.out.Secret, "whsec_") {
+			t.Fatalf("creating webhook returned %d with secret %q", status, c.out.Secret)
+		}
+	}
+	var shown map[string]interface{}
+	if _, err := h.Get(ctx, "/admin/webhooks/"+ehr.ID, h.AdminToken, &shown); err != nil {
+		t.Fatal(err)
+	}
+	if _, leaked := shown["secret"]; leaked || shown["id"] != ehr.ID {
+		t.Fatalf("unexpected subscription %v", shown)
+	}
+
+	h.EHR.FailNext(http.StatusInternalServerError)
+	failures := make([]int, WebhookAttempts)
+	for i := range failures {
+		failures[i] = http.StatusServiceUnavailable
+	}
+	h.BrokenEHR.FailNext(failures...)
+	for _, patient := range []string{subscribed, unsubscribed} {
+		if err := h.PostTelemetry(ctx, Telemetry{PatientID: patient, Type: "spo2", Value: 85, Unit: "%", Timestamp: time.Now().UTC().Truncate(time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deliveries := func(subID, status string) []entities.WebhookDelivery {
+		var page repository.WebhookDeliveryPage
+		h.Get(ctx, "/admin/webhooks/"+subID+"/deliveries?status="+status, h.AdminToken, &page)
+		return page.Deliveries
+	}
+	// the alert was raised and escalated to the nurse on duty; one attempt
+	// failed and was retried
+	if err := waitFor(5*time.Second, func() bool { return len(deliveries(ehr.ID, entities.WebhookDelivered)) == 2 }); err != nil {
+		t.Fatalf("EHR deliveries did not settle: %+v", deliveries(ehr.ID, ""))
+	}
+	var alert *entities.Alert
+	for _, a := range h.AlertRepo.Alerts() {
+		if a.PatientID == subscribed {
+			alert = &a
+		}
+	}
+	if alert == nil {
+		t.Fatalf("no alert for %s", subscribed)
+	}
+	// an acknowledgement whose event cannot be queued fails, and
+	// acknowledging again queues it
+	h.WebhookStore.FailEnqueue(errors.New("database unavailable"))
+	if status, err := h.Post(ctx, "/alerts/"+alert.ID+"/acknowledge", h.AdminToken, nil); err != nil || status != http.StatusInternalServerError {
+		t.Fatalf("acknowledging %s with the webhook store down returned %d: %v", alert.ID, status, err)
+	}
+	for range 2 {
+		if status, err := h.Post(ctx, "/alerts/"+alert.ID+"/acknowledge", h.AdminToken, nil); err != nil || status != http.StatusOK {
+			t.Fatalf("acknowledging %s returned %d: %v", alert.ID, status, err)
+		}
+	}
+	if err := waitFor(5*time.Second, func() bool { return len(deliveries(ehr.ID, entities.WebhookDelivered)) == 3 }); err != nil {
+		t.Fatalf("acknowledgement was not delivered: %+v", deliveries(ehr.ID, ""))
+	}
+	// a resolution is published once too, even without a new acknowledgement
+	for range 2 {
+		if status, err := h.Post(ctx, "/alerts/"+alert.ID+"/resolve", h.AdminToken, nil); err != nil || status != http.StatusOK {
+			t.Fatalf("resolving %s returned %d: %v", alert.ID, status, err)
+		}
+	}
+	if err := waitFor(5*time.Second, func() bool { return len(deliveries(ehr.ID, entities.WebhookDelivered)) == 4 }); err != nil {
+		t.Fatalf("resolution was not delivered: %+v", deliveries(ehr.ID, ""))
+	}
+
+	// every request is signed, and a retry repeats its idempotency key
+	requests := h.EHR.Requests()
+	if len(requests) != 5 {
+		t.Fatalf("EHR received %d requests, want 5", len(requests))
+	}
+	keys := make(map[string]int)
+	events := make(map[string]int)
+	for _, r := range requests {
+		key := r.Header.Get(webhook.HeaderIdempotencyKey)
+		err := webhook.Verify(ehr.Secret, r.Header.Get(webhook.HeaderSignatureTimestamp), key, r.Header.Get(webhook.HeaderSignature), r.Body, time.Now(), time.Minute)
+		if err != nil {
+			t.Fatalf("request %s: %v", key, err)
+		}
+		if webhook.Verify(broken.Secret, r.Header.Get(webhook.HeaderSignatureTimestamp), key, r.Header.Get(webhook.HeaderSignature), r.Body, time.Now(), time.Minute) == nil {
+			t.Fatalf("request %s verifies with another subscription's secret", key)
+		}
+		var event entities.WebhookEvent
+		if err := json.Unmarshal(r.Body, &event); err != nil || event.Data.Alert == nil || event.Data.Alert.ID != alert.ID || event.Type != r.Header.Get(webhook.HeaderEvent) {
+			t.Fatalf("unexpected webhook %s: %s", r.Header.Get(webhook.HeaderEvent), r.Body)
+		}
+		if event.Type == entities.EventAlertEscalated && (event.Data.Role != "primary_nurse" || event.Data.Step != 1) {
+			t.Fatalf("unexpected escalation event %s", r.Body)
+		}
+		keys[key]++
+		events[event.Type]++
+	}
+	if len(keys) != 4 || events[entities.EventAlertRaised]+events[entities.EventAlertEscalated] != 3 || events[entities.EventAlertAcknowledged] != 1 || events[entities.EventAlertResolved] != 1 {
+		t.Fatalf("want 4 deliveries of raised, escalated, acknowledged and resolved, one retried, got keys %v and events %v", keys, events)
+	}
+
+	// the log pages newest first
+	var first, second repository.WebhookDeliveryPage
+	if _, err := h.Get(ctx, "/admin/webhooks/"+ehr.ID+"/deliveries?limit=2", h.AdminToken, &first); err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Deliveries) != 2 || first.NextCursor == "" || first.Deliveries[0].EventType != entities.EventAlertResolved || first.Deliveries[1].EventType != entities.EventAlertAcknowledged {
+		t.Fatalf("unexpected first log page %+v", first)
+	}
+	if _, err := h.Get(ctx, "/admin/webhooks/"+ehr.ID+"/deliveries?limit=2&cursor="+first.NextCursor, h.AdminToken, &second); err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Deliveries) != 2 || second.NextCursor != "" {
+		t.Fatalf("unexpected second log page %+v", second)
+	}
+	attempts := 0
+	for _, d := range append(first.Deliveries, second.Deliveries...) {
+		attempts += d.Attempts
+	}
+	if attempts != 5 {
+		t.Fatalf("log counts %d attempts, want 5", attempts)
+	}
+	if status, _ := h.Get(ctx, "/admin/webhooks/"+ehr.ID+"/deliveries?status=lost", h.AdminToken, nil); status != http.StatusBadRequest {
+		t.Fatalf("bad status filter returned %d, want 400", status)
+	}
+
+	// the broken receiver dead-letters its only delivery, which is sent
+	// again once redelivered
+	if err := waitFor(5*time.Second, func() bool { return len(deliveries(broken.ID, entities.WebhookDead)) == 1 }); err != nil {
+		t.Fatalf("broken receiver's delivery was not dead-lettered: %+v", deliveries(broken.ID, ""))
+	}
+	dead := deliveries(broken.ID, entities.WebhookDead)[0]
+	if dead.Attempts != WebhookAttempts || dead.ResponseStatus != http.StatusServiceUnavailable || dead.EventType != entities.EventAlertRaised || dead.AlertID != alert.ID {
+		t.Fatalf("unexpected dead delivery %+v", dead)
+	}
+	if all := deliveries(broken.ID, ""); len(all) != 1 {
+		t.Fatalf("broken receiver has %d deliveries, want 1", len(all))
+	}
+	status, err := h.Send(ctx, http.MethodPost, "/admin/webhooks/"+broken.ID+"/deliveries/"+dead.ID+"/redeliver", h.AdminToken, nil, nil)
+	if err != nil || status != http.StatusAccepted {
+		t.Fatalf("redelivering returned %d: %v", status, err)
+	}
+	if err := waitFor(5*time.Second, func() bool { return len(deliveries(broken.ID, entities.WebhookDelivered)) == 1 }); err != nil {
+		t.Fatalf("redelivery did not succeed: %+v", deliveries(broken.ID, ""))
+	}
+
+	// deleting keeps the log
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		if status, err := h.Send(ctx, http.MethodDelete, "/admin/webhooks/"+ehr.ID, h.AdminToken, nil, nil); err != nil || status != want {
+			t.Fatalf("deleting webhook returned %d, want %d: %v", status, want, err)
+		}
+	}
+	if status, _ := h.Get(ctx, "/admin/webhooks/"+ehr.ID, h.AdminToken, nil); status != http.StatusNotFound {
+		t.Fatalf("deleted webhook returned %d, want 404", status)
+	}
+	if n := len(deliveries(ehr.ID, "")); n != 4 {
+		t.Fatalf("deleted webhook's log has %d deliveries, want 4", n)
+	}
+}
+
+func waitFor(timeout time.Duration, cond func() bool) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return nil
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return fmt.Errorf("condition not met within %s", timeout)
+}
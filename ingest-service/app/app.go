@@ -0,0 +1,38 @@
+// Package app wires the ingest service from its repository dependencies so
+// it can be run by cmd or embedded in another process.
+package app
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lioarce01/remote-patient-monitoring-system/ingest-service/internal/application"
+	httpHandler "github.com/lioarce01/remote-patient-monitoring-system/ingest-service/internal/infrastructure/http"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+)
+
+// NewRouter builds the ingest HTTP API, including the healthcheck. devices
+// and auditLog are required; use auth.AllowAllDevices() to accept anonymous
+// telemetry.
+func NewRouter(pub repository.Publisher, obsRepo repository.ObservationRepository, devices auth.DeviceAuthenticator, auditLog repository.AuditRepository) *gin.Engine {
+	if devices == nil || auditLog == nil {
+		log.Fatal("ingest must be given a device authenticator and an audit log")
+	}
+	ingestService := application.NewIngestService(pub, obsRepo)
+	ingestHandler := httpHandler.NewIngestHandler(ingestService)
+
+	router := gin.Default()
+
+	// register routes
+	// audit wraps authentication so rejected devices are recorded too
+	ingestHandler.RegisterRoutes(router.Group("/", httpHandler.Audit(auditLog), httpHandler.AuthenticateDevice(devices)))
+
+	// healthcheck
+	router.GET("/health", func(c *gin.Context) {
+		c.String(http.StatusOK, "OK")
+	})
+
+	return router
+}
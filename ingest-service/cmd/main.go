@@ -1,58 +1,93 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
 
-	httpHandler "github.com/lioarce01/remote-patient-monitoring-system/ingest-service/internal/infrastructure/http"
-
-	"github.com/gin-gonic/gin"
-	"github.com/lioarce01/remote-patient-monitoring-system/ingest-service/internal/application"
+	"github.com/lioarce01/remote-patient-monitoring-system/ingest-service/app"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/broker"
 	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db"
-	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/kafka"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/lifecycle"
 )
 
 func main() {
+	// "device-key" prints a new device API key and its registry digest
+	if len(os.Args) > 1 && os.Args[1] == "device-key" {
+		key, hash, err := auth.NewDeviceKey()
+		if err != nil {
+			log.Fatalf("device-key: %v", err)
+		}
+		fmt.Printf("key:    %s\nsha256: %s\n", key, hash)
+		return
+	}
+
 	// environment config
-	brokers := strings.Split(os.Getenv("KAFKA_BROKERS"), ",")
+	brokerCfg := broker.ConfigFromEnv()
 	obsTopic := os.Getenv("OBS_TOPIC")
-	influxAddr := os.Getenv("INFLUX_ADDR")
-	influxDB := os.Getenv("INFLUX_DB")
-	influxUser := os.Getenv("INFLUX_USER")
-	influxPass := os.Getenv("INFLUX_PASS")
+	obsCfg := db.ObservationConfigFromEnv()
 	ingestPort := os.Getenv("INGEST_PORT")
 	if ingestPort == "" {
 		ingestPort = "8081"
 		log.Printf("INGEST_PORT not set, defaulting to %s", ingestPort)
 	}
+	shutdown := lifecycle.NewDeadline(lifecycle.ShutdownTimeout())
+	deviceCfg := auth.DeviceConfigFromEnv()
+
+	// the audit log and the signature nonces every replica shares live in
+	// the alerts database
+	alertsDB, err := db.NewPostgresRepo(os.Getenv("POSTGRES_CONN"))
+	if err != nil {
+		log.Fatalf("cannot initialize alerts database: %v", err)
+	}
+	deviceCfg.Nonces = alertsDB.Nonces()
 
-	// initialize influxdb repo
-	obsRepo, err := db.NewInfluxRepo(influxAddr, influxDB, influxUser, influxPass)
+	// device credentials come from the registry file
+	devices, err := auth.NewDeviceAuthenticator(deviceCfg)
+	if err != nil {
+		log.Fatalf("cannot initialize device authentication: %v", err)
+	}
+	if deviceCfg.Mode == auth.DeviceAuthOff {
+		log.Printf("WARNING: DEVICE_AUTH=off, ingest accepts telemetry from anyone")
+	}
+	tlsCfg, err := deviceCfg.TLSConfig()
 	if err != nil {
-		log.Fatalf("cannot initialize InfluxDB repo: %v", err)
+		log.Fatalf("cannot initialize TLS: %v", err)
 	}
 
-	// initialize kafka publisher
-	pub := kafka.NewKafkaPublisher(brokers, obsTopic)
+	// initialize observation store
+	obsRepo, err := db.NewObservationStore(obsCfg, true)
+	if err != nil {
+		log.Fatalf("cannot initialize observation store: %v", err)
+	}
 
-	// initialize ingest service & http handler
-	ingestService := application.NewIngestService(pub, obsRepo)
-	ingestHandler := httpHandler.NewIngestHandler(ingestService)
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
 
-	router := gin.Default()
+	// initialize observation publisher
+	pub, err := broker.NewPublisher(ctx, brokerCfg, obsTopic)
+	if err != nil {
+		log.Fatalf("cannot initialize publisher: %v", err)
+	}
 
-	// register routes
-	ingestHandler.RegisterRoutes(router)
+	// initialize ingest service & http handler
+	router := app.NewRouter(pub, obsRepo, devices, alertsDB.AuditLog())
 
-	// healthcheck
-	router.GET("/health", func(c *gin.Context) {
-		c.String(http.StatusOK, "OK")
-	})
+	srv := &http.Server{Addr: ":" + ingestPort, Handler: router, TLSConfig: tlsCfg}
 
 	log.Printf("Ingest service listening on: %s", ingestPort)
-	if err := router.Run(":" + ingestPort); err != nil {
-		log.Fatal(err)
+	if err := lifecycle.Serve(ctx, srv, shutdown); err != nil {
+		log.Printf("ingest server error: %v", err)
 	}
+
+	// in-flight requests are drained, flush what they produced
+	lifecycle.Close("publisher", pub)
+	lifecycle.Close("observation store", obsRepo)
+	lifecycle.Close("Postgres pool", alertsDB)
+	log.Println("ingest service stopped")
 }
@@ -16,7 +16,7 @@ func NewNormalizer() *Normalizer {
 func (n *Normalizer) FromTelemetry(input TelemetryInput) *entities.Observation {
 	log.Printf("[Normalizer] Creating observation of type: %s with value: %f", input.Type, input.Value)
 
-	return &entities.Observation{
+	obs := &entities.Observation{
 		ResourceType:      "Observation",
 		Status:            "Final",
 		Code:              entities.Code{Text: input.Type},
@@ -27,4 +27,8 @@ func (n *Normalizer) FromTelemetry(input TelemetryInput) *entities.Observation {
 			Unit:  input.Unit,
 		},
 	}
+	if input.DeviceID != "" {
+		obs.Device = &entities.Device{Reference: input.DeviceID}
+	}
+	return obs
 }
@@ -18,6 +18,7 @@ type TelemetryInput struct {
 	Type      string    `json:"type"`
 	Value     float64   `json:"value"`
 	Unit      string    `json:"unit"`
+	DeviceID  string    `json:"device_id,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
 }
 
@@ -71,15 +72,7 @@ func (svc *IngestService) Execute(ctx context.Context, input TelemetryInput) (er
 		return fmt.Errorf("conversion error: %w", err)
 	}
 
-	obsFHIR := entities.Observation{
-		ID:                record.ID,
-		ResourceType:      record.ResourceType,
-		Status:            record.Status,
-		Code:              entities.Code{Text: record.CodeText},
-		Subject:           entities.Subject{Reference: record.PatientID},
-		EffectiveDateTime: record.EffectiveDateTime.Format(time.RFC3339),
-		ValueQuantity:     entities.ValueQuantity{Value: record.Value, Unit: record.Unit},
-	}
+	obsFHIR := entities.ToObservation(record)
 
 	// serialize and publish FHIR observation
 	payload, err := json.Marshal(obsFHIR)
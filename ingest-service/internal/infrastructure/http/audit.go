@@ -0,0 +1,35 @@
+package http
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/audit"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+)
+
+// auditPatientKey is where handlers leave the patient a request wrote to
+const auditPatientKey = "audit.patient_id"
+
+// Audit records every request as a write by the authenticated device once
+// it has been served. It must run before AuthenticateDevice so rejected
+// devices are recorded too.
+func Audit(repo repository.AuditRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		var p *auth.Principal
+		if d := auth.DeviceFromContext(c.Request.Context()); d != nil {
+			p = &auth.Principal{Subject: d.ID, Roles: []string{auth.RoleDevice}}
+			if d.ID == "" {
+				p.Subject = audit.Anonymous
+			}
+		}
+		e := audit.Event(c.Request, p, c.Writer.Status(), start)
+		e.ClientIP = c.ClientIP()
+		e.PatientID = c.GetString(auditPatientKey)
+		audit.Record(c.Request.Context(), repo, e)
+	}
+}
@@ -0,0 +1,44 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+)
+
+// maxBodyBytes bounds telemetry payloads, which are read in full to check
+// signatures
+const maxBodyBytes = 1 << 20
+
+// AuthenticateDevice identifies the sending device and stores it in the
+// request context. The body is buffered and restored for the handler.
+func AuthenticateDevice(a auth.DeviceAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "payload too large"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		d, err := a.AuthenticateDevice(c.Request, body)
+		if errors.Is(err, auth.ErrUnauthenticated) {
+			log.Printf("[AuthenticateDevice] rejected %s: %v", c.ClientIP(), err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "device authentication required"})
+			return
+		}
+		if err != nil {
+			// e.g. the nonce store is unreachable; the device should retry
+			log.Printf("[AuthenticateDevice] %v", err)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "device authentication unavailable"})
+			return
+		}
+		c.Request = c.Request.WithContext(auth.WithDevice(c.Request.Context(), d))
+		c.Next()
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/lioarce01/remote-patient-monitoring-system/ingest-service/internal/application"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
 )
 
 type IngestHandler struct {
@@ -15,7 +16,8 @@ func NewIngestHandler(svc *application.IngestService) *IngestHandler {
 	return &IngestHandler{Service: svc}
 }
 
-func (h *IngestHandler) RegisterRoutes(r *gin.Engine) {
+// RegisterRoutes expects r to run AuthenticateDevice
+func (h *IngestHandler) RegisterRoutes(r *gin.RouterGroup) {
 	r.POST("/observations", h.postObservation)
 }
 
@@ -25,6 +27,23 @@ func (h *IngestHandler) postObservation(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+
+	c.Set(auditPatientKey, input.PatientID)
+
+	// a device only reports for its own patients and under its own ID
+	d := auth.DeviceFromContext(c.Request.Context())
+	if d == nil || !d.CanReport(input.PatientID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "device may not report for this patient"})
+		return
+	}
+	if d.ID != "" {
+		if input.DeviceID != "" && input.DeviceID != d.ID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "device_id does not match the authenticated device"})
+			return
+		}
+		input.DeviceID = d.ID
+	}
+
 	if err := h.Service.Execute(c.Request.Context(), input); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,79 @@
+// Package app wires the notification service from its repository
+// dependencies so it can be run by cmd or embedded in another process.
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/notification-service/internal/application"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/notify"
+)
+
+// Config, Route, RetryPolicy, Rotation, Contact, EscalationPolicy,
+// EscalationStep and Duration describe the routing file; Stores holds the
+// notifier's repositories
+type (
+	Config           = application.Config
+	Route            = application.Route
+	RetryPolicy      = application.RetryPolicy
+	Rotation         = application.Rotation
+	Contact          = application.Contact
+	EscalationPolicy = application.EscalationPolicy
+	EscalationStep   = application.EscalationStep
+	Duration         = application.Duration
+	Stores           = application.Stores
+)
+
+// LoadConfig reads a routing file
+func LoadConfig(path string) (Config, error) {
+	return application.LoadConfig(path)
+}
+
+type Notifier struct {
+	service *application.NotificationService
+}
+
+// NewNotifier builds the alert notifier. channels holds the channels routes
+// and on-call staff may use, keyed by entities.Channel* names.
+func NewNotifier(stores Stores, channels map[string]notify.Channel, cfg Config) (*Notifier, error) {
+	svc, err := application.NewNotificationService(stores, channels, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Notifier{service: svc}, nil
+}
+
+// Run consumes alerts, sends notifications and escalates unacknowledged
+// alerts until ctx is cancelled. The alert and the attempts in flight when
+// ctx is cancelled are allowed to finish.
+func (n *Notifier) Run(ctx context.Context, consumer repository.Subscriber) error {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		n.service.Dispatch(ctx)
+	}()
+	defer wg.Wait()
+
+	workCtx := context.WithoutCancel(ctx)
+	return consumer.Consume(ctx, func(key, msg []byte) error {
+		var alert entities.Alert
+		if err := json.Unmarshal(msg, &alert); err != nil {
+			log.Printf("invalid alert message: %v", err)
+			return nil
+		}
+		// a failed alert is redelivered rather than committed, so a storage
+		// outage delays notifications instead of losing them; HandleAlert is
+		// idempotent, so the parts that did succeed are not repeated
+		if err := n.service.HandleAlert(workCtx, &alert); err != nil {
+			return fmt.Errorf("error notifying alert %s: %w", alert.ID, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lioarce01/remote-patient-monitoring-system/notification-service/app"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/broker"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/lifecycle"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/notify"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/webhook"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func main() {
+	conn := os.Getenv("POSTGRES_CONN")
+
+	// "migrate ..." manages the Postgres schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := db.Migrate(context.Background(), conn, os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	brokerCfg := broker.ConfigFromEnv()
+	alertTopic := os.Getenv("ALERT_TOPIC")
+	groupID := os.Getenv("GROUP_ID")
+	configPath := os.Getenv("NOTIFY_CONFIG")
+	port := os.Getenv("NOTIFY_PORT")
+	if port == "" {
+		port = "9091"
+	}
+	shutdown := lifecycle.NewDeadline(lifecycle.ShutdownTimeout())
+
+	if configPath == "" {
+		log.Fatal("NOTIFY_CONFIG must name the notification routing file")
+	}
+	cfg, err := app.LoadConfig(configPath)
+	if err != nil {
+		log.Fatalf("cannot load notification config: %v", err)
+	}
+	channels, err := notify.ChannelsFromEnv()
+	if err != nil {
+		log.Fatalf("cannot initialize notification channels: %v", err)
+	}
+
+	store, err := db.NewPostgresRepo(conn)
+	if err != nil {
+		log.Fatalf("cannot initialize Postgres repo: %v", err)
+	}
+
+	notifier, err := app.NewNotifier(app.Stores{
+		Deliveries:  store.Notifications(),
+		Escalations: store.Escalations(),
+		Alerts:      store,
+		Patients:    store.Patients(),
+		CareTeams:   store,
+		Webhooks:    store.Webhooks(),
+	}, channels, cfg)
+	if err != nil {
+		log.Fatalf("cannot initialize notifier: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	// replicas share one group, so each alert is notified by one of them
+	consumer, err := broker.NewSubscriber(ctx, brokerCfg, alertTopic, groupID+"-notifications")
+	if err != nil {
+		log.Fatalf("cannot initialize alert subscriber: %v", err)
+	}
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		err := notifier.Run(ctx, consumer)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("alert consumer stopped: %v", err)
+		}
+	}()
+
+	// replicas share the delivery queue; each claim goes to one of them
+	sender := webhook.NewSender(store.Webhooks(), webhook.ConfigFromEnv())
+	senderDone := make(chan struct{})
+	go func() {
+		defer close(senderDone)
+		sender.Run(ctx)
+	}()
+
+	// healthcheck and metrics
+	r := gin.Default()
+	r.GET("/health", func(c *gin.Context) {
+		c.String(http.StatusOK, "OK")
+	})
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+
+	log.Printf("notification service listening on :%s", port)
+	if err := lifecycle.Serve(ctx, srv, shutdown); err != nil {
+		log.Printf("health server error: %v", err)
+		cancel()
+	}
+
+	if !lifecycle.Wait(consumerDone, shutdown.Remaining()) {
+		log.Printf("shutdown deadline exceeded, in-flight alert may be redelivered")
+	}
+	if !lifecycle.Wait(senderDone, shutdown.Remaining()) {
+		log.Printf("shutdown deadline exceeded, in-flight webhooks are retried once their claim lapses")
+	}
+
+	lifecycle.Close("alert subscriber", consumer)
+	lifecycle.Close("Postgres pool", store)
+	log.Println("notification service stopped")
+}
@@ -0,0 +1,256 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+// Config is the notification routing file
+type Config struct {
+	// Routes select recipients for alerts; an alert goes to every
+	// recipient of every route it matches
+	Routes []Route `json:"routes"`
+	// Retry overrides the retry policy of a channel
+	Retry map[string]RetryPolicy `json:"retry,omitempty"`
+	// Templates is a directory of <channel>.subject.tmpl and
+	// <channel>.body.tmpl files overriding the built-in templates
+	Templates string `json:"templates,omitempty"`
+	// PollInterval is how often due retries and escalations are looked for
+	PollInterval Duration `json:"poll_interval,omitempty"`
+	// OnCall holds each ward's rotations by role, e.g. "charge_nurse"
+	OnCall map[string]map[string]Rotation `json:"on_call,omitempty"`
+	// Escalations are tried in order; an alert follows the first that
+	// matches it until it is acknowledged
+	Escalations []EscalationPolicy `json:"escalations,omitempty"`
+}
+
+// Route sends alerts matching its filters to To over Channel. Empty
+// filters match every alert.
+type Route struct {
+	Name        string   `json:"name"`
+	Channel     string   `json:"channel"`
+	To          []string `json:"to"`
+	MinSeverity string   `json:"min_severity,omitempty"`
+	PatientIDs  []string `json:"patient_ids,omitempty"`
+	Wards       []string `json:"wards,omitempty"`
+	CareTeams   []string `json:"care_teams,omitempty"`
+}
+
+// Rotation hands a role to each of Staff in turn for one Shift, starting
+// with the first at Start
+type Rotation struct {
+	Start time.Time `json:"start"`
+	Shift Duration  `json:"shift"`
+	Staff []Contact `json:"staff"`
+}
+
+// Contact is a member of staff and how to reach them
+type Contact struct {
+	Name    string `json:"name"`
+	Channel string `json:"channel"`
+	To      string `json:"to"`
+}
+
+// OnDuty returns who holds the rotation at t
+func (r Rotation) OnDuty(t time.Time) Contact {
+	shift := time.Duration(r.Shift)
+	if len(r.Staff) == 1 || shift <= 0 {
+		return r.Staff[0]
+	}
+	elapsed := t.Sub(r.Start)
+	shifts := int64(elapsed / shift)
+	// shifts before Start count backwards from the last member
+	if elapsed < 0 && elapsed%shift != 0 {
+		shifts--
+	}
+	n := int64(len(r.Staff))
+	return r.Staff[(shifts%n+n)%n]
+}
+
+// EscalationPolicy walks alerts matching its filters through Steps until
+// they are acknowledged. Empty filters match every alert.
+type EscalationPolicy struct {
+	Name        string           `json:"name"`
+	MinSeverity string           `json:"min_severity,omitempty"`
+	Wards       []string         `json:"wards,omitempty"`
+	Steps       []EscalationStep `json:"steps"`
+}
+
+// EscalationStep notifies whoever is on call for Role in the patient's
+// ward, then waits Wait for an acknowledgement before the next step
+type EscalationStep struct {
+	Role string   `json:"role"`
+	Wait Duration `json:"wait,omitempty"`
+}
+
+// Policy returns the escalation policy called name
+func (c Config) Policy(name string) (EscalationPolicy, bool) {
+	for _, p := range c.Escalations {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return EscalationPolicy{}, false
+}
+
+// RetryPolicy retries a failed delivery after Backoff, doubling the wait
+// after every attempt up to MaxBackoff, and gives up after Attempts
+type RetryPolicy struct {
+	Attempts   int      `json:"attempts"`
+	Backoff    Duration `json:"backoff"`
+	MaxBackoff Duration `json:"max_backoff"`
+}
+
+// Duration is a time.Duration written as a Go duration string in JSON
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(raw []byte) error {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// defaultRetry is the retry policy of each channel. Pages and SMS are
+// retried sooner than email; webhook receivers get the longest to recover.
+var defaultRetry = map[string]RetryPolicy{
+	entities.ChannelEmail:   {Attempts: 5, Backoff: Duration(time.Minute), MaxBackoff: Duration(30 * time.Minute)},
+	entities.ChannelSMS:     {Attempts: 5, Backoff: Duration(30 * time.Second), MaxBackoff: Duration(10 * time.Minute)},
+	entities.ChannelWebhook: {Attempts: 8, Backoff: Duration(10 * time.Second), MaxBackoff: Duration(time.Hour)},
+	entities.ChannelPager:   {Attempts: 8, Backoff: Duration(10 * time.Second), MaxBackoff: Duration(10 * time.Minute)},
+}
+
+// defaultPollInterval is used when the config sets no PollInterval
+const defaultPollInterval = time.Second
+
+// LoadConfig reads the routing file at path
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("notification config: %w", err)
+	}
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return cfg, fmt.Errorf("notification config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// RetryFor returns the retry policy of channel, filling what the config
+// leaves unset from the channel's default
+func (c Config) RetryFor(channel string) RetryPolicy {
+	p := c.Retry[channel]
+	def, ok := defaultRetry[channel]
+	if !ok {
+		def = defaultRetry[entities.ChannelWebhook]
+	}
+	if p.Attempts <= 0 {
+		p.Attempts = def.Attempts
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = def.Backoff
+	}
+	if p.MaxBackoff < p.Backoff {
+		p.MaxBackoff = max(def.MaxBackoff, p.Backoff)
+	}
+	return p
+}
+
+// Delay is the wait before the attempt after attempt number attempts
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	d := time.Duration(p.Backoff)
+	for i := 1; i < attempts && d < time.Duration(p.MaxBackoff); i++ {
+		d *= 2
+	}
+	return min(d, time.Duration(p.MaxBackoff))
+}
+
+// validate checks the routes against the configured channels
+func (c Config) validate(channels map[string]bool) error {
+	names := make(map[string]bool)
+	for i, r := range c.Routes {
+		if r.Name == "" {
+			return fmt.Errorf("route %d has no name", i+1)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("route %s is defined twice", r.Name)
+		}
+		names[r.Name] = true
+		if !channels[r.Channel] {
+			return fmt.Errorf("route %s uses channel %q, which is not configured", r.Name, r.Channel)
+		}
+		if len(r.To) == 0 {
+			return fmt.Errorf("route %s has no recipients", r.Name)
+		}
+		if r.MinSeverity != "" && entities.SeverityRank(r.MinSeverity) == 0 {
+			return fmt.Errorf("route %s: min_severity must be info, warning or critical", r.Name)
+		}
+	}
+	for channel, p := range c.Retry {
+		if p.Attempts < 0 || p.Backoff < 0 || p.MaxBackoff < 0 {
+			return fmt.Errorf("retry policy of %s must not be negative", channel)
+		}
+	}
+	for ward, roles := range c.OnCall {
+		for role, r := range roles {
+			if len(r.Staff) == 0 {
+				return fmt.Errorf("on-call %s of %s has no staff", role, ward)
+			}
+			if len(r.Staff) > 1 && r.Shift <= 0 {
+				return fmt.Errorf("on-call %s of %s rotates without a shift length", role, ward)
+			}
+			for _, s := range r.Staff {
+				if !channels[s.Channel] {
+					return fmt.Errorf("on-call %s of %s reaches %s over channel %q, which is not configured", role, ward, s.Name, s.Channel)
+				}
+				if s.To == "" {
+					return fmt.Errorf("on-call %s of %s has no address for %s", role, ward, s.Name)
+				}
+			}
+		}
+	}
+	policies := make(map[string]bool)
+	for i, p := range c.Escalations {
+		if p.Name == "" {
+			return fmt.Errorf("escalation policy %d has no name", i+1)
+		}
+		if policies[p.Name] {
+			return fmt.Errorf("escalation policy %s is defined twice", p.Name)
+		}
+		policies[p.Name] = true
+		if len(p.Steps) == 0 {
+			return fmt.Errorf("escalation policy %s has no steps", p.Name)
+		}
+		if p.MinSeverity != "" && entities.SeverityRank(p.MinSeverity) == 0 {
+			return fmt.Errorf("escalation policy %s: min_severity must be info, warning or critical", p.Name)
+		}
+		for j, step := range p.Steps {
+			if step.Role == "" {
+				return fmt.Errorf("escalation policy %s: step %d has no role", p.Name, j+1)
+			}
+			if j < len(p.Steps)-1 && step.Wait <= 0 {
+				return fmt.Errorf("escalation policy %s: step %d must wait before the next step", p.Name, j+1)
+			}
+			for _, ward := range p.Wards {
+				if _, ok := c.OnCall[ward][step.Role]; !ok {
+					return fmt.Errorf("escalation policy %s: ward %s has no on-call %s", p.Name, ward, step.Role)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var escalationSteps = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "rpm_escalation_steps_total",
+	Help: "Escalation steps notified, by policy and on-call role.",
+}, []string{"policy", "role"})
+
+// startEscalation starts the first escalation policy alert matches. Its
+// first step is due at once.
+func (svc *NotificationService) startEscalation(ctx context.Context, alert *entities.Alert, patient func() patientInfo) error {
+	if alert.Acknowledged {
+		return nil
+	}
+	for _, p := range svc.cfg.Escalations {
+		if p.MinSeverity != "" && entities.SeverityRank(alert.Severity) < entities.SeverityRank(p.MinSeverity) {
+			continue
+		}
+		ward := patient().Ward
+		if len(p.Wards) > 0 && !contains(p.Wards, ward) {
+			continue
+		}
+		now := time.Now().UTC()
+		err := svc.escalations.Start(ctx, &entities.Escalation{
+			ID:        entities.EscalationID(alert.ID),
+			AlertID:   alert.ID,
+			PatientID: alert.PatientID,
+			Ward:      ward,
+			Policy:    p.Name,
+			Status:    entities.EscalationActive,
+			DueAt:     now,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to start escalation of alert %s: %w", alert.ID, err)
+		}
+		svc.wakeDispatch()
+		return nil
+	}
+	return nil
+}
+
+// escalateBatch advances one claimed batch of due escalations and reports
+// whether it was full
+func (svc *NotificationService) escalateBatch(ctx context.Context) bool {
+	if svc.escalations == nil || ctx.Err() != nil {
+		return false
+	}
+	claimed, err := svc.escalations.Claim(ctx, time.Now().UTC(), claimLease, claimBatch)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("[Notifier] claiming due escalations failed: %v", err)
+		}
+		return false
+	}
+	workCtx := context.WithoutCancel(ctx)
+	for i := range claimed {
+		svc.escalate(workCtx, &claimed[i])
+	}
+	return len(claimed) == claimBatch
+}
+
+// escalate stops e if its alert was acknowledged or resolved and otherwise
+// notifies its next step. Failures leave e claimed, so it is retried once
+// the claim lapses.
+func (svc *NotificationService) escalate(ctx context.Context, e *entities.Escalation) {
+	now := time.Now().UTC()
+	policy, ok := svc.cfg.Policy(e.Policy)
+	if !ok || e.Step >= len(policy.Steps) {
+		log.Printf("[Notifier] escalation of alert %s has no step %d in policy %q, stopping", e.AlertID, e.Step+1, e.Policy)
+		svc.finishEscalation(ctx, e, entities.EscalationExhausted, now)
+		return
+	}
+	alert, err := svc.alerts.FetchByID(ctx, e.AlertID)
+	if err != nil {
+		log.Printf("[Notifier] loading alert %s for escalation failed: %v", e.AlertID, err)
+		return
+	}
+	if alert == nil {
+		log.Printf("[Notifier] alert %s of escalation %s not found, stopping", e.AlertID, e.ID)
+		svc.finishEscalation(ctx, e, entities.EscalationExhausted, now)
+		return
+	}
+	if alert.Acknowledged {
+		svc.finishEscalation(ctx, e, entities.EscalationAcknowledged, now)
+		return
+	}
+	if alert.Resolved {
+		svc.finishEscalation(ctx, e, entities.EscalationResolved, now)
+		return
+	}
+
+	step := policy.Steps[e.Step]
+	wait := time.Duration(step.Wait)
+	if rotation, ok := svc.cfg.OnCall[e.Ward][step.Role]; ok {
+		contact := rotation.OnDuty(now)
+		subject, body, err := svc.templates.Render(contact.Channel, TemplateData{
+			Alert: alert, Ward: e.Ward, Route: policy.Name, Recipient: contact.To, Role: step.Role, Step: e.Step + 1,
+		})
+		if err != nil {
+			log.Printf("[Notifier] escalation of alert %s to %s: %v", e.AlertID, step.Role, err)
+			return
+		}
+		// keyed by escalation step rather than alert, so a route recipient
+		// who is also on call still gets the escalation
+		d := entities.NotificationDelivery{
+			ID:            entities.DeliveryID(e.ID+"/"+strconv.Itoa(e.Step), contact.Channel, contact.To),
+			AlertID:       alert.ID,
+			PatientID:     alert.PatientID,
+			Severity:      alert.Severity,
+			Route:         policy.Name + "/" + step.Role,
+			Channel:       contact.Channel,
+			Recipient:     contact.To,
+			Subject:       subject,
+			Body:          body,
+			Status:        entities.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if err := svc.store.Enqueue(ctx, []entities.NotificationDelivery{d}); err != nil {
+			log.Printf("[Notifier] escalation of alert %s to %s failed: %v", e.AlertID, step.Role, err)
+			return
+		}
+		escalationSteps.WithLabelValues(policy.Name, step.Role).Inc()
+		log.Printf("[Notifier] alert %s escalated to %s %s (step %d of %s)", e.AlertID, step.Role, contact.Name, e.Step+1, policy.Name)
+		svc.wakeDispatch()
+		if err := svc.publish(ctx, webhook.Event{Type: entities.EventAlertEscalated, Alert: alert, Role: step.Role, Step: e.Step + 1}); err != nil {
+			log.Printf("[Notifier] %v", err)
+		}
+	} else {
+		// nobody to wait for; the next step is due at once
+		log.Printf("[Notifier] ward %q has no on-call %s, skipping step %d of %s for alert %s", e.Ward, step.Role, e.Step+1, policy.Name, e.AlertID)
+		wait = 0
+	}
+
+	e.Step++
+	if e.Step == len(policy.Steps) {
+		svc.finishEscalation(ctx, e, entities.EscalationExhausted, now)
+		return
+	}
+	e.DueAt = now.Add(wait)
+	e.UpdatedAt = now
+	if err := svc.escalations.Update(ctx, e); err != nil {
+		log.Printf("[Notifier] storing escalation %s failed: %v", e.ID, err)
+	}
+}
+
+func (svc *NotificationService) finishEscalation(ctx context.Context, e *entities.Escalation, status string, now time.Time) {
+	e.Status = status
+	e.UpdatedAt = now
+	if err := svc.escalations.Update(ctx, e); err != nil {
+		log.Printf("[Notifier] storing escalation %s failed: %v", e.ID, err)
+	}
+}
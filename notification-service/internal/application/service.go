@@ -0,0 +1,326 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/notify"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// claimBatch is how many due deliveries one claim takes; they are sent
+	// concurrently
+	claimBatch = 16
+	// sendTimeout bounds one delivery attempt
+	sendTimeout = 30 * time.Second
+	// claimLease keeps a claimed delivery from other notifiers until its
+	// attempt has surely ended
+	claimLease = 2 * sendTimeout
+)
+
+var attempts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "rpm_notification_attempts_total",
+	Help: "Notification delivery attempts, by channel and outcome (sent, retry, failed).",
+}, []string{"channel", "outcome"})
+
+// Stores are the repositories of the notification service. Deliveries is
+// required, and so are Escalations and Alerts when the config has
+// escalation policies. Patients and CareTeams resolve ward and care team
+// filters and may be nil when no route or policy uses them. Webhooks, when
+// set, receives alert.raised and alert.escalated events for webhook
+// subscriptions.
+type Stores struct {
+	Deliveries  repository.NotificationRepository
+	Escalations repository.EscalationRepository
+	Alerts      repository.AlertRepository
+	Patients    repository.PatientRepository
+	CareTeams   repository.CareTeamRepository
+	Webhooks    repository.WebhookRepository
+}
+
+// NotificationService turns alerts into deliveries and sends them. Alerts
+// only enqueue deliveries and start escalations; Dispatch sends whatever is
+// due, first attempts, retries and escalation steps alike, so pending work
+// survives restarts.
+type NotificationService struct {
+	store       repository.NotificationRepository
+	escalations repository.EscalationRepository
+	alerts      repository.AlertRepository
+	patients    repository.PatientRepository
+	teams       repository.CareTeamRepository
+	webhooks    *webhook.Publisher
+	channels    map[string]notify.Channel
+	templates   *Templates
+	cfg         Config
+
+	// wake interrupts Dispatch's wait when deliveries are enqueued
+	wake chan struct{}
+}
+
+// NewNotificationService checks cfg against channels and stores and loads
+// the templates
+func NewNotificationService(stores Stores, channels map[string]notify.Channel, cfg Config) (*NotificationService, error) {
+	configured := make(map[string]bool)
+	for name := range channels {
+		configured[name] = true
+	}
+	if err := cfg.validate(configured); err != nil {
+		return nil, fmt.Errorf("notification config: %w", err)
+	}
+	if stores.Deliveries == nil {
+		return nil, fmt.Errorf("notification service needs a delivery store")
+	}
+	if len(cfg.Escalations) > 0 && (stores.Escalations == nil || stores.Alerts == nil) {
+		return nil, fmt.Errorf("escalation policies need escalation and alert stores")
+	}
+	templates, err := LoadTemplates(cfg.Templates)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = Duration(defaultPollInterval)
+	}
+	var publisher *webhook.Publisher
+	if stores.Webhooks != nil {
+		publisher = webhook.NewPublisher(stores.Webhooks, stores.Patients)
+	}
+	return &NotificationService{
+		store:       stores.Deliveries,
+		escalations: stores.Escalations,
+		alerts:      stores.Alerts,
+		patients:    stores.Patients,
+		teams:       stores.CareTeams,
+		webhooks:    publisher,
+		channels:    channels,
+		templates:   templates,
+		cfg:         cfg,
+		wake:        make(chan struct{}, 1),
+	}, nil
+}
+
+// HandleAlert enqueues one delivery per recipient of every route alert
+// matches, starts the first escalation policy it matches and publishes it
+// to webhook subscriptions
+func (svc *NotificationService) HandleAlert(ctx context.Context, alert *entities.Alert) error {
+	patient := svc.lookup(ctx, alert.PatientID)
+	if err := svc.startEscalation(ctx, alert, patient); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	seen := make(map[string]bool)
+	var ds []entities.NotificationDelivery
+	for _, route := range svc.cfg.Routes {
+		if !svc.matches(route, alert, patient) {
+			continue
+		}
+		for _, to := range route.To {
+			id := entities.DeliveryID(alert.ID, route.Channel, to)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			subject, body, err := svc.templates.Render(route.Channel, TemplateData{
+				Alert: alert, Ward: patient().Ward, Route: route.Name, Recipient: to,
+			})
+			if err != nil {
+				return fmt.Errorf("route %s: %w", route.Name, err)
+			}
+			ds = append(ds, entities.NotificationDelivery{
+				ID:            id,
+				AlertID:       alert.ID,
+				PatientID:     alert.PatientID,
+				Severity:      alert.Severity,
+				Route:         route.Name,
+				Channel:       route.Channel,
+				Recipient:     to,
+				Subject:       subject,
+				Body:          body,
+				Status:        entities.DeliveryPending,
+				NextAttemptAt: now,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			})
+		}
+	}
+	if len(ds) > 0 {
+		if err := svc.store.Enqueue(ctx, ds); err != nil {
+			return fmt.Errorf("failed to enqueue notifications for alert %s: %w", alert.ID, err)
+		}
+		svc.wakeDispatch()
+	}
+	return svc.publish(ctx, webhook.Event{Type: entities.EventAlertRaised, Alert: alert})
+}
+
+// publish queues e for webhook subscriptions, if the service has any
+func (svc *NotificationService) publish(ctx context.Context, e webhook.Event) error {
+	if svc.webhooks == nil {
+		return nil
+	}
+	if _, err := svc.webhooks.Publish(ctx, e); err != nil {
+		return fmt.Errorf("failed to publish %s of alert %s: %w", e.Type, e.Alert.ID, err)
+	}
+	return nil
+}
+
+// wakeDispatch makes Dispatch look for due work now
+func (svc *NotificationService) wakeDispatch() {
+	select {
+	case svc.wake <- struct{}{}:
+	default:
+	}
+}
+
+// patientInfo is what routes filter on besides the alert itself
+type patientInfo struct {
+	Ward      string
+	CareTeams []string
+}
+
+// lookup returns a memoized loader of the patient's ward and care teams,
+// so alerts no route filters by location cost no queries
+func (svc *NotificationService) lookup(ctx context.Context, patientID string) func() patientInfo {
+	var once sync.Once
+	var info patientInfo
+	return func() patientInfo {
+		once.Do(func() {
+			if svc.patients != nil {
+				p, err := svc.patients.FetchByID(ctx, patientID)
+				if err != nil {
+					log.Printf("[Notifier] patient lookup for %s failed: %v", patientID, err)
+				} else if p != nil {
+					info.Ward = p.Ward
+				}
+			}
+			if svc.teams != nil {
+				teams, err := svc.teams.CareTeams(ctx, patientID)
+				if err != nil {
+					log.Printf("[Notifier] care team lookup for %s failed: %v", patientID, err)
+				}
+				info.CareTeams = teams
+			}
+		})
+		return info
+	}
+}
+
+func (svc *NotificationService) matches(r Route, alert *entities.Alert, patient func() patientInfo) bool {
+	if r.MinSeverity != "" && entities.SeverityRank(alert.Severity) < entities.SeverityRank(r.MinSeverity) {
+		return false
+	}
+	if len(r.PatientIDs) == 0 && len(r.Wards) == 0 && len(r.CareTeams) == 0 {
+		return true
+	}
+	if contains(r.PatientIDs, alert.PatientID) {
+		return true
+	}
+	if len(r.Wards) > 0 && contains(r.Wards, patient().Ward) {
+		return true
+	}
+	for _, team := range patient().CareTeams {
+		if contains(r.CareTeams, team) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v && v != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatch escalates due escalations and sends due deliveries until ctx
+// is cancelled. Attempts in flight when ctx is cancelled finish and record
+// their outcome.
+func (svc *NotificationService) Dispatch(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(svc.cfg.PollInterval))
+	defer ticker.Stop()
+	for {
+		for svc.escalateBatch(ctx) {
+		}
+		for svc.dispatchBatch(ctx) {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-svc.wake:
+		}
+	}
+}
+
+// dispatchBatch sends one claimed batch and reports whether it was full,
+// i.e. more deliveries may be due
+func (svc *NotificationService) dispatchBatch(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	claimed, err := svc.store.Claim(ctx, time.Now().UTC(), claimLease, claimBatch)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("[Notifier] claiming due deliveries failed: %v", err)
+		}
+		return false
+	}
+	workCtx := context.WithoutCancel(ctx)
+	var wg sync.WaitGroup
+	for i := range claimed {
+		wg.Add(1)
+		go func(d *entities.NotificationDelivery) {
+			defer wg.Done()
+			svc.attempt(workCtx, d)
+		}(&claimed[i])
+	}
+	wg.Wait()
+	return len(claimed) == claimBatch
+}
+
+// attempt sends d once and stores the outcome
+func (svc *NotificationService) attempt(ctx context.Context, d *entities.NotificationDelivery) {
+	policy := svc.cfg.RetryFor(d.Channel)
+	var err error
+	if channel, ok := svc.channels[d.Channel]; ok {
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err = channel.Send(sendCtx, d)
+		cancel()
+	} else {
+		err = notify.Permanent(fmt.Errorf("channel %q is not configured", d.Channel))
+	}
+
+	now := time.Now().UTC()
+	d.Attempts++
+	d.UpdatedAt = now
+	outcome := entities.DeliverySent
+	switch {
+	case err == nil:
+		d.Status = entities.DeliverySent
+		d.SentAt = &now
+		d.LastError = ""
+	case notify.IsPermanent(err) || d.Attempts >= policy.Attempts:
+		d.Status = entities.DeliveryFailed
+		d.LastError = err.Error()
+		outcome = entities.DeliveryFailed
+		log.Printf("[Notifier] %s delivery %s to %s failed after %d attempts: %v", d.Channel, d.ID, d.Recipient, d.Attempts, err)
+	default:
+		d.NextAttemptAt = now.Add(policy.Delay(d.Attempts))
+		d.LastError = err.Error()
+		outcome = "retry"
+		log.Printf("[Notifier] %s delivery %s to %s failed, retrying at %s: %v", d.Channel, d.ID, d.Recipient, d.NextAttemptAt.Format(time.RFC3339), err)
+	}
+	attempts.WithLabelValues(d.Channel, outcome).Inc()
+	if err := svc.store.Update(ctx, d); err != nil {
+		log.Printf("[Notifier] storing outcome of delivery %s failed: %v", d.ID, err)
+	}
+}
@@ -0,0 +1,124 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+// TemplateData is what notification templates are executed with
+type TemplateData struct {
+	Alert *entities.Alert
+	// Ward is the patient's ward, empty when unknown
+	Ward      string
+	Route     string
+	Recipient string
+	// Role and Step are the on-call role and 1-based step of escalation
+	// notifications, empty for routes
+	Role string
+	Step int
+}
+
+const defaultSubject = `{{if gt .Step 1}}[ESCALATED] {{end}}[{{upper .Alert.Severity}}] {{.Alert.Type}} for patient {{.Alert.PatientID}}`
+
+// defaultBodies are the built-in body templates by channel. Webhook bodies
+// must render to JSON.
+var defaultBodies = map[string]string{
+	entities.ChannelEmail: `{{.Alert.Type}} ({{.Alert.Severity}}) was raised for patient {{.Alert.PatientID}}{{with .Ward}} in {{.}}{{end}}.
+
+{{.Alert.Message}}
+{{with .Alert.Code}}
+Vital: {{.}} = {{$.Alert.Value}}{{if $.Alert.Threshold}} (limit {{$.Alert.Threshold}}){{end}}{{end}}
+Time: {{.Alert.Timestamp.UTC.Format "2006-01-02 15:04:05 MST"}}
+Alert: {{.Alert.ID}}
+`,
+	entities.ChannelSMS:     `RPM {{if gt .Step 1}}ESCALATED {{end}}{{upper .Alert.Severity}}: {{.Alert.Type}} patient {{.Alert.PatientID}}{{with .Ward}} ({{.}}){{end}}{{with .Alert.Code}} {{.}}={{$.Alert.Value}}{{end}} at {{.Alert.Timestamp.UTC.Format "15:04"}}Z`,
+	entities.ChannelWebhook: `{"event": "{{if .Role}}alert.escalated{{else}}alert.raised{{end}}", "route": {{json .Route}}, "ward": {{json .Ward}},{{with .Role}} "role": {{json .}},{{end}} "alert": {{json .Alert}}}`,
+	entities.ChannelPager:   `{{.Alert.Message}}{{with .Ward}} Ward: {{.}}.{{end}} Alert {{.Alert.ID}}.`,
+}
+
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"json": func(v interface{}) (string, error) {
+		raw, err := json.Marshal(v)
+		return string(raw), err
+	},
+}
+
+// Templates renders the subject and body of each channel's notifications
+type Templates struct {
+	subjects map[string]*template.Template
+	bodies   map[string]*template.Template
+}
+
+// LoadTemplates parses the built-in templates, replaced by the
+// <channel>.subject.tmpl and <channel>.body.tmpl files of dir when dir is
+// set and has them. Every template is tried on a sample alert, so broken
+// ones fail at startup rather than per alert.
+func LoadTemplates(dir string) (*Templates, error) {
+	t := &Templates{subjects: make(map[string]*template.Template), bodies: make(map[string]*template.Template)}
+	for channel, body := range defaultBodies {
+		for part, text := range map[string]string{"subject": defaultSubject, "body": body} {
+			if dir != "" {
+				path := filepath.Join(dir, channel+"."+part+".tmpl")
+				raw, err := os.ReadFile(path)
+				switch {
+				case err == nil:
+					text = string(raw)
+				case !errors.Is(err, os.ErrNotExist):
+					return nil, fmt.Errorf("template %s: %w", path, err)
+				}
+			}
+			tmpl, err := template.New(channel + "." + part).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("template %s.%s: %w", channel, part, err)
+			}
+			if part == "subject" {
+				t.subjects[channel] = tmpl
+			} else {
+				t.bodies[channel] = tmpl
+			}
+		}
+	}
+
+	sample := TemplateData{
+		Alert: &entities.Alert{
+			ID: "alert-sample", PatientID: "patient-sample", Type: "LowSpO2", Severity: entities.SeverityCritical,
+			Message: "sample", Code: "spo2", Value: 85, Threshold: 90, Timestamp: time.Now(),
+		},
+		Ward: "ward-sample", Route: "sample", Recipient: "sample", Role: "sample", Step: 2,
+	}
+	for channel := range defaultBodies {
+		if _, _, err := t.Render(channel, sample); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Render returns the subject and body of a notification over channel
+func (t *Templates) Render(channel string, data TemplateData) (string, string, error) {
+	subjectTmpl, ok := t.subjects[channel]
+	if !ok {
+		return "", "", fmt.Errorf("no template for channel %q", channel)
+	}
+	var subject, body strings.Builder
+	if err := subjectTmpl.Execute(&subject, data); err != nil {
+		return "", "", fmt.Errorf("template %s.subject: %w", channel, err)
+	}
+	if err := t.bodies[channel].Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("template %s.body: %w", channel, err)
+	}
+	if channel == entities.ChannelWebhook && !json.Valid([]byte(body.String())) {
+		return "", "", fmt.Errorf("template %s.body does not render to JSON", channel)
+	}
+	// a subject is a single header line
+	return strings.Join(strings.Fields(subject.String()), " "), body.String(), nil
+}
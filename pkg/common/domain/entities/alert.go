@@ -2,12 +2,60 @@ package entities
 
 import "time"
 
+// Alert severities, lowest first
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Detectors that raise alerts
+const (
+	SourceRule   = "rule"
+	SourceZScore = "zscore"
+	SourceML     = "ml"
+)
+
 type Alert struct {
 	ID            string `gorm:"primaryKey"`
 	PatientID     string `gorm:"index"`
 	ObservationID string
 	Message       string
 	Type          string
-	Timestamp     time.Time
-	Acknowledged  bool
+	Severity      string
+	// what fired: the detector, the rule within it and the vital it watched
+	Source string
+	RuleID string
+	Code   string
+	// the observed value, the limit it crossed and, for statistical and ML
+	// detectors, the score compared against that limit
+	Value        float64
+	Threshold    float64
+	Score        float64
+	Timestamp    time.Time
+	Acknowledged bool
+	// who acknowledged the alert and when
+	AcknowledgedBy string
+	AcknowledgedAt *time.Time
+	// Resolved marks an alert whose cause has been dealt with; who resolved
+	// it and when
+	Resolved   bool
+	ResolvedBy string
+	ResolvedAt *time.Time
+	// Seq numbers alerts in the order they were stored. The store assigns
+	// it; WebSocket clients resume from the last Seq they received.
+	Seq int64 `gorm:"default:null;uniqueIndex"`
+}
+
+// SeverityRank orders severities for comparisons; unknown values rank 0
+func SeverityRank(severity string) int {
+	switch severity {
+	case SeverityInfo:
+		return 1
+	case SeverityWarning:
+		return 2
+	case SeverityCritical:
+		return 3
+	}
+	return 0
 }
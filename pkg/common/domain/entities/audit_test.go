@@ -0,0 +1,62 @@
+package entities_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+func TestAuditEventSeal(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.FixedZone("UTC+2", 2*60*60))
+	first := entities.AuditEvent{Time: at, Actor: "nurse-1", Action: entities.AuditRead, PatientID: "p1", Resource: "/patients/p1/alerts", Status: 200, Outcome: entities.OutcomeSuccess}
+	first.Seal("")
+	second := first
+	second.Time = at.Add(time.Second)
+	second.Seal(first.Hash)
+
+	if first.PrevHash != "" || second.PrevHash != first.Hash {
+		t.Fatalf("prev hashes %q and %q do not chain", first.PrevHash, second.PrevHash)
+	}
+	if first.Hash == second.Hash {
+		t.Fatal("events at different times share a hash")
+	}
+	if first.Time.Location() != time.UTC || first.Time.Nanosecond() != 123456000 {
+		t.Fatalf("sealed time %s is not UTC truncated to microseconds", first.Time)
+	}
+
+	// a stored event reads back without the monotonic clock and in whatever
+	// zone the driver picks; that must not change the hash
+	reread := first
+	reread.Time = first.Time.In(time.FixedZone("UTC-5", -5*60*60))
+	if reread.ComputeHash() != first.Hash {
+		t.Fatal("hash depends on the time zone")
+	}
+
+	// every covered field changes the hash
+	cases := []struct {
+		name   string
+		tamper func(e *entities.AuditEvent)
+	}{
+		{"prev hash", func(e *entities.AuditEvent) { e.PrevHash = "forged" }},
+		{"time", func(e *entities.AuditEvent) { e.Time = e.Time.Add(time.Microsecond) }},
+		{"actor", func(e *entities.AuditEvent) { e.Actor = "nurse-2" }},
+		{"roles", func(e *entities.AuditEvent) { e.Roles = "admin" }},
+		{"action", func(e *entities.AuditEvent) { e.Action = entities.AuditWrite }},
+		{"patient", func(e *entities.AuditEvent) { e.PatientID = "p2" }},
+		{"resource", func(e *entities.AuditEvent) { e.Resource = "/patients/p2/alerts" }},
+		{"query", func(e *entities.AuditEvent) { e.Query = "limit=1" }},
+		{"client ip", func(e *entities.AuditEvent) { e.ClientIP = "10.0.0.1" }},
+		{"status", func(e *entities.AuditEvent) { e.Status = 403 }},
+		{"outcome", func(e *entities.AuditEvent) { e.Outcome = entities.OutcomeDenied }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := second
+			tc.tamper(&e)
+			if e.ComputeHash() == second.Hash {
+				t.Fatalf("changing the %s kept the hash", tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package entities
+
+import "time"
+
+// Escalation statuses. An active escalation notifies its next step when it
+// is due; it stops once the alert is acknowledged or resolved or its policy
+// has no steps left.
+const (
+	EscalationActive       = "active"
+	EscalationAcknowledged = "acknowledged"
+	EscalationResolved     = "resolved"
+	EscalationExhausted    = "exhausted"
+)
+
+// Escalation is the durable timer walking one alert through the steps of an
+// escalation policy
+type Escalation struct {
+	ID        string `gorm:"primaryKey" json:"id"`
+	AlertID   string `gorm:"index" json:"alert_id"`
+	PatientID string `json:"patient_id"`
+	// Ward is the patient's ward when the alert was raised; its on-call
+	// rotations are notified
+	Ward   string `json:"ward,omitempty"`
+	Policy string `json:"policy"`
+	// Step is the index of the next step to notify
+	Step   int    `json:"step"`
+	Status string `json:"status"`
+	// DueAt is when an active escalation notifies Step
+	DueAt     time.Time `gorm:"index" json:"due_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Escalation) TableName() string { return "alert_escalations" }
+
+// EscalationID identifies the escalation of an alert; an alert is
+// escalated at most once
+func EscalationID(alertID string) string {
+	return "esc-" + alertID
+}
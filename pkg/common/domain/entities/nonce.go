@@ -0,0 +1,13 @@
+package entities
+
+import "time"
+
+// DeviceNonce is the nonce of a signed device request. It is kept until
+// the request's timestamp falls out of the signature window, after which a
+// replay is rejected as stale anyway.
+type DeviceNonce struct {
+	Nonce     string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+func (DeviceNonce) TableName() string { return "device_nonces" }
@@ -0,0 +1,57 @@
+package entities
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Notification channels
+const (
+	ChannelEmail   = "email"
+	ChannelSMS     = "sms"
+	ChannelWebhook = "webhook"
+	ChannelPager   = "pager"
+)
+
+// Delivery statuses. A pending delivery is retried until it is sent or has
+// failed permanently.
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+)
+
+// NotificationDelivery is one alert notification to one recipient over one
+// channel. The message is rendered when the delivery is created, so retries
+// send exactly what the first attempt sent.
+type NotificationDelivery struct {
+	ID        string `gorm:"primaryKey" json:"id"`
+	AlertID   string `gorm:"index" json:"alert_id"`
+	PatientID string `json:"patient_id"`
+	Severity  string `json:"severity"`
+	// Route names the routing rule that selected the recipient
+	Route     string `json:"route,omitempty"`
+	Channel   string `json:"channel"`
+	Recipient string `json:"recipient"`
+	Subject   string `json:"subject,omitempty"`
+	Body      string `json:"body"`
+	Status    string `json:"status"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+	// NextAttemptAt is when a pending delivery is next due
+	NextAttemptAt time.Time  `gorm:"index" json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+func (NotificationDelivery) TableName() string { return "notification_deliveries" }
+
+// DeliveryID identifies the notification of alert to recipient over
+// channel. It is stable, so an alert consumed twice is notified once, and
+// it is sent as the idempotency key where the channel supports one.
+func DeliveryID(alertID, channel, recipient string) string {
+	sum := sha256.Sum256([]byte(alertID + "\x00" + channel + "\x00" + recipient))
+	return "ntf-" + hex.EncodeToString(sum[:12])
+}
@@ -12,6 +12,7 @@ type ObservationRecord struct {
 	CodeText          string
 	PatientID         string
 	Subject           string
+	DeviceID          string
 	EffectiveDateTime time.Time
 	Value             float64
 	Unit              string
@@ -23,6 +24,7 @@ type Observation struct {
 	Status            string        `json:"status"`
 	Code              Code          `json:"code"`
 	Subject           Subject       `json:"subject"`
+	Device            *Device       `json:"device,omitempty"`
 	EffectiveDateTime string        `json:"effectiveDateTime"`
 	ValueQuantity     ValueQuantity `json:"valueQuantity"`
 }
@@ -35,6 +37,10 @@ type Subject struct {
 	Reference string `json:"reference"`
 }
 
+type Device struct {
+	Reference string `json:"reference"`
+}
+
 type ValueQuantity struct {
 	Value float64 `json:"value"`
 	Unit  string  `json:"unit"`
@@ -60,6 +66,26 @@ func ToObservationRecord(obs *Observation) (*ObservationRecord, error) {
 		Value:             obs.ValueQuantity.Value,
 		Unit:              obs.ValueQuantity.Unit,
 	}
+	if obs.Device != nil {
+		record.DeviceID = obs.Device.Reference
+	}
 
 	return record, nil
 }
+
+// ToObservation rebuilds the FHIR Observation a record was created from
+func ToObservation(record *ObservationRecord) Observation {
+	obs := Observation{
+		ID:                record.ID,
+		ResourceType:      record.ResourceType,
+		Status:            record.Status,
+		Code:              Code{Text: record.CodeText},
+		Subject:           Subject{Reference: record.PatientID},
+		EffectiveDateTime: record.EffectiveDateTime.Format(time.RFC3339),
+		ValueQuantity:     ValueQuantity{Value: record.Value, Unit: record.Unit},
+	}
+	if record.DeviceID != "" {
+		obs.Device = &Device{Reference: record.DeviceID}
+	}
+	return obs
+}
@@ -6,4 +6,14 @@ type Patient struct {
 	ID        string `gorm:"primaryKey"`
 	Name      string
 	BirthDate time.Time
+	// location used by central-station views
+	Ward string `gorm:"index"`
+	Unit string `gorm:"index"`
+}
+
+// PatientCareTeam assigns a patient to a care team; staff see the patients
+// of the care teams in their token
+type PatientCareTeam struct {
+	PatientID string `gorm:"primaryKey"`
+	CareTeam  string `gorm:"primaryKey;index"`
 }
@@ -0,0 +1,103 @@
+package entities
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Webhook event types
+const (
+	EventAlertRaised       = "alert.raised"
+	EventAlertAcknowledged = "alert.acknowledged"
+	EventAlertEscalated    = "alert.escalated"
+	EventAlertResolved     = "alert.resolved"
+)
+
+// WebhookEventTypes lists every event type a subscription may select
+var WebhookEventTypes = []string{EventAlertRaised, EventAlertAcknowledged, EventAlertEscalated, EventAlertResolved}
+
+// Webhook delivery statuses. A pending delivery is retried until it is
+// delivered or dead-lettered.
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookDead      = "dead"
+)
+
+// WebhookSubscription registers a URL for alert events. Empty filters match
+// everything; PatientIDs and Wards match when either does.
+type WebhookSubscription struct {
+	ID          string `gorm:"primaryKey" json:"id"`
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+	// Secret signs every delivery. It is only shown when the subscription
+	// is created.
+	Secret      string    `json:"-"`
+	EventTypes  []string  `gorm:"serializer:json" json:"event_types"`
+	PatientIDs  []string  `gorm:"serializer:json" json:"patient_ids"`
+	Wards       []string  `gorm:"serializer:json" json:"wards"`
+	MinSeverity string    `json:"min_severity,omitempty"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (WebhookSubscription) TableName() string { return "webhook_subscriptions" }
+
+// WebhookEvent is the JSON body of a webhook delivery
+type WebhookEvent struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      WebhookEventData `json:"data"`
+}
+
+// WebhookEventData is the alert as it was when the event happened. Role and
+// Step are set on alert.escalated.
+type WebhookEventData struct {
+	Alert *Alert `json:"alert"`
+	Ward  string `json:"ward,omitempty"`
+	Role  string `json:"role,omitempty"`
+	Step  int    `json:"step,omitempty"`
+}
+
+// WebhookDelivery is one event posted to one subscription. The payload is
+// rendered when the delivery is created, so retries send exactly what the
+// first attempt sent.
+type WebhookDelivery struct {
+	ID             string `gorm:"primaryKey" json:"id"`
+	SubscriptionID string `gorm:"index" json:"subscription_id"`
+	EventID        string `json:"event_id"`
+	EventType      string `json:"event_type"`
+	AlertID        string `json:"alert_id"`
+	Payload        string `json:"payload"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	// ResponseStatus is the HTTP status of the last attempt, 0 when it got
+	// no response
+	ResponseStatus int    `json:"response_status,omitempty"`
+	LastError      string `json:"last_error,omitempty"`
+	// NextAttemptAt is when a pending delivery is next due
+	NextAttemptAt time.Time  `gorm:"index" json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+func (WebhookDelivery) TableName() string { return "webhook_deliveries" }
+
+// WebhookEventID identifies an event of an alert. detail tells apart
+// events of one type, e.g. escalation steps. It is stable, so an event
+// published twice is delivered once.
+func WebhookEventID(eventType, alertID, detail string) string {
+	sum := sha256.Sum256([]byte(eventType + "\x00" + alertID + "\x00" + detail))
+	return "evt-" + hex.EncodeToString(sum[:12])
+}
+
+// WebhookDeliveryID identifies the delivery of an event to a subscription.
+// It is sent as the Idempotency-Key header.
+func WebhookDeliveryID(subscriptionID, eventID string) string {
+	sum := sha256.Sum256([]byte(subscriptionID + "\x00" + eventID))
+	return "whd-" + hex.EncodeToString(sum[:12])
+}
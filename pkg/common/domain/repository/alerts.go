@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+const (
+	// DefaultAlertLimit is the page size when AlertQuery.Limit is zero
+	DefaultAlertLimit = 50
+	// MaxAlertLimit bounds the page size a caller may request
+	MaxAlertLimit = 500
+)
+
+// AlertQuery selects a page of alerts ordered by timestamp, with the alert
+// ID as tie-breaker. Empty strings, nil pointers and zero times do not
+// filter. Ward and Unit match the patient's location.
+type AlertQuery struct {
+	PatientID    string
+	Ward         string
+	Unit         string
+	Type         string
+	Severity     string
+	Acknowledged *bool
+	Resolved     *bool
+	// CareTeams limits results to patients of these teams; nil does not
+	// restrict and an empty slice matches nothing
+	CareTeams []string
+	From      time.Time
+	To        time.Time
+	// Ascending returns oldest first; the default is newest first
+	Ascending bool
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+	Limit  int
+}
+
+// AlertPage is one page of an alert query. Total counts every alert
+// matching the filters, not just this page.
+type AlertPage struct {
+	Alerts     []entities.Alert `json:"alerts"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+	Total      int64            `json:"total"`
+}
+
+// AlertCursor is the position after the last alert of a page
+type AlertCursor struct {
+	Timestamp time.Time
+	ID        string
+}
+
+// Validate applies the default limit and rejects bad bounds and cursors
+func (q *AlertQuery) Validate() error {
+	if q.Limit == 0 {
+		q.Limit = DefaultAlertLimit
+	}
+	if q.Limit < 0 || q.Limit > MaxAlertLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxAlertLimit)
+	}
+	if q.Severity != "" && entities.SeverityRank(q.Severity) == 0 {
+		return fmt.Errorf("%w: severity must be info, warning or critical", ErrInvalidQuery)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.From.After(q.To) {
+		return fmt.Errorf("%w: from must not be after to", ErrInvalidQuery)
+	}
+	if q.Cursor != "" {
+		if _, err := DecodeAlertCursor(q.Cursor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncodeAlertCursor returns the opaque cursor pointing after alert
+func EncodeAlertCursor(alert entities.Alert) string {
+	return encodeCursor(alert.Timestamp, alert.ID)
+}
+
+func DecodeAlertCursor(cursor string) (AlertCursor, error) {
+	return decodeCursor(cursor)
+}
+
+// encodeCursor packs a time and ID tie-breaker into an opaque cursor
+func encodeCursor(t time.Time, id string) string {
+	raw := strconv.FormatInt(t.UnixNano(), 10) + ":" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (AlertCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return AlertCursor{}, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	ts, id, ok := strings.Cut(string(raw), ":")
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if !ok || err != nil || id == "" {
+		return AlertCursor{}, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return AlertCursor{Timestamp: time.Unix(0, nanos).UTC(), ID: id}, nil
+}
+
+// PageAlerts applies q to alerts held in memory, looking up ward and unit in
+// patients and care teams in careTeams. Stores that cannot filter natively
+// use it so every backend pages the same way.
+func PageAlerts(alerts []entities.Alert, patients map[string]entities.Patient, careTeams map[string][]string, q AlertQuery) (AlertPage, error) {
+	if err := q.Validate(); err != nil {
+		return AlertPage{}, err
+	}
+
+	var matched []entities.Alert
+	for _, a := range alerts {
+		if matchesAlert(a, patients[a.PatientID], q) && inCareTeams(careTeams[a.PatientID], q.CareTeams) {
+			matched = append(matched, a)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if q.Ascending {
+			return alertBefore(matched[i], matched[j])
+		}
+		return alertBefore(matched[j], matched[i])
+	})
+
+	page := AlertPage{Alerts: []entities.Alert{}, Total: int64(len(matched))}
+	if q.Cursor != "" {
+		c, _ := DecodeAlertCursor(q.Cursor)
+		after := entities.Alert{ID: c.ID, Timestamp: c.Timestamp}
+		i := sort.Search(len(matched), func(i int) bool {
+			if q.Ascending {
+				return alertBefore(after, matched[i])
+			}
+			return alertBefore(matched[i], after)
+		})
+		matched = matched[i:]
+	}
+	if len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+		page.NextCursor = EncodeAlertCursor(matched[len(matched)-1])
+	}
+	page.Alerts = append(page.Alerts, matched...)
+	return page, nil
+}
+
+func alertBefore(a, b entities.Alert) bool {
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.Before(b.Timestamp)
+	}
+	return a.ID < b.ID
+}
+
+func inCareTeams(patientTeams, allowed []string) bool {
+	if allowed == nil {
+		return true
+	}
+	for _, t := range patientTeams {
+		for _, a := range allowed {
+			if t == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesAlert(a entities.Alert, p entities.Patient, q AlertQuery) bool {
+	switch {
+	case q.PatientID != "" && a.PatientID != q.PatientID,
+		q.Ward != "" && p.Ward != q.Ward,
+		q.Unit != "" && p.Unit != q.Unit,
+		q.Type != "" && a.Type != q.Type,
+		q.Severity != "" && a.Severity != q.Severity,
+		q.Acknowledged != nil && a.Acknowledged != *q.Acknowledged,
+		q.Resolved != nil && a.Resolved != *q.Resolved,
+		!q.From.IsZero() && a.Timestamp.Before(q.From),
+		!q.To.IsZero() && a.Timestamp.After(q.To):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+// AuditRepository is the append-only store of patient data accesses
+type AuditRepository interface {
+	// Append chains e after the newest stored event, setting its Seq,
+	// PrevHash and Hash
+	Append(ctx context.Context, e *entities.AuditEvent) error
+	Query(ctx context.Context, q AuditQuery) (AuditPage, error)
+	// Verify recomputes the whole chain
+	Verify(ctx context.Context) (AuditVerification, error)
+}
+
+// AuditQuery selects a page of audit events, newest first. Empty strings
+// and zero times do not filter.
+type AuditQuery struct {
+	Actor     string
+	PatientID string
+	Action    string
+	From      time.Time
+	To        time.Time
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+	Limit  int
+}
+
+// AuditPage is one page of an audit query
+type AuditPage struct {
+	Events     []entities.AuditEvent `json:"events"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// Validate applies the default limit and rejects bad bounds and cursors
+func (q *AuditQuery) Validate() error {
+	if q.Limit == 0 {
+		q.Limit = DefaultAlertLimit
+	}
+	if q.Limit < 0 || q.Limit > MaxAlertLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxAlertLimit)
+	}
+	if q.Action != "" && q.Action != entities.AuditRead && q.Action != entities.AuditWrite {
+		return fmt.Errorf("%w: action must be read or write", ErrInvalidQuery)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.From.After(q.To) {
+		return fmt.Errorf("%w: from must not be after to", ErrInvalidQuery)
+	}
+	if _, err := q.BeforeSeq(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// BeforeSeq decodes the cursor: the page holds events with a lower Seq. It
+// is 0 without a cursor.
+func (q *AuditQuery) BeforeSeq() (int64, error) {
+	if q.Cursor == "" {
+		return 0, nil
+	}
+	seq, err := strconv.ParseInt(q.Cursor, 10, 64)
+	if err != nil || seq <= 0 {
+		return 0, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return seq, nil
+}
+
+// Matches reports whether e passes the filters of q, cursor included
+func (q *AuditQuery) Matches(e entities.AuditEvent) bool {
+	before, _ := q.BeforeSeq()
+	switch {
+	case before > 0 && e.Seq >= before,
+		q.Actor != "" && e.Actor != q.Actor,
+		q.PatientID != "" && e.PatientID != q.PatientID,
+		q.Action != "" && e.Action != q.Action,
+		!q.From.IsZero() && e.Time.Before(q.From),
+		!q.To.IsZero() && e.Time.After(q.To):
+		return false
+	}
+	return true
+}
+
+// AuditVerification is the result of walking the audit chain. Head is the
+// newest hash; recording it elsewhere also makes truncating the log
+// detectable.
+type AuditVerification struct {
+	Events int64  `json:"events"`
+	Valid  bool   `json:"valid"`
+	Head   string `json:"head,omitempty"`
+	// BrokenAt is the Seq of the first event that does not chain
+	BrokenAt int64 `json:"broken_at,omitempty"`
+}
+
+// NewAuditVerification starts a walk at the beginning of the chain
+func NewAuditVerification() AuditVerification {
+	return AuditVerification{Valid: true}
+}
+
+// Add checks the next event in Seq order. It returns false once the chain
+// is broken; later events are not checked.
+func (v *AuditVerification) Add(e entities.AuditEvent) bool {
+	if !v.Valid {
+		return false
+	}
+	v.Events++
+	if e.PrevHash != v.Head || e.ComputeHash() != e.Hash {
+		v.Valid = false
+		v.BrokenAt = e.Seq
+		return false
+	}
+	v.Head = e.Hash
+	return true
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+// Downsample applies q's interval, aggregate and limit to records that
+// already match q's patient, code and time range. Stores without native
+// aggregation use it so every backend returns the same shape as InfluxDB.
+func Downsample(records []entities.ObservationRecord, q ObservationQuery) []entities.Observation {
+	sorted := append([]entities.ObservationRecord(nil), records...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].EffectiveDateTime.Before(sorted[j].EffectiveDateTime)
+	})
+
+	if q.Interval == 0 {
+		perCode := make(map[string]int)
+		out := make([]entities.Observation, 0, len(sorted))
+		for i := range sorted {
+			if q.Limit > 0 && perCode[sorted[i].CodeText] >= q.Limit {
+				continue
+			}
+			perCode[sorted[i].CodeText]++
+			out = append(out, entities.ToObservation(&sorted[i]))
+		}
+		return out
+	}
+
+	type series struct {
+		code, unit string
+	}
+	type bucket struct {
+		start  time.Time
+		values []float64
+	}
+	buckets := make(map[series][]*bucket)
+	var order []series
+
+	width := q.Interval.Nanoseconds()
+	for _, rec := range sorted {
+		key := series{code: rec.CodeText, unit: rec.Unit}
+		start := time.Unix(0, rec.EffectiveDateTime.UnixNano()/width*width).UTC()
+		bs, seen := buckets[key]
+		if !seen {
+			order = append(order, key)
+		}
+		if len(bs) == 0 || !bs[len(bs)-1].start.Equal(start) {
+			bs = append(bs, &bucket{start: start})
+			buckets[key] = bs
+		}
+		b := bs[len(bs)-1]
+		b.values = append(b.values, rec.Value)
+	}
+
+	var out []entities.Observation
+	for _, key := range order {
+		for i, b := range buckets[key] {
+			if q.Limit > 0 && i >= q.Limit {
+				break
+			}
+			out = append(out, entities.ToObservation(&entities.ObservationRecord{
+				ResourceType:      "Observation",
+				Status:            "Final",
+				CodeText:          key.code,
+				PatientID:         q.PatientID,
+				Subject:           q.PatientID,
+				EffectiveDateTime: b.start,
+				Value:             reduce(q.Aggregate, b.values),
+				Unit:              key.unit,
+			}))
+		}
+	}
+	return out
+}
+
+func reduce(agg Aggregate, values []float64) float64 {
+	switch agg {
+	case AggregateMin:
+		m := values[0]
+		for _, v := range values[1:] {
+			m = math.Min(m, v)
+		}
+		return m
+	case AggregateMax:
+		m := values[0]
+		for _, v := range values[1:] {
+			m = math.Max(m, v)
+		}
+		return m
+	case AggregateLast:
+		return values[len(values)-1]
+	case AggregateP95:
+		// nearest-rank, matching InfluxQL PERCENTILE()
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+		i := int(math.Floor(float64(len(sorted))*0.95+0.5)) - 1
+		if i < 0 {
+			i = 0
+		}
+		return sorted[i]
+	default:
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	}
+}
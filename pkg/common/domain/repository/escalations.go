@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+// EscalationRepository stores the escalation timers of unacknowledged
+// alerts. Several notifiers may share it; Claim hands each due escalation
+// to one of them.
+type EscalationRepository interface {
+	// Start stores a new active escalation, unless the alert already has
+	// one
+	Start(ctx context.Context, e *entities.Escalation) error
+	// Claim returns up to limit active escalations due at now, oldest due
+	// first, and postpones them by lease so no other notifier claims them
+	// while their step is notified
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.Escalation, error)
+	// Update stores the escalation's next step and status
+	Update(ctx context.Context, e *entities.Escalation) error
+	// FetchByAlert returns the alert's escalation, or nil when it has none
+	FetchByAlert(ctx context.Context, alertID string) (*entities.Escalation, error)
+}
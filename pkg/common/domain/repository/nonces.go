@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// NonceRepository remembers the nonces of signed device requests. Every
+// ingest replica must share one, or a request replayed against another
+// replica, or after a restart, is accepted again.
+type NonceRepository interface {
+	// Claim records nonce until expires. It returns false and records
+	// nothing when the nonce is already recorded and has not expired at
+	// now.
+	Claim(ctx context.Context, nonce string, now, expires time.Time) (bool, error)
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+// NotificationRepository stores alert notifications and their delivery
+// status. Several notifiers may share it; Claim hands each due delivery to
+// one of them.
+type NotificationRepository interface {
+	// Enqueue stores new pending deliveries. Deliveries whose ID is already
+	// stored are skipped, so an alert consumed twice is notified once.
+	Enqueue(ctx context.Context, deliveries []entities.NotificationDelivery) error
+	// Claim returns up to limit pending deliveries due at now, oldest due
+	// first, and postpones them by lease so no other notifier claims them
+	// while they are sent
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.NotificationDelivery, error)
+	// Update stores the outcome of an attempt
+	Update(ctx context.Context, d *entities.NotificationDelivery) error
+	// FetchByAlert returns the deliveries of one alert
+	FetchByAlert(ctx context.Context, alertID string) ([]entities.NotificationDelivery, error)
+}
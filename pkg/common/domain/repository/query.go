@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidQuery wraps caller mistakes in query parameters so transports
+// can report them as bad requests rather than server errors
+var ErrInvalidQuery = errors.New("invalid query")
+
+// DefaultObservationWindow is how far back observation queries reach when
+// from is omitted
+const DefaultObservationWindow = 24 * time.Hour
+
+// ParseTimeRange validates RFC3339 from/to bounds. An empty to means now and
+// an empty from means DefaultObservationWindow before to.
+func ParseTimeRange(from, to string, now time.Time) (time.Time, time.Time, error) {
+	toT := now.UTC()
+	if to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: to must be an RFC3339 timestamp", ErrInvalidQuery)
+		}
+		toT = t.UTC()
+	}
+
+	fromT := toT.Add(-DefaultObservationWindow)
+	if from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: from must be an RFC3339 timestamp", ErrInvalidQuery)
+		}
+		fromT = t.UTC()
+	}
+
+	if fromT.After(toT) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: from must not be after to", ErrInvalidQuery)
+	}
+	return fromT, toT, nil
+}
+
+// Aggregate is the function applied to each downsampling bucket
+type Aggregate string
+
+const (
+	AggregateMean Aggregate = "mean"
+	AggregateMin  Aggregate = "min"
+	AggregateMax  Aggregate = "max"
+	AggregateP95  Aggregate = "p95"
+	AggregateLast Aggregate = "last"
+)
+
+// Valid reports whether a is a supported aggregate
+func (a Aggregate) Valid() bool {
+	switch a {
+	case AggregateMean, AggregateMin, AggregateMax, AggregateP95, AggregateLast:
+		return true
+	}
+	return false
+}
+
+// MaxObservationLimit caps the number of points a single query may return
+// per vital code
+const MaxObservationLimit = 50000
+
+// ObservationQuery selects a patient's observations in [From, To]. With a
+// zero Interval raw points are returned; otherwise points are grouped per
+// vital code into Interval-wide buckets aligned to the Unix epoch and
+// reduced with Aggregate. Limit, when set, applies per vital code.
+type ObservationQuery struct {
+	PatientID string
+	From      time.Time
+	To        time.Time
+	Code      string
+	Interval  time.Duration
+	Aggregate Aggregate
+	Limit     int
+}
+
+// Validate checks the query and fills in the default aggregate
+func (q *ObservationQuery) Validate() error {
+	if q.PatientID == "" {
+		return fmt.Errorf("%w: patient id is required", ErrInvalidQuery)
+	}
+	if q.From.After(q.To) {
+		return fmt.Errorf("%w: from must not be after to", ErrInvalidQuery)
+	}
+	if q.Interval < 0 || q.Interval%time.Second != 0 {
+		return fmt.Errorf("%w: interval must be a positive whole number of seconds", ErrInvalidQuery)
+	}
+	if q.Interval == 0 && q.Aggregate != "" {
+		return fmt.Errorf("%w: aggregate requires an interval", ErrInvalidQuery)
+	}
+	if q.Interval > 0 && q.Aggregate == "" {
+		q.Aggregate = AggregateMean
+	}
+	if q.Aggregate != "" && !q.Aggregate.Valid() {
+		return fmt.Errorf("%w: unsupported aggregate %q", ErrInvalidQuery, q.Aggregate)
+	}
+	if q.Limit < 0 || q.Limit > MaxObservationLimit {
+		return fmt.Errorf("%w: limit must be between 0 and %d", ErrInvalidQuery, MaxObservationLimit)
+	}
+	return nil
+}
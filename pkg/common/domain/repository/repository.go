@@ -2,18 +2,44 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
 )
 
 type ObservationRepository interface {
 	Save(ctx context.Context, record *entities.ObservationRecord) error
-	FetchObservations(ctx context.Context, patientID, from, to string) ([]entities.Observation, error)
+	// SaveBatch saves records like Save, in as few writes as the backend
+	// allows
+	SaveBatch(ctx context.Context, records []*entities.ObservationRecord) error
+	FetchObservations(ctx context.Context, q ObservationQuery) ([]entities.Observation, error)
 }
 
 type AlertRepository interface {
 	Save(ctx context.Context, alert *entities.Alert) error
 	FetchByPatient(ctx context.Context, patientID string) ([]entities.Alert, error)
+	// FetchSince returns up to limit alerts with a Seq above seq, in Seq order
+	FetchSince(ctx context.Context, seq int64, limit int) ([]entities.Alert, error)
+	Query(ctx context.Context, q AlertQuery) (AlertPage, error)
+	// FetchByID returns nil, nil when the alert does not exist
+	FetchByID(ctx context.Context, id string) (*entities.Alert, error)
+	// Acknowledge records that by acknowledged the alert at at and returns
+	// it. An alert that is already acknowledged keeps its first
+	// acknowledgement. It returns nil, nil when the alert does not exist.
+	Acknowledge(ctx context.Context, id, by string, at time.Time) (*entities.Alert, error)
+	// Resolve records that by resolved the alert at at and returns it, like
+	// Acknowledge
+	Resolve(ctx context.Context, id, by string, at time.Time) (*entities.Alert, error)
+}
+
+type PatientRepository interface {
+	Save(ctx context.Context, patient *entities.Patient) error
+	FetchByID(ctx context.Context, id string) (*entities.Patient, error)
+}
+
+// CareTeamRepository lists the care teams a patient is assigned to
+type CareTeamRepository interface {
+	CareTeams(ctx context.Context, patientID string) ([]string, error)
 }
 
 type Publisher interface {
@@ -21,3 +47,27 @@ type Publisher interface {
 	PublishAlert(ctx context.Context, alert *entities.Alert) error
 	PublishFHIR(ctx context.Context, payload []byte) error
 }
+
+// Subscriber delivers raw messages from a single topic. Consume blocks until
+// ctx is cancelled or the subscriber fails; implementations acknowledge a
+// message only after handler returns nil. A message whose handler returns
+// an error is redelivered after RedeliveryDelay, so handlers must be
+// idempotent and should return nil for messages that can never succeed.
+type Subscriber interface {
+	Consume(ctx context.Context, handler func(key, val []byte) error) error
+	Close() error
+}
+
+// RedeliveryDelay is how long a subscriber waits before redelivering a
+// message whose handler failed attempt times, doubling from one second up
+// to thirty
+func RedeliveryDelay(attempt int) time.Duration {
+	const base, max = time.Second, 30 * time.Second
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > 6 {
+		return max
+	}
+	return min(base<<(attempt-1), max)
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+// WebhookRepository stores webhook subscriptions and their delivery log.
+// Several senders may share it; ClaimDeliveries hands each due delivery to
+// one of them.
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, s *entities.WebhookSubscription) error
+	// Subscriptions returns every subscription, oldest first
+	Subscriptions(ctx context.Context) ([]entities.WebhookSubscription, error)
+	// FetchSubscription returns nil when the subscription does not exist
+	FetchSubscription(ctx context.Context, id string) (*entities.WebhookSubscription, error)
+	// DeleteSubscription reports whether the subscription existed. Its
+	// delivery log is kept.
+	DeleteSubscription(ctx context.Context, id string) (bool, error)
+
+	// EnqueueDeliveries stores new pending deliveries. Deliveries whose ID
+	// is already stored are skipped, so an event published twice is
+	// delivered once.
+	EnqueueDeliveries(ctx context.Context, ds []entities.WebhookDelivery) error
+	// ClaimDeliveries returns up to limit pending deliveries due at now,
+	// oldest due first, and postpones them by lease so no other sender
+	// claims them while they are posted
+	ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.WebhookDelivery, error)
+	// UpdateDelivery stores the outcome of an attempt
+	UpdateDelivery(ctx context.Context, d *entities.WebhookDelivery) error
+	// FetchDelivery returns nil when the delivery does not exist
+	FetchDelivery(ctx context.Context, id string) (*entities.WebhookDelivery, error)
+	// Deliveries pages the delivery log of one subscription
+	Deliveries(ctx context.Context, q WebhookDeliveryQuery) (WebhookDeliveryPage, error)
+}
+
+// WebhookDeliveryQuery selects a page of one subscription's deliveries,
+// newest first. An empty Status does not filter.
+type WebhookDeliveryQuery struct {
+	SubscriptionID string
+	Status         string
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+	Limit  int
+}
+
+// WebhookDeliveryPage is one page of a delivery log
+type WebhookDeliveryPage struct {
+	Deliveries []entities.WebhookDelivery `json:"deliveries"`
+	NextCursor string                     `json:"next_cursor,omitempty"`
+}
+
+// Validate applies the default limit and rejects bad statuses and cursors
+func (q *WebhookDeliveryQuery) Validate() error {
+	if q.Limit == 0 {
+		q.Limit = DefaultAlertLimit
+	}
+	if q.Limit < 0 || q.Limit > MaxAlertLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxAlertLimit)
+	}
+	switch q.Status {
+	case "", entities.WebhookPending, entities.WebhookDelivered, entities.WebhookDead:
+	default:
+		return fmt.Errorf("%w: status must be pending, delivered or dead", ErrInvalidQuery)
+	}
+	if q.Cursor != "" {
+		if _, err := DecodeWebhookDeliveryCursor(q.Cursor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncodeWebhookDeliveryCursor returns the opaque cursor pointing after d
+func EncodeWebhookDeliveryCursor(d entities.WebhookDelivery) string {
+	return encodeCursor(d.CreatedAt, d.ID)
+}
+
+// DecodeWebhookDeliveryCursor returns the creation time and ID of the last
+// delivery of the previous page
+func DecodeWebhookDeliveryCursor(cursor string) (AlertCursor, error) {
+	return decodeCursor(cursor)
+}
+
+// PageWebhookDeliveries applies q to deliveries held in memory, so every
+// backend pages the same way
+func PageWebhookDeliveries(ds []entities.WebhookDelivery, q WebhookDeliveryQuery) (WebhookDeliveryPage, error) {
+	if err := q.Validate(); err != nil {
+		return WebhookDeliveryPage{}, err
+	}
+	var after *entities.WebhookDelivery
+	if q.Cursor != "" {
+		c, _ := DecodeWebhookDeliveryCursor(q.Cursor)
+		after = &entities.WebhookDelivery{ID: c.ID, CreatedAt: c.Timestamp}
+	}
+
+	var matched []entities.WebhookDelivery
+	for _, d := range ds {
+		switch {
+		case d.SubscriptionID != q.SubscriptionID,
+			q.Status != "" && d.Status != q.Status,
+			after != nil && !webhookDeliveryBefore(d, *after):
+			continue
+		}
+		matched = append(matched, d)
+	}
+	sort.Slice(matched, func(i, j int) bool { return webhookDeliveryBefore(matched[j], matched[i]) })
+
+	page := WebhookDeliveryPage{Deliveries: []entities.WebhookDelivery{}}
+	if len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+		page.NextCursor = EncodeWebhookDeliveryCursor(matched[len(matched)-1])
+	}
+	page.Deliveries = append(page.Deliveries, matched...)
+	return page, nil
+}
+
+func webhookDeliveryBefore(a, b entities.WebhookDelivery) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
@@ -0,0 +1,89 @@
+// Package audit builds and records audit events for requests touching
+// patient data. Events are written after the request has been served, so a
+// failed write is logged rather than returned to the caller.
+package audit
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+)
+
+// Anonymous is the actor of requests that did not authenticate
+const Anonymous = "anonymous"
+
+// writeTimeout bounds a single append
+const writeTimeout = 5 * time.Second
+
+// secretParams are redacted from recorded query strings
+var secretParams = []string{auth.TokenParam}
+
+// Event describes request r, served with status, as seen by principal p
+// (nil when authentication failed)
+func Event(r *http.Request, p *auth.Principal, status int, start time.Time) *entities.AuditEvent {
+	e := &entities.AuditEvent{
+		Time:     start,
+		Actor:    Anonymous,
+		Action:   Action(r.Method),
+		Resource: r.URL.Path,
+		Query:    RedactQuery(r.URL.Query()),
+		ClientIP: r.RemoteAddr,
+		Status:   status,
+		Outcome:  Outcome(status),
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		e.ClientIP = host
+	}
+	if p != nil {
+		e.Actor = p.Subject
+		e.Roles = strings.Join(p.Roles, ",")
+	}
+	return e
+}
+
+// Action is read for safe methods and write otherwise
+func Action(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return entities.AuditRead
+	}
+	return entities.AuditWrite
+}
+
+// Outcome classifies an HTTP status
+func Outcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return entities.OutcomeDenied
+	case status >= 400:
+		return entities.OutcomeError
+	}
+	return entities.OutcomeSuccess
+}
+
+// Record appends e to the audit log. It outlives the request's context.
+func Record(ctx context.Context, repo repository.AuditRepository, e *entities.AuditEvent) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), writeTimeout)
+	defer cancel()
+	if err := repo.Append(ctx, e); err != nil {
+		log.Printf("[Audit] FAILED to record %s %s by %s for patient %q: %v", e.Action, e.Resource, e.Actor, e.PatientID, err)
+	}
+}
+
+// RedactQuery encodes values with credentials replaced by REDACTED
+func RedactQuery(values url.Values) string {
+	for _, name := range secretParams {
+		if values.Has(name) {
+			values.Set(name, "REDACTED")
+		}
+	}
+	return values.Encode()
+}
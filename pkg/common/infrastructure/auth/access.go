@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+)
+
+// careTeamTTL bounds how long a patient's care teams are cached
+const careTeamTTL = time.Minute
+
+// Access decides which patients a principal may read. Admins see every
+// patient; nurses and physicians see patients of their care teams; devices
+// read nothing.
+type Access struct {
+	teams repository.CareTeamRepository
+
+	mu    sync.Mutex
+	cache map[string]cachedTeams
+}
+
+type cachedTeams struct {
+	teams   []string
+	expires time.Time
+}
+
+func NewAccess(teams repository.CareTeamRepository) *Access {
+	return &Access{teams: teams, cache: make(map[string]cachedTeams)}
+}
+
+// CanReadPatient reports whether p may read patientID's vitals and alerts
+func (a *Access) CanReadPatient(ctx context.Context, p *Principal, patientID string) (bool, error) {
+	if p == nil {
+		return false, nil
+	}
+	if p.Unrestricted() {
+		return true, nil
+	}
+	if !p.HasRole(RoleNurse, RolePhysician) || len(p.CareTeams) == 0 || a.teams == nil {
+		return false, nil
+	}
+
+	teams, err := a.careTeams(ctx, patientID)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range teams {
+		for _, mine := range p.CareTeams {
+			if t == mine {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// PatientScope returns the care teams that restrict p's cross-patient
+// queries: nil for unrestricted callers, empty when p may see no one
+func (a *Access) PatientScope(p *Principal) []string {
+	if p != nil && p.Unrestricted() {
+		return nil
+	}
+	if p == nil || !p.HasRole(RoleNurse, RolePhysician) {
+		return []string{}
+	}
+	return append([]string{}, p.CareTeams...)
+}
+
+func (a *Access) careTeams(ctx context.Context, patientID string) ([]string, error) {
+	now := time.Now()
+	a.mu.Lock()
+	c, ok := a.cache[patientID]
+	a.mu.Unlock()
+	if ok && now.Before(c.expires) {
+		return c.teams, nil
+	}
+
+	teams, err := a.teams.CareTeams(ctx, patientID)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	a.cache[patientID] = cachedTeams{teams: teams, expires: now.Add(careTeamTTL)}
+	a.mu.Unlock()
+	return teams, nil
+}
@@ -0,0 +1,429 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+)
+
+// Device authentication modes
+const (
+	DeviceAuthRequired = "required"
+	DeviceAuthOff      = "off"
+)
+
+// Headers read from device requests
+const (
+	HeaderDeviceKey          = "X-Device-Key"
+	HeaderSignature          = "X-Signature"
+	HeaderSignatureTimestamp = "X-Signature-Timestamp"
+	HeaderSignatureNonce     = "X-Signature-Nonce"
+)
+
+// AnyPatient in a device's patient list lets it report for every patient,
+// e.g. a bedside hub or gateway
+const AnyPatient = "*"
+
+// Device is a registered data source. Devices authenticate with an API key,
+// a TLS client certificate or both, and may additionally be required to
+// sign every payload.
+type Device struct {
+	ID string `json:"id"`
+	// Patients the device may report observations for
+	Patients []string    `json:"patients"`
+	Keys     []DeviceKey `json:"keys,omitempty"`
+	// CertFingerprints are hex SHA-256 digests of DER client certificates;
+	// CertSubjects match the certificate's common name
+	CertFingerprints []string `json:"cert_fingerprints,omitempty"`
+	CertSubjects     []string `json:"cert_subjects,omitempty"`
+	// HMACSecret, when set, makes a valid X-Signature mandatory
+	HMACSecret string `json:"hmac_secret,omitempty"`
+	Disabled   bool   `json:"disabled,omitempty"`
+}
+
+// DeviceKey is one API key of a device. Only the hex SHA-256 of the key is
+// stored; keys are random tokens, not passwords, so a plain digest is
+// enough. During rotation the old key gets an expiry while the new one is
+// added alongside it.
+type DeviceKey struct {
+	ID       string    `json:"id"`
+	SHA256   string    `json:"sha256"`
+	NotAfter time.Time `json:"not_after,omitempty"`
+}
+
+// CanReport reports whether d may send observations for patientID
+func (d *Device) CanReport(patientID string) bool {
+	for _, p := range d.Patients {
+		if p == AnyPatient || p == patientID {
+			return true
+		}
+	}
+	return false
+}
+
+// NewDeviceKey generates a random API key and the digest to put in the
+// registry
+func NewDeviceKey() (key, hash string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	key = "rpmdev_" + base64.RawURLEncoding.EncodeToString(raw)
+	return key, HashDeviceKey(key), nil
+}
+
+// HashDeviceKey returns the digest stored in the registry for key
+func HashDeviceKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// SignPayload computes the X-Signature value for body
+func SignPayload(secret, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + nonce + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeviceAuthenticator identifies the device behind an ingest request. body
+// is the raw request body, needed to check payload signatures.
+type DeviceAuthenticator interface {
+	AuthenticateDevice(r *http.Request, body []byte) (*Device, error)
+}
+
+type allowAllDevices struct{}
+
+// AllowAllDevices accepts every request as an anonymous device, one without
+// an ID, allowed to report for any patient. It is meant for local
+// development and tests only.
+func AllowAllDevices() DeviceAuthenticator { return allowAllDevices{} }
+
+func (allowAllDevices) AuthenticateDevice(r *http.Request, body []byte) (*Device, error) {
+	return &Device{Patients: []string{AnyPatient}}, nil
+}
+
+type deviceContextKey struct{}
+
+// WithDevice returns ctx carrying d
+func WithDevice(ctx context.Context, d *Device) context.Context {
+	return context.WithValue(ctx, deviceContextKey{}, d)
+}
+
+// DeviceFromContext returns the device stored by WithDevice, or nil
+func DeviceFromContext(ctx context.Context) *Device {
+	d, _ := ctx.Value(deviceContextKey{}).(*Device)
+	return d
+}
+
+// DeviceConfig selects how ingest authenticates devices
+type DeviceConfig struct {
+	Mode string
+	// Registry is the JSON device registry file
+	Registry string
+	// SignatureSkew bounds the age of a signed request; nonces are
+	// remembered for twice as long
+	SignatureSkew time.Duration
+	// Nonces records the nonces of signed requests. It is not read from
+	// the environment; every ingest replica must be given the same store.
+	Nonces repository.NonceRepository
+	// TLSCert and TLSKey enable HTTPS; ClientCA additionally asks clients
+	// for a certificate signed by it
+	TLSCert  string
+	TLSKey   string
+	ClientCA string
+}
+
+// DeviceConfigFromEnv reads DEVICE_AUTH (required by default),
+// DEVICE_REGISTRY, DEVICE_SIGNATURE_SKEW, INGEST_TLS_CERT, INGEST_TLS_KEY
+// and INGEST_CLIENT_CA
+func DeviceConfigFromEnv() DeviceConfig {
+	cfg := DeviceConfig{
+		Mode:          os.Getenv("DEVICE_AUTH"),
+		Registry:      os.Getenv("DEVICE_REGISTRY"),
+		SignatureSkew: 5 * time.Minute,
+		TLSCert:       os.Getenv("INGEST_TLS_CERT"),
+		TLSKey:        os.Getenv("INGEST_TLS_KEY"),
+		ClientCA:      os.Getenv("INGEST_CLIENT_CA"),
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = DeviceAuthRequired
+	}
+	if raw := os.Getenv("DEVICE_SIGNATURE_SKEW"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			cfg.SignatureSkew = d
+		} else {
+			log.Printf("invalid DEVICE_SIGNATURE_SKEW %q, defaulting to %s", raw, cfg.SignatureSkew)
+		}
+	}
+	return cfg
+}
+
+// NewDeviceAuthenticator builds the DeviceAuthenticator for cfg.Mode
+func NewDeviceAuthenticator(cfg DeviceConfig) (DeviceAuthenticator, error) {
+	switch cfg.Mode {
+	case DeviceAuthOff:
+		return AllowAllDevices(), nil
+	case DeviceAuthRequired:
+		if cfg.Registry == "" {
+			return nil, fmt.Errorf("auth: DEVICE_REGISTRY must be provided when DEVICE_AUTH=required")
+		}
+		if cfg.Nonces == nil {
+			return nil, fmt.Errorf("auth: DEVICE_AUTH=required needs a nonce store")
+		}
+		return OpenDeviceRegistry(cfg.Registry, cfg.SignatureSkew, cfg.Nonces)
+	}
+	return nil, fmt.Errorf("auth: unknown DEVICE_AUTH %q", cfg.Mode)
+}
+
+// TLSConfig returns the server TLS settings, or nil when TLS is not
+// configured. Client certificates are verified against ClientCA when they
+// are presented; devices without one fall back to API keys.
+func (cfg DeviceConfig) TLSConfig() (*tls.Config, error) {
+	if cfg.TLSCert == "" && cfg.TLSKey == "" {
+		if cfg.ClientCA != "" {
+			return nil, fmt.Errorf("auth: INGEST_CLIENT_CA requires INGEST_TLS_CERT and INGEST_TLS_KEY")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("auth: load TLS key pair: %w", err)
+	}
+	tlsCfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if cfg.ClientCA != "" {
+		raw, err := os.ReadFile(cfg.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("auth: read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, fmt.Errorf("auth: %s contains no PEM certificates", cfg.ClientCA)
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsCfg, nil
+}
+
+// DeviceRegistry authenticates devices listed in a JSON file of the form
+// {"devices": [Device, ...]}. The file is re-read when it changes, so keys
+// can be rotated and devices revoked without a restart.
+type DeviceRegistry struct {
+	path   string
+	skew   time.Duration
+	nonces repository.NonceRepository
+
+	mu      sync.RWMutex
+	modTime time.Time
+	checked time.Time
+	byKey   map[string]registeredKey
+	byCert  map[string]*Device
+	bySubj  map[string]*Device
+}
+
+type registeredKey struct {
+	device   *Device
+	notAfter time.Time
+}
+
+var _ DeviceAuthenticator = (*DeviceRegistry)(nil)
+
+// registryRecheck is how often the registry file's modification time is
+// checked
+const registryRecheck = 5 * time.Second
+
+// OpenDeviceRegistry loads the registry at path; signed requests older or
+// newer than skew are rejected, and so are nonces already claimed in nonces
+func OpenDeviceRegistry(path string, skew time.Duration, nonces repository.NonceRepository) (*DeviceRegistry, error) {
+	r := &DeviceRegistry{path: path, skew: skew, nonces: nonces}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: device registry: %w", err)
+	}
+	if err := r.load(info.ModTime()); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *DeviceRegistry) load(modTime time.Time) error {
+	raw, err := os.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("auth: device registry: %w", err)
+	}
+	var file struct {
+		Devices []*Device `json:"devices"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return fmt.Errorf("auth: device registry %s: %w", r.path, err)
+	}
+
+	byKey := make(map[string]registeredKey)
+	byCert := make(map[string]*Device)
+	bySubj := make(map[string]*Device)
+	seen := make(map[string]bool)
+	for _, d := range file.Devices {
+		if d.ID == "" {
+			return fmt.Errorf("auth: device registry %s: device without id", r.path)
+		}
+		if seen[d.ID] {
+			return fmt.Errorf("auth: device registry %s: duplicate device %s", r.path, d.ID)
+		}
+		seen[d.ID] = true
+		for _, k := range d.Keys {
+			byKey[strings.ToLower(k.SHA256)] = registeredKey{device: d, notAfter: k.NotAfter}
+		}
+		for _, fp := range d.CertFingerprints {
+			byCert[normalizeFingerprint(fp)] = d
+		}
+		for _, s := range d.CertSubjects {
+			bySubj[s] = d
+		}
+	}
+
+	r.mu.Lock()
+	r.byKey, r.byCert, r.bySubj = byKey, byCert, bySubj
+	r.modTime = modTime
+	r.mu.Unlock()
+	log.Printf("[Devices] loaded %d devices from %s", len(file.Devices), r.path)
+	return nil
+}
+
+// reload re-reads the file when its modification time changed. A broken
+// file is logged and the previous registry stays in effect.
+func (r *DeviceRegistry) reload() {
+	r.mu.RLock()
+	due := time.Since(r.checked) >= registryRecheck
+	r.mu.RUnlock()
+	if !due {
+		return
+	}
+	r.mu.Lock()
+	r.checked = time.Now()
+	modTime := r.modTime
+	r.mu.Unlock()
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		log.Printf("[Devices] %v", err)
+		return
+	}
+	if info.ModTime().Equal(modTime) {
+		return
+	}
+	if err := r.load(info.ModTime()); err != nil {
+		log.Printf("[Devices] keeping previous registry: %v", err)
+	}
+}
+
+// AuthenticateDevice identifies the device by client certificate and/or API
+// key, then checks the payload signature when the device has a secret
+func (r *DeviceRegistry) AuthenticateDevice(req *http.Request, body []byte) (*Device, error) {
+	r.reload()
+	now := time.Now()
+
+	var byCert, byKey *Device
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		leaf := req.TLS.VerifiedChains[0][0]
+		if byCert = r.deviceForCert(leaf); byCert == nil {
+			return nil, fmt.Errorf("%w: unknown client certificate %q", ErrUnauthenticated, leaf.Subject.CommonName)
+		}
+	}
+	if key := req.Header.Get(HeaderDeviceKey); key != "" {
+		if byKey = r.deviceForKey(key, now); byKey == nil {
+			return nil, fmt.Errorf("%w: unknown or expired device key", ErrUnauthenticated)
+		}
+	}
+
+	d := byCert
+	switch {
+	case byCert == nil && byKey == nil:
+		return nil, ErrUnauthenticated
+	case byCert == nil:
+		d = byKey
+	case byKey != nil && byKey != byCert:
+		return nil, fmt.Errorf("%w: client certificate and key belong to different devices", ErrUnauthenticated)
+	}
+	if d.Disabled {
+		return nil, fmt.Errorf("%w: device %s is disabled", ErrUnauthenticated, d.ID)
+	}
+	if d.HMACSecret != "" {
+		if err := r.checkSignature(req, d, body, now); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+func (r *DeviceRegistry) deviceForCert(cert *x509.Certificate) *Device {
+	sum := sha256.Sum256(cert.Raw)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if d := r.byCert[hex.EncodeToString(sum[:])]; d != nil {
+		return d
+	}
+	return r.bySubj[cert.Subject.CommonName]
+}
+
+func (r *DeviceRegistry) deviceForKey(key string, now time.Time) *Device {
+	r.mu.RLock()
+	k, ok := r.byKey[HashDeviceKey(key)]
+	r.mu.RUnlock()
+	if !ok || (!k.notAfter.IsZero() && now.After(k.notAfter)) {
+		return nil
+	}
+	return k.device
+}
+
+// checkSignature verifies X-Signature over timestamp, nonce and body and
+// rejects stale timestamps and reused nonces
+func (r *DeviceRegistry) checkSignature(req *http.Request, d *Device, body []byte, now time.Time) error {
+	sig := req.Header.Get(HeaderSignature)
+	ts := req.Header.Get(HeaderSignatureTimestamp)
+	nonce := req.Header.Get(HeaderSignatureNonce)
+	if sig == "" || ts == "" || nonce == "" {
+		return fmt.Errorf("%w: device %s must sign its payloads", ErrUnauthenticated, d.ID)
+	}
+	secs, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed %s", ErrUnauthenticated, HeaderSignatureTimestamp)
+	}
+	if age := now.Sub(time.Unix(secs, 0)); age > r.skew || age < -r.skew {
+		return fmt.Errorf("%w: signature timestamp outside the allowed window", ErrUnauthenticated)
+	}
+	if !hmac.Equal([]byte(sig), []byte(SignPayload(d.HMACSecret, ts, nonce, body))) {
+		return fmt.Errorf("%w: bad payload signature", ErrUnauthenticated)
+	}
+
+	// a replay is stale once its timestamp is skew behind now, and the
+	// timestamp may itself be skew ahead
+	fresh, err := r.nonces.Claim(req.Context(), d.ID+"/"+nonce, now, now.Add(2*r.skew))
+	if err != nil {
+		return fmt.Errorf("auth: record nonce of device %s: %w", d.ID, err)
+	}
+	if !fresh {
+		return fmt.Errorf("%w: replayed nonce", ErrUnauthenticated)
+	}
+	return nil
+}
+
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(fp, ":", ""))
+}
@@ -0,0 +1,160 @@
+package auth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+	rpmtesting "github.com/lioarce01/remote-patient-monitoring-system/pkg/common/testing"
+)
+
+func TestSignPayload(t *testing.T) {
+	body := []byte(`{"patient_id":"p1"}`)
+	base := auth.SignPayload("secret", "1700000000", "n1", body)
+	if !strings.HasPrefix(base, "sha256=") || len(base) != len("sha256=")+64 {
+		t.Fatalf("signature %q is not sha256=<64 hex digits>", base)
+	}
+	if again := auth.SignPayload("secret", "1700000000", "n1", body); again != base {
+		t.Fatalf("signature is not deterministic: %q then %q", base, again)
+	}
+
+	// changing any input changes the signature
+	cases := []struct {
+		name                     string
+		secret, timestamp, nonce string
+		body                     []byte
+	}{
+		{"secret", "other", "1700000000", "n1", body},
+		{"timestamp", "secret", "1700000001", "n1", body},
+		{"nonce", "secret", "1700000000", "n2", body},
+		{"body", "secret", "1700000000", "n1", []byte(`{"patient_id":"p2"}`)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := auth.SignPayload(tc.secret, tc.timestamp, tc.nonce, tc.body); got == base {
+				t.Fatalf("changing the %s kept the signature %q", tc.name, got)
+			}
+		})
+	}
+}
+
+func TestDeviceRegistrySignature(t *testing.T) {
+	const (
+		key    = "rpmdev_test-key"
+		secret = "device-secret"
+		skew   = time.Minute
+	)
+	path := filepath.Join(t.TempDir(), "devices.json")
+	registry := `{"devices": [{"id": "dev-1", "patients": ["p1"], "hmac_secret": "` + secret + `",
+		"keys": [{"id": "k1", "sha256": "` + auth.HashDeviceKey(key) + `"}]}]}`
+	if err := os.WriteFile(path, []byte(registry), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := auth.OpenDeviceRegistry(path, skew, rpmtesting.NewNonceRepo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(`{"patient_id":"p1","heart_rate":72}`)
+	now := time.Now()
+	signed := func(nonce string, at time.Time, payload []byte) http.Header {
+		ts := strconv.FormatInt(at.Unix(), 10)
+		h := http.Header{}
+		h.Set(auth.HeaderDeviceKey, key)
+		h.Set(auth.HeaderSignatureTimestamp, ts)
+		h.Set(auth.HeaderSignatureNonce, nonce)
+		h.Set(auth.HeaderSignature, auth.SignPayload(secret, ts, nonce, payload))
+		return h
+	}
+	without := func(h http.Header, name string) http.Header {
+		h.Del(name)
+		return h
+	}
+	with := func(h http.Header, name, value string) http.Header {
+		h.Set(name, value)
+		return h
+	}
+
+	// cases share the registry and run in order, so nonces must be unique
+	// unless a case replays one on purpose
+	cases := []struct {
+		name   string
+		header http.Header
+		body   []byte
+		ok     bool
+	}{
+		{"valid", signed("n-valid", now, body), body, true},
+		{"replayed nonce", signed("n-valid", now, body), body, false},
+		{"fresh nonce", signed("n-fresh", now, body), body, true},
+		{"body changed", signed("n-body", now, body), []byte(`{"patient_id":"p1","heart_rate":180}`), false},
+		{"wrong secret", with(signed("n-secret", now, body), auth.HeaderSignature,
+			auth.SignPayload("other", strconv.FormatInt(now.Unix(), 10), "n-secret", body)), body, false},
+		{"nonce changed", with(signed("n-orig", now, body), auth.HeaderSignatureNonce, "n-other"), body, false},
+		{"within skew", signed("n-recent", now.Add(-skew/2), body), body, true},
+		{"stale", signed("n-stale", now.Add(-2*skew), body), body, false},
+		{"future", signed("n-future", now.Add(2*skew), body), body, false},
+		{"malformed timestamp", with(signed("n-ts", now, body), auth.HeaderSignatureTimestamp, "yesterday"), body, false},
+		{"missing signature", without(signed("n-nosig", now, body), auth.HeaderSignature), body, false},
+		{"missing timestamp", without(signed("n-nots", now, body), auth.HeaderSignatureTimestamp), body, false},
+		{"missing nonce", without(signed("n-nononce", now, body), auth.HeaderSignatureNonce), body, false},
+		{"unknown key", with(signed("n-key", now, body), auth.HeaderDeviceKey, "rpmdev_other"), body, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/observations", nil)
+			req.Header = tc.header
+			d, err := r.AuthenticateDevice(req, tc.body)
+			switch {
+			case tc.ok && err != nil:
+				t.Fatalf("rejected: %v", err)
+			case tc.ok && d.ID != "dev-1":
+				t.Fatalf("authenticated as %q, want dev-1", d.ID)
+			case !tc.ok && !errors.Is(err, auth.ErrUnauthenticated):
+				t.Fatalf("got device %v and error %v, want ErrUnauthenticated", d, err)
+			}
+		})
+	}
+}
+
+func TestDeviceRegistrySharedNonces(t *testing.T) {
+	const key, secret = "rpmdev_test-key", "device-secret"
+	path := filepath.Join(t.TempDir(), "devices.json")
+	registry := `{"devices": [{"id": "dev-1", "patients": ["p1"], "hmac_secret": "` + secret + `",
+		"keys": [{"id": "k1", "sha256": "` + auth.HashDeviceKey(key) + `"}]}]}`
+	if err := os.WriteFile(path, []byte(registry), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// two ingest replicas given the same store
+	nonces := rpmtesting.NewNonceRepo()
+	replicas := make([]*auth.DeviceRegistry, 2)
+	for i := range replicas {
+		r, err := auth.OpenDeviceRegistry(path, time.Minute, nonces)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replicas[i] = r
+	}
+
+	body := []byte(`{"patient_id":"p1"}`)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/observations", nil)
+	req.Header.Set(auth.HeaderDeviceKey, key)
+	req.Header.Set(auth.HeaderSignatureTimestamp, ts)
+	req.Header.Set(auth.HeaderSignatureNonce, "n1")
+	req.Header.Set(auth.HeaderSignature, auth.SignPayload(secret, ts, "n1", body))
+
+	if _, err := replicas[0].AuthenticateDevice(req, body); err != nil {
+		t.Fatalf("first request rejected: %v", err)
+	}
+	if _, err := replicas[1].AuthenticateDevice(req, body); !errors.Is(err, auth.ErrUnauthenticated) {
+		t.Fatalf("replay against the other replica got %v, want ErrUnauthenticated", err)
+	}
+}
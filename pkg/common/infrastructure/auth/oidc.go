@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+// Authentication modes
+const (
+	ModeOIDC    = "oidc"
+	ModeKeyFile = "keyfile"
+	ModeOff     = "off"
+)
+
+// Config selects how bearer tokens are verified
+type Config struct {
+	Mode string
+	// Issuer is the OIDC issuer URL; with a key file it is optional and,
+	// when set, must match the token's iss claim
+	Issuer string
+	// Audience must appear in the token's aud claim; empty skips the check
+	Audience string
+	// KeyFile is a PEM public key (or certificate) used instead of the
+	// issuer's JWKS
+	KeyFile string
+	// RolesClaim and CareTeamsClaim name the claims holding roles and care
+	// teams; dots address nested objects, e.g. realm_access.roles
+	RolesClaim     string
+	CareTeamsClaim string
+	// AllowedOrigins may open WebSocket connections besides the API's own
+	AllowedOrigins []string
+}
+
+// ConfigFromEnv reads AUTH_MODE (oidc by default), OIDC_ISSUER,
+// OIDC_AUDIENCE, AUTH_KEY_FILE, AUTH_ROLES_CLAIM, AUTH_CARE_TEAMS_CLAIM and
+// WS_ALLOWED_ORIGINS (comma separated)
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Mode:           os.Getenv("AUTH_MODE"),
+		Issuer:         os.Getenv("OIDC_ISSUER"),
+		Audience:       os.Getenv("OIDC_AUDIENCE"),
+		KeyFile:        os.Getenv("AUTH_KEY_FILE"),
+		RolesClaim:     os.Getenv("AUTH_ROLES_CLAIM"),
+		CareTeamsClaim: os.Getenv("AUTH_CARE_TEAMS_CLAIM"),
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = ModeOIDC
+	}
+	if cfg.RolesClaim == "" {
+		cfg.RolesClaim = "roles"
+	}
+	if cfg.CareTeamsClaim == "" {
+		cfg.CareTeamsClaim = "care_teams"
+	}
+	for _, o := range strings.Split(os.Getenv("WS_ALLOWED_ORIGINS"), ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			cfg.AllowedOrigins = append(cfg.AllowedOrigins, o)
+		}
+	}
+	return cfg
+}
+
+type tokenVerifier struct {
+	verifier       *oidc.IDTokenVerifier
+	rolesClaim     string
+	careTeamsClaim string
+}
+
+// NewVerifier builds the Verifier for cfg.Mode. In oidc mode the issuer's
+// discovery document is fetched, so the provider must be reachable.
+func NewVerifier(ctx context.Context, cfg Config) (Verifier, error) {
+	oidcCfg := &oidc.Config{ClientID: cfg.Audience, SkipClientIDCheck: cfg.Audience == ""}
+
+	var verifier *oidc.IDTokenVerifier
+	switch cfg.Mode {
+	case ModeOff:
+		return AllowAll(), nil
+	case ModeOIDC:
+		if cfg.Issuer == "" {
+			return nil, fmt.Errorf("auth: OIDC_ISSUER must be provided in oidc mode")
+		}
+		provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("auth: oidc discovery failed: %w", err)
+		}
+		verifier = provider.Verifier(oidcCfg)
+	case ModeKeyFile:
+		key, algs, err := loadPublicKey(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		oidcCfg.SupportedSigningAlgs = algs
+		oidcCfg.SkipIssuerCheck = cfg.Issuer == ""
+		verifier = oidc.NewVerifier(cfg.Issuer, &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{key}}, oidcCfg)
+	default:
+		return nil, fmt.Errorf("auth: unknown AUTH_MODE %q", cfg.Mode)
+	}
+
+	return &tokenVerifier{verifier: verifier, rolesClaim: cfg.RolesClaim, careTeamsClaim: cfg.CareTeamsClaim}, nil
+}
+
+func (v *tokenVerifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+	idToken, err := v.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+	return &Principal{
+		Subject:   idToken.Subject,
+		Roles:     stringsClaim(claims, v.rolesClaim),
+		CareTeams: stringsClaim(claims, v.careTeamsClaim),
+	}, nil
+}
+
+// stringsClaim reads a string or string-list claim at a dotted path
+func stringsClaim(claims map[string]interface{}, path string) []string {
+	var v interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[part]
+	}
+	switch t := v.(type) {
+	case string:
+		return strings.Fields(t)
+	case []interface{}:
+		out := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// loadPublicKey reads a PEM public key or certificate and returns the JWS
+// algorithms it can verify
+func loadPublicKey(path string) (crypto.PublicKey, []string, error) {
+	if path == "" {
+		return nil, nil, fmt.Errorf("auth: AUTH_KEY_FILE must be provided in keyfile mode")
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("auth: read key file: %w", err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, nil, fmt.Errorf("auth: %s is not PEM encoded", path)
+	}
+
+	var key crypto.PublicKey
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("auth: parse certificate: %w", err)
+		}
+		key = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		if key, err = x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+			return nil, nil, fmt.Errorf("auth: parse key: %w", err)
+		}
+	default:
+		if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, nil, fmt.Errorf("auth: parse key: %w", err)
+		}
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return key, []string{oidc.RS256, oidc.RS384, oidc.RS512, oidc.PS256, oidc.PS384, oidc.PS512}, nil
+	case *ecdsa.PublicKey:
+		return key, []string{oidc.ES256, oidc.ES384, oidc.ES512}, nil
+	case ed25519.PublicKey:
+		return key, []string{oidc.EdDSA}, nil
+	}
+	return nil, nil, fmt.Errorf("auth: unsupported key type %T", key)
+}
@@ -0,0 +1,107 @@
+// Package broker selects the message broker implementation from config so
+// services depend only on repository.Publisher and repository.Subscriber.
+package broker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/kafka"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/nats"
+)
+
+const (
+	DriverKafka = "kafka"
+	DriverNATS  = "nats"
+)
+
+type Config struct {
+	Driver       string
+	KafkaBrokers []string
+	NATSURL      string
+}
+
+// ConfigFromEnv reads BROKER_DRIVER (kafka by default), KAFKA_BROKERS and NATS_URL
+func ConfigFromEnv() Config {
+	driver := os.Getenv("BROKER_DRIVER")
+	if driver == "" {
+		driver = DriverKafka
+	}
+	return Config{
+		Driver:       driver,
+		KafkaBrokers: strings.Split(os.Getenv("KAFKA_BROKERS"), ","),
+		NATSURL:      os.Getenv("NATS_URL"),
+	}
+}
+
+// Publisher is a repository.Publisher that must be closed to flush pending writes
+type Publisher interface {
+	repository.Publisher
+	io.Closer
+}
+
+func NewPublisher(ctx context.Context, cfg Config, topic string) (Publisher, error) {
+	switch cfg.Driver {
+	case DriverKafka:
+		return kafka.NewKafkaPublisher(cfg.KafkaBrokers, topic), nil
+	case DriverNATS:
+		return nats.NewJetStreamPublisher(ctx, cfg.NATSURL, topic)
+	default:
+		return nil, fmt.Errorf("broker: unknown driver %q", cfg.Driver)
+	}
+}
+
+func NewSubscriber(ctx context.Context, cfg Config, topic, group string) (repository.Subscriber, error) {
+	switch cfg.Driver {
+	case DriverKafka:
+		return kafka.NewKafkaConsumer(cfg.KafkaBrokers, topic, group), nil
+	case DriverNATS:
+		return nats.NewJetStreamSubscriber(ctx, cfg.NATSURL, topic, group)
+	default:
+		return nil, fmt.Errorf("broker: unknown driver %q", cfg.Driver)
+	}
+}
+
+// broadcastExpiry is how long the JetStream consumer of a departed replica
+// is kept
+const broadcastExpiry = time.Hour
+
+// ReplicaID reads REPLICA_ID, falling back to the hostname, which is unique
+// per container and pod
+func ReplicaID() string {
+	if id := os.Getenv("REPLICA_ID"); id != "" {
+		return id
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		log.Fatalf("REPLICA_ID is not set and the hostname is unavailable: %v", err)
+	}
+	return host
+}
+
+// BroadcastGroup is the consumer group of one replica, so that replicas
+// running a broadcast subscriber do not share a group
+func BroadcastGroup(group, replica string) string {
+	return group + "-" + replica
+}
+
+// NewBroadcastSubscriber subscribes replica to topic in a group of its own,
+// so every replica receives every message. A new group starts at the newest
+// message rather than replaying the topic.
+func NewBroadcastSubscriber(ctx context.Context, cfg Config, topic, group, replica string) (repository.Subscriber, error) {
+	group = BroadcastGroup(group, replica)
+	switch cfg.Driver {
+	case DriverKafka:
+		return kafka.NewKafkaConsumer(cfg.KafkaBrokers, topic, group, kafka.StartAtNewest()), nil
+	case DriverNATS:
+		return nats.NewJetStreamSubscriber(ctx, cfg.NATSURL, topic, group, nats.ExpireAfter(broadcastExpiry))
+	default:
+		return nil, fmt.Errorf("broker: unknown driver %q", cfg.Driver)
+	}
+}
@@ -0,0 +1,140 @@
+// Package bus is an in-process replacement for Kafka, used when every
+// service runs inside one binary.
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+)
+
+const queueSize = 1024
+
+type message struct {
+	key   []byte
+	value []byte
+}
+
+// Bus routes messages by topic. Subscribers that share a group compete for
+// messages; each group receives every message published on its topic.
+type Bus struct {
+	mu     sync.Mutex
+	groups map[string]map[string]chan message // topic -> group -> queue
+}
+
+func New() *Bus {
+	return &Bus{groups: make(map[string]map[string]chan message)}
+}
+
+// Publisher returns a publisher bound to topic
+func (b *Bus) Publisher(topic string) *Publisher {
+	return &Publisher{bus: b, topic: topic}
+}
+
+// Subscriber returns a subscriber of topic in the given group. Only messages
+// published after the group's first subscriber is created are delivered.
+func (b *Bus) Subscriber(topic, group string) *Subscriber {
+	return &Subscriber{queue: b.queue(topic, group)}
+}
+
+func (b *Bus) queue(topic, group string) chan message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.groups[topic] == nil {
+		b.groups[topic] = make(map[string]chan message)
+	}
+	q, ok := b.groups[topic][group]
+	if !ok {
+		q = make(chan message, queueSize)
+		b.groups[topic][group] = q
+	}
+	return q
+}
+
+func (b *Bus) publish(ctx context.Context, topic string, msg message) error {
+	b.mu.Lock()
+	queues := make([]chan message, 0, len(b.groups[topic]))
+	for _, q := range b.groups[topic] {
+		queues = append(queues, q)
+	}
+	b.mu.Unlock()
+
+	for _, q := range queues {
+		select {
+		case q <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+var _ repository.Publisher = (*Publisher)(nil)
+
+// Publisher implements repository.Publisher for a Bus topic
+type Publisher struct {
+	bus   *Bus
+	topic string
+}
+
+func (p *Publisher) PublishObservation(ctx context.Context, obs *entities.ObservationRecord) error {
+	msg, err := json.Marshal(obs)
+	if err != nil {
+		return err
+	}
+	return p.bus.publish(ctx, p.topic, message{key: []byte(obs.PatientID), value: msg})
+}
+
+func (p *Publisher) PublishAlert(ctx context.Context, alert *entities.Alert) error {
+	msg, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	return p.bus.publish(ctx, p.topic, message{key: []byte(alert.PatientID), value: msg})
+}
+
+func (p *Publisher) PublishFHIR(ctx context.Context, payload []byte) error {
+	return p.bus.publish(ctx, p.topic, message{value: payload})
+}
+
+func (p *Publisher) Close() error { return nil }
+
+var _ repository.Subscriber = (*Subscriber)(nil)
+
+// Subscriber implements repository.Subscriber for a Bus topic and group
+type Subscriber struct {
+	queue chan message
+}
+
+// Consume delivers messages to handler until ctx is cancelled. A failed
+// message is retried in place until handler succeeds; it is dropped when
+// ctx is cancelled, as the bus keeps nothing across restarts.
+func (s *Subscriber) Consume(ctx context.Context, handler func(key, val []byte) error) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg := <-s.queue:
+			for attempt := 1; ; attempt++ {
+				err := handler(msg.key, msg.value)
+				if err == nil {
+					break
+				}
+				delay := repository.RedeliveryDelay(attempt)
+				log.Printf("[Bus] handler error, retrying in %s: %v", delay, err)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(delay):
+				}
+			}
+		}
+	}
+}
+
+func (s *Subscriber) Close() error { return nil }
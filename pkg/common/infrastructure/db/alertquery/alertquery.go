@@ -0,0 +1,90 @@
+// Package alertquery runs repository.AlertQuery against the GORM alerts
+// and patients tables. It is shared by the PostgreSQL and SQLite stores.
+package alertquery
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"gorm.io/gorm"
+)
+
+// Page returns the page of alerts selected by q. Pages are read with a
+// keyset on (timestamp, id), so they stay stable while new alerts arrive.
+func Page(ctx context.Context, db *gorm.DB, q repository.AlertQuery) (repository.AlertPage, error) {
+	if err := q.Validate(); err != nil {
+		return repository.AlertPage{}, err
+	}
+
+	filtered := func() *gorm.DB {
+		tx := db.WithContext(ctx).Model(&entities.Alert{})
+		if q.Ward != "" || q.Unit != "" {
+			tx = tx.Joins("JOIN patients ON patients.id = alerts.patient_id")
+			if q.Ward != "" {
+				tx = tx.Where("patients.ward = ?", q.Ward)
+			}
+			if q.Unit != "" {
+				tx = tx.Where("patients.unit = ?", q.Unit)
+			}
+		}
+		if q.CareTeams != nil {
+			if len(q.CareTeams) == 0 {
+				tx = tx.Where("1 = 0")
+			} else {
+				tx = tx.Where("alerts.patient_id IN (SELECT patient_id FROM patient_care_teams WHERE care_team IN ?)", q.CareTeams)
+			}
+		}
+		if q.PatientID != "" {
+			tx = tx.Where("alerts.patient_id = ?", q.PatientID)
+		}
+		if q.Type != "" {
+			tx = tx.Where("alerts.type = ?", q.Type)
+		}
+		if q.Severity != "" {
+			tx = tx.Where("alerts.severity = ?", q.Severity)
+		}
+		if q.Acknowledged != nil {
+			tx = tx.Where("alerts.acknowledged = ?", *q.Acknowledged)
+		}
+		if q.Resolved != nil {
+			tx = tx.Where("alerts.resolved = ?", *q.Resolved)
+		}
+		if !q.From.IsZero() {
+			tx = tx.Where("alerts.timestamp >= ?", q.From)
+		}
+		if !q.To.IsZero() {
+			tx = tx.Where("alerts.timestamp <= ?", q.To)
+		}
+		return tx
+	}
+
+	page := repository.AlertPage{Alerts: []entities.Alert{}}
+	if err := filtered().Count(&page.Total).Error; err != nil {
+		return page, fmt.Errorf("count alerts: %w", err)
+	}
+
+	order, cmp := "DESC", "<"
+	if q.Ascending {
+		order, cmp = "ASC", ">"
+	}
+	tx := filtered().Select("alerts.*")
+	if q.Cursor != "" {
+		c, _ := repository.DecodeAlertCursor(q.Cursor)
+		tx = tx.Where(fmt.Sprintf("(alerts.timestamp, alerts.id) %s (?, ?)", cmp), c.Timestamp, c.ID)
+	}
+	// one extra row tells whether there is a next page
+	err := tx.Order(fmt.Sprintf("alerts.timestamp %s, alerts.id %s", order, order)).
+		Limit(q.Limit + 1).
+		Find(&page.Alerts).Error
+	if err != nil {
+		return page, fmt.Errorf("query alerts: %w", err)
+	}
+
+	if len(page.Alerts) > q.Limit {
+		page.Alerts = page.Alerts[:q.Limit]
+		page.NextCursor = repository.EncodeAlertCursor(page.Alerts[q.Limit-1])
+	}
+	return page, nil
+}
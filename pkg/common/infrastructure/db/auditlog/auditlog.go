@@ -0,0 +1,101 @@
+// Package auditlog stores the hash-chained audit log in the GORM audit_log
+// table. It is shared by the PostgreSQL and SQLite stores.
+package auditlog
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"gorm.io/gorm"
+)
+
+// verifyBatch is how many events Verify reads at a time
+const verifyBatch = 1000
+
+// Append chains e after the newest event inside one transaction. lock must
+// serialize appends across every writer of the table, or two events could
+// claim the same predecessor.
+func Append(ctx context.Context, db *gorm.DB, e *entities.AuditEvent, lock func(tx *gorm.DB) error) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lock(tx); err != nil {
+			return err
+		}
+		var prev []string
+		if err := tx.Model(&entities.AuditEvent{}).Order("seq DESC").Limit(1).Pluck("hash", &prev).Error; err != nil {
+			return err
+		}
+		head := ""
+		if len(prev) > 0 {
+			head = prev[0]
+		}
+		e.Seq = 0
+		e.Seal(head)
+		return tx.Create(e).Error
+	})
+}
+
+// Page returns the events selected by q, newest first
+func Page(ctx context.Context, db *gorm.DB, q repository.AuditQuery) (repository.AuditPage, error) {
+	if err := q.Validate(); err != nil {
+		return repository.AuditPage{}, err
+	}
+
+	tx := db.WithContext(ctx).Model(&entities.AuditEvent{})
+	if before, _ := q.BeforeSeq(); before > 0 {
+		tx = tx.Where("seq < ?", before)
+	}
+	if q.Actor != "" {
+		tx = tx.Where("actor = ?", q.Actor)
+	}
+	if q.PatientID != "" {
+		tx = tx.Where("patient_id = ?", q.PatientID)
+	}
+	if q.Action != "" {
+		tx = tx.Where("action = ?", q.Action)
+	}
+	if !q.From.IsZero() {
+		tx = tx.Where("occurred_at >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		tx = tx.Where("occurred_at <= ?", q.To)
+	}
+
+	// one extra row tells whether another page follows
+	var events []entities.AuditEvent
+	if err := tx.Order("seq DESC").Limit(q.Limit + 1).Find(&events).Error; err != nil {
+		return repository.AuditPage{}, err
+	}
+	page := repository.AuditPage{Events: events}
+	if len(events) > q.Limit {
+		page.Events = events[:q.Limit]
+		page.NextCursor = strconv.FormatInt(page.Events[q.Limit-1].Seq, 10)
+	}
+	if page.Events == nil {
+		page.Events = []entities.AuditEvent{}
+	}
+	return page, nil
+}
+
+// Verify walks the chain in Seq order
+func Verify(ctx context.Context, db *gorm.DB) (repository.AuditVerification, error) {
+	v := repository.NewAuditVerification()
+	var after int64
+	for {
+		var events []entities.AuditEvent
+		err := db.WithContext(ctx).Where("seq > ?", after).Order("seq").Limit(verifyBatch).Find(&events).Error
+		if err != nil {
+			return v, err
+		}
+		for _, e := range events {
+			if !v.Add(e) {
+				return v, nil
+			}
+		}
+		if len(events) < verifyBatch {
+			return v, nil
+		}
+		after = events[len(events)-1].Seq
+	}
+}
@@ -0,0 +1,80 @@
+package auditlog_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/auditlog"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestVerify(t *testing.T) {
+	cases := []struct {
+		name string
+		// tamper edits the stored chain of events with Seq 1 to 3
+		tamper   func(tx *gorm.DB) error
+		valid    bool
+		brokenAt int64
+	}{
+		{"intact", func(tx *gorm.DB) error { return nil }, true, 0},
+		{"edited field", func(tx *gorm.DB) error {
+			return tx.Model(&entities.AuditEvent{}).Where("seq = ?", 2).Update("actor", "someone-else").Error
+		}, false, 2},
+		{"edited and rehashed", func(tx *gorm.DB) error {
+			var e entities.AuditEvent
+			if err := tx.First(&e, 2).Error; err != nil {
+				return err
+			}
+			e.Outcome = entities.OutcomeSuccess
+			e.Seal(e.PrevHash)
+			return tx.Save(&e).Error
+		}, false, 3},
+		{"deleted event", func(tx *gorm.DB) error {
+			return tx.Delete(&entities.AuditEvent{}, 2).Error
+		}, false, 3},
+		{"first event replaced", func(tx *gorm.DB) error {
+			return tx.Model(&entities.AuditEvent{}).Where("seq = ?", 1).Update("prev_hash", "forged").Error
+		}, false, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, err := sqlite.Open(filepath.Join(t.TempDir(), "audit.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sqlite.Close(store)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			noLock := func(tx *gorm.DB) error { return nil }
+			for i, outcome := range []string{entities.OutcomeSuccess, entities.OutcomeDenied, entities.OutcomeSuccess} {
+				e := &entities.AuditEvent{Time: time.Now(), Actor: "nurse-1", Action: entities.AuditRead, PatientID: "p1", Resource: "/patients/p1", Status: 200 + i, Outcome: outcome}
+				if err := auditlog.Append(ctx, store, e, noLock); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// the append-only triggers stop the application, not someone with
+			// direct access to the database file
+			for _, trigger := range []string{"audit_log_no_update", "audit_log_no_delete"} {
+				if err := store.Exec("DROP TRIGGER " + trigger).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tc.tamper(store.WithContext(ctx)); err != nil {
+				t.Fatal(err)
+			}
+
+			v, err := auditlog.Verify(ctx, store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Valid != tc.valid || v.BrokenAt != tc.brokenAt {
+				t.Fatalf("got valid=%v broken_at=%d, want valid=%v broken_at=%d", v.Valid, v.BrokenAt, tc.valid, tc.brokenAt)
+			}
+		})
+	}
+}
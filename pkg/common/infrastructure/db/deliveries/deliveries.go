@@ -0,0 +1,60 @@
+// Package deliveries stores alert notification deliveries in the GORM
+// notification_deliveries table. It is shared by the PostgreSQL and SQLite
+// stores.
+package deliveries
+
+import (
+	"context"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Enqueue inserts ds, skipping deliveries that are already stored
+func Enqueue(ctx context.Context, db *gorm.DB, ds []entities.NotificationDelivery) error {
+	if len(ds) == 0 {
+		return nil
+	}
+	return db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&ds).Error
+}
+
+// Claim postpones up to limit due pending deliveries by lease inside one
+// transaction and returns them. With skipLocked, rows another transaction
+// is claiming are passed over instead of waited for; it requires a
+// database with FOR UPDATE SKIP LOCKED.
+func Claim(ctx context.Context, db *gorm.DB, now time.Time, lease time.Duration, limit int, skipLocked bool) ([]entities.NotificationDelivery, error) {
+	var claimed []entities.NotificationDelivery
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		q := tx.Where("status = ? AND next_attempt_at <= ?", entities.DeliveryPending, now).
+			Order("next_attempt_at").Limit(limit)
+		if skipLocked {
+			q = q.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := q.Find(&claimed).Error; err != nil || len(claimed) == 0 {
+			return err
+		}
+		ids := make([]string, len(claimed))
+		until := now.Add(lease)
+		for i := range claimed {
+			ids[i] = claimed[i].ID
+			claimed[i].NextAttemptAt = until
+		}
+		return tx.Model(&entities.NotificationDelivery{}).Where("id IN ?", ids).
+			Update("next_attempt_at", until).Error
+	})
+	return claimed, err
+}
+
+// Update stores every field of d
+func Update(ctx context.Context, db *gorm.DB, d *entities.NotificationDelivery) error {
+	return db.WithContext(ctx).Save(d).Error
+}
+
+// FetchByAlert returns the deliveries of alertID, oldest first
+func FetchByAlert(ctx context.Context, db *gorm.DB, alertID string) ([]entities.NotificationDelivery, error) {
+	var ds []entities.NotificationDelivery
+	err := db.WithContext(ctx).Where("alert_id = ?", alertID).Order("created_at, id").Find(&ds).Error
+	return ds, err
+}
@@ -0,0 +1,62 @@
+// Package escalations stores alert escalation timers in the GORM
+// alert_escalations table. It is shared by the PostgreSQL and SQLite
+// stores.
+package escalations
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Start inserts e, skipping it when the alert already has an escalation
+func Start(ctx context.Context, db *gorm.DB, e *entities.Escalation) error {
+	return db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(e).Error
+}
+
+// Claim postpones up to limit due active escalations by lease inside one
+// transaction and returns them. skipLocked is as in deliveries.Claim.
+func Claim(ctx context.Context, db *gorm.DB, now time.Time, lease time.Duration, limit int, skipLocked bool) ([]entities.Escalation, error) {
+	var claimed []entities.Escalation
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		q := tx.Where("status = ? AND due_at <= ?", entities.EscalationActive, now).
+			Order("due_at").Limit(limit)
+		if skipLocked {
+			q = q.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := q.Find(&claimed).Error; err != nil || len(claimed) == 0 {
+			return err
+		}
+		ids := make([]string, len(claimed))
+		until := now.Add(lease)
+		for i := range claimed {
+			ids[i] = claimed[i].ID
+			claimed[i].DueAt = until
+		}
+		return tx.Model(&entities.Escalation{}).Where("id IN ?", ids).
+			Update("due_at", until).Error
+	})
+	return claimed, err
+}
+
+// Update stores every field of e
+func Update(ctx context.Context, db *gorm.DB, e *entities.Escalation) error {
+	return db.WithContext(ctx).Save(e).Error
+}
+
+// FetchByAlert returns the escalation of alertID, or nil
+func FetchByAlert(ctx context.Context, db *gorm.DB, alertID string) (*entities.Escalation, error) {
+	var e entities.Escalation
+	err := db.WithContext(ctx).First(&e, "id = ?", entities.EscalationID(alertID)).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
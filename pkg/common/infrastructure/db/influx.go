@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	client "github.com/influxdata/influxdb1-client/v2"
@@ -13,11 +14,12 @@ import (
 )
 
 type InfluxRepo struct {
-	client client.Client
-	db     string
+	client   client.Client
+	db       string
+	policies []RetentionPolicy
 }
 
-func NewInfluxRepo(addr, db, user, pass string) (repository.ObservationRepository, error) {
+func NewInfluxRepo(addr, db, user, pass string, opts ...InfluxOption) (*InfluxRepo, error) {
 	if addr == "" || db == "" {
 		return nil, fmt.Errorf("influxdb: addr and db must be provided")
 	}
@@ -27,44 +29,162 @@ func NewInfluxRepo(addr, db, user, pass string) (repository.ObservationRepositor
 	if err != nil {
 		return nil, fmt.Errorf("influxdb: client init failed: %w", err)
 	}
-	return &InfluxRepo{client: c, db: db}, nil
+	r := &InfluxRepo{client: c, db: db}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
 }
 
+// Points are written to the "vitals" measurement with one numeric "value"
+// field and a "status" field. Everything needed to rebuild the FHIR
+// Observation is kept in tags.
+const (
+	measurement = "vitals"
+
+	tagPatientID     = "patient_id"
+	tagCode          = "code"
+	tagUnit          = "unit"
+	tagDeviceID      = "device_id"
+	tagObservationID = "observation_id"
+
+	fieldValue  = "value"
+	fieldStatus = "status"
+)
+
 func (r *InfluxRepo) Save(ctx context.Context, record *entities.ObservationRecord) error {
-	timestamp := record.EffectiveDateTime
+	log.Printf("[InfluxRepo] Saving metric: %s=%f", record.CodeText, record.Value)
+	return r.write([]*entities.ObservationRecord{record})
+}
 
-	fields := map[string]interface{}{
-		record.CodeText: record.Value,
+// SaveBatch writes records in one request
+func (r *InfluxRepo) SaveBatch(ctx context.Context, records []*entities.ObservationRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	log.Printf("[InfluxRepo] Saving batch of %d metrics", len(records))
+	return r.write(records)
+}
+
+func (r *InfluxRepo) write(records []*entities.ObservationRecord) error {
+	bp, _ := client.NewBatchPoints(client.BatchPointsConfig{Database: r.db, RetentionPolicy: r.rawPolicy(), Precision: "s"})
+	for _, record := range records {
+		pt, err := client.NewPoint(measurement, observationTags(record), observationFields(record), record.EffectiveDateTime)
+		if err != nil {
+			return fmt.Errorf("influxdb: invalid point: %w", err)
+		}
+		bp.AddPoint(pt)
 	}
+	return r.client.Write(bp)
+}
 
-	bp, _ := client.NewBatchPoints(client.BatchPointsConfig{Database: r.db, Precision: "s"})
-	pt, _ := client.NewPoint(
-		"vitals",
-		map[string]string{"patient_id": record.PatientID},
-		fields,
-		timestamp,
-	)
+// observationTags and observationFields map a record to the tags and fields
+// of its point, shared by both InfluxDB versions
+func observationTags(record *entities.ObservationRecord) map[string]string {
+	tags := map[string]string{
+		tagPatientID:     record.PatientID,
+		tagCode:          record.CodeText,
+		tagUnit:          record.Unit,
+		tagObservationID: record.ID,
+	}
+	if record.DeviceID != "" {
+		tags[tagDeviceID] = record.DeviceID
+	}
+	return tags
+}
 
-	bp.AddPoint(pt)
+func observationFields(record *entities.ObservationRecord) map[string]interface{} {
+	return map[string]interface{}{
+		fieldValue:  record.Value,
+		fieldStatus: record.Status,
+	}
+}
 
-	log.Printf("[InfluxRepo] Saving metric: %s=%f", record.CodeText, record.Value)
+// influxAggregates maps supported aggregates to InfluxQL selectors
+var influxAggregates = map[repository.Aggregate]string{
+	repository.AggregateMean: `MEAN("value")`,
+	repository.AggregateMin:  `MIN("value")`,
+	repository.AggregateMax:  `MAX("value")`,
+	repository.AggregateP95:  `PERCENTILE("value", 95)`,
+	repository.AggregateLast: `LAST("value")`,
+}
 
-	return r.client.Write(bp)
+// buildObservationQuery renders q as InfluxQL, reading from rollup when it
+// is not nil. User-supplied strings are bound as parameters; only validated
+// numbers, whitelisted functions and configured policy names are written
+// into the statement itself.
+func buildObservationQuery(q repository.ObservationQuery, rollup *RetentionPolicy) (string, client.Params) {
+	params := client.Params{
+		"patient_id": q.PatientID,
+		"from":       q.From.Format(time.RFC3339Nano),
+		"to":         q.To.Format(time.RFC3339Nano),
+	}
+
+	var b strings.Builder
+	if rollup != nil {
+		fmt.Fprintf(&b, `SELECT %s AS "value" FROM %s.%s`, rollupFields[q.Aggregate], quoteIdent(rollup.Name), measurement)
+	} else if q.Interval > 0 {
+		fmt.Fprintf(&b, `SELECT %s AS "value" FROM %s`, influxAggregates[q.Aggregate], measurement)
+	} else {
+		fmt.Fprintf(&b, `SELECT * FROM %s`, measurement)
+	}
+	b.WriteString(` WHERE patient_id = $patient_id AND time >= $from AND time <= $to`)
+	if q.Code != "" {
+		b.WriteString(` AND code = $code`)
+		params["code"] = q.Code
+	}
+	if q.Interval > 0 {
+		fmt.Fprintf(&b, ` GROUP BY time(%ds), "code", "unit" fill(none)`, int64(q.Interval/time.Second))
+	} else {
+		// one series per code, so LIMIT applies per code as on the other
+		// backends; code is then read from the series tags
+		b.WriteString(` GROUP BY "code"`)
+	}
+	if q.Limit > 0 {
+		fmt.Fprintf(&b, ` LIMIT %d`, q.Limit)
+	}
+	return b.String(), params
 }
 
-func (r *InfluxRepo) FetchObservations(ctx context.Context, patientID, from, to string) ([]entities.Observation, error) {
-	query := fmt.Sprintf(`
-		SELECT * FROM vitals 
-		WHERE patient_id = '%s' 
-		AND time >= '%s' 
-		AND time <= '%s'
-	`, patientID, from, to)
+func (r *InfluxRepo) FetchObservations(ctx context.Context, q repository.ObservationQuery) ([]entities.Observation, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	rollup, split := r.rollupFor(q, time.Now())
+	if rollup == nil {
+		return r.fetchObservations(q, nil)
+	}
+	if !split.Before(q.To) {
+		return r.fetchObservations(q, rollup)
+	}
+
+	// older buckets come from the rollup, the latest ones from raw data
+	older, recent := q, q
+	older.To = split.Add(-time.Nanosecond)
+	recent.From = split
+	head, err := r.fetchObservations(older, rollup)
+	if err != nil {
+		return nil, err
+	}
+	tail, err := r.fetchObservations(recent, nil)
+	if err != nil {
+		return nil, err
+	}
+	return joinSeries(head, tail, q.Limit), nil
+}
 
-	log.Printf("Generated InfluxQL query: %s", query)
+// fetchObservations runs q against rollup, or raw data when it is nil
+func (r *InfluxRepo) fetchObservations(q repository.ObservationQuery, rollup *RetentionPolicy) ([]entities.Observation, error) {
+	command, params := buildObservationQuery(q, rollup)
 
-	q := client.NewQuery(query, r.db, "s")
+	source := "raw"
+	if rollup != nil {
+		source = rollup.Name
+	}
+	log.Printf("[FetchObservations] patient=%s from=%s to=%s interval=%s agg=%s source=%s", q.PatientID, q.From.Format(time.RFC3339), q.To.Format(time.RFC3339), q.Interval, q.Aggregate, source)
 
-	resp, err := r.client.Query(q)
+	resp, err := r.client.Query(client.NewQueryWithParameters(command, r.db, "s", params))
 	if err != nil {
 		return nil, fmt.Errorf("influx query failed: %w", err)
 	}
@@ -75,71 +195,162 @@ func (r *InfluxRepo) FetchObservations(ctx context.Context, patientID, from, to
 	var observations []entities.Observation
 	for _, result := range resp.Results {
 		for _, series := range result.Series {
+			cols := columnIndex(series.Columns)
 			for _, row := range series.Values {
-				if len(row) < 4 {
+				record, ok := recordFromRow(cols, series.Tags, row)
+				if !ok {
 					continue
 				}
-
-				var timestamp time.Time
-				switch v := row[0].(type) {
-				case string:
-					t, err := time.Parse(time.RFC3339, v)
-					if err != nil {
-						log.Printf("[FetchObservations] invalid timestamp format: %v", err)
-						continue
-					}
-					timestamp = t
-				case json.Number:
-					n, err := v.Int64()
-					if err != nil {
-						log.Printf("[FetchObservations] invalid timestamp number: %v", err)
-						continue
-					}
-					// convert nanoseconds unix to time.time
-					timestamp = time.Unix(0, n)
-				default:
-					log.Printf("[FetchObservations] unexpected timestamp type: %T", v)
-					continue
+				if record.PatientID == "" {
+					record.PatientID = q.PatientID
+					record.Subject = q.PatientID
 				}
+				observations = append(observations, entities.ToObservation(record))
+			}
+		}
+	}
 
-				unitStr, ok := row[2].(string)
-				if !ok {
-					log.Printf("[FetchObservations] expected unit as string, got: %T", row[2])
-					continue
-				}
+	return observations, nil
+}
 
-				var valueFloat float64
-				switch v := row[3].(type) {
-				case float64:
-					valueFloat = v
-				case json.Number:
-					f, err := v.Float64()
-					if err != nil {
-						log.Printf("[FetchObservations] failed to convert value json.Number to float64: %v", err)
-						continue
-					}
-					valueFloat = f
-				default:
-					log.Printf("[FetchObservations] unexpected type for value: %T", v)
-					continue
-				}
+// joinSeries appends each series of tail to the same series of head, so
+// results keep one run per code and unit, and reapplies the per-series
+// limit
+func joinSeries(head, tail []entities.Observation, limit int) []entities.Observation {
+	key := func(o entities.Observation) [2]string { return [2]string{o.Code.Text, o.ValueQuantity.Unit} }
+	var order [][2]string
+	series := make(map[[2]string][]entities.Observation)
+	for _, o := range append(head, tail...) {
+		k := key(o)
+		if _, ok := series[k]; !ok {
+			order = append(order, k)
+		}
+		if limit > 0 && len(series[k]) >= limit {
+			continue
+		}
+		series[k] = append(series[k], o)
+	}
+	out := make([]entities.Observation, 0, len(head)+len(tail))
+	for _, k := range order {
+		out = append(out, series[k]...)
+	}
+	return out
+}
 
-				obs := entities.Observation{
-					ResourceType:      "Observation",
-					Status:            "Final",
-					Code:              entities.Code{Text: "Vital Sign"},
-					Subject:           entities.Subject{Reference: patientID},
-					EffectiveDateTime: timestamp.Format(time.RFC3339),
-					ValueQuantity: entities.ValueQuantity{
-						Value: valueFloat,
-						Unit:  unitStr,
-					},
-				}
+// columnIndex maps column names to their position in a row
+func columnIndex(columns []string) map[string]int {
+	idx := make(map[string]int, len(columns))
+	for i, c := range columns {
+		idx[c] = i
+	}
+	return idx
+}
 
-				observations = append(observations, obs)
-			}
+// recordFromRow rebuilds a record from a row addressed by column name,
+// falling back to the series tags of grouped queries. Rows written before
+// the tagged schema stored the value in a field named after the code; those
+// are still read, with the column name as the code.
+func recordFromRow(cols map[string]int, tags map[string]string, row []interface{}) (*entities.ObservationRecord, bool) {
+	col := func(name string) interface{} {
+		if i, ok := cols[name]; ok && i < len(row) {
+			return row[i]
+		}
+		if v, ok := tags[name]; ok {
+			return v
 		}
+		return nil
+	}
+	str := func(name string) string {
+		v, _ := col(name).(string)
+		return v
 	}
 
-	return observations, nil
+	timestamp, err := parseInfluxTime(col("time"))
+	if err != nil {
+		log.Printf("[FetchObservations] %v", err)
+		return nil, false
+	}
+
+	record := &entities.ObservationRecord{
+		ID:                str(tagObservationID),
+		ResourceType:      "Observation",
+		Status:            str(fieldStatus),
+		CodeText:          str(tagCode),
+		PatientID:         str(tagPatientID),
+		Subject:           str(tagPatientID),
+		DeviceID:          str(tagDeviceID),
+		EffectiveDateTime: timestamp,
+		Unit:              str(tagUnit),
+	}
+	if record.Status == "" {
+		record.Status = "Final"
+	}
+
+	if v := col(fieldValue); v != nil {
+		value, err := parseInfluxFloat(v)
+		if err != nil {
+			log.Printf("[FetchObservations] %v", err)
+			return nil, false
+		}
+		record.Value = value
+		return record, true
+	}
+
+	// legacy row: the only non-nil numeric column outside the known schema
+	// holds the value and its name is the code
+	for name, i := range cols {
+		switch name {
+		case "time", tagPatientID, tagCode, tagUnit, tagDeviceID, tagObservationID, fieldValue, fieldStatus:
+			continue
+		}
+		if i >= len(row) || row[i] == nil {
+			continue
+		}
+		value, err := parseInfluxFloat(row[i])
+		if err != nil {
+			continue
+		}
+		record.CodeText = name
+		record.Value = value
+		return record, true
+	}
+
+	return nil, false
+}
+
+func parseInfluxTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case string:
+		ts, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp format: %w", err)
+		}
+		return ts, nil
+	case json.Number:
+		n, err := t.Int64()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp number: %w", err)
+		}
+		// precision "s" returns epoch seconds
+		return time.Unix(n, 0).UTC(), nil
+	default:
+		return time.Time{}, fmt.Errorf("unexpected timestamp type: %T", v)
+	}
+}
+
+func parseInfluxFloat(v interface{}) (float64, error) {
+	switch f := v.(type) {
+	case float64:
+		return f, nil
+	case json.Number:
+		return f.Float64()
+	default:
+		return 0, fmt.Errorf("unexpected type for value: %T", v)
+	}
+}
+
+// Close releases the idle HTTP connections held by the InfluxDB client.
+// Writes are synchronous, so there is no pending batch to flush.
+func (r *InfluxRepo) Close() error {
+	return r.client.Close()
 }
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+)
+
+var _ repository.ObservationRepository = (*InfluxV2Repo)(nil)
+
+// InfluxV2Repo stores observations in an InfluxDB 2.x bucket using the same
+// measurement, tags and fields as InfluxRepo. Writes are batched and sent in
+// the background; Close flushes what is still buffered.
+type InfluxV2Repo struct {
+	client influxdb2.Client
+	write  api.WriteAPI
+	query  api.QueryAPI
+	bucket string
+	done   chan struct{}
+}
+
+func NewInfluxV2Repo(url, token, org, bucket string) (*InfluxV2Repo, error) {
+	if url == "" || token == "" || org == "" || bucket == "" {
+		return nil, fmt.Errorf("influxdb2: url, token, org and bucket must be provided")
+	}
+	opts := influxdb2.DefaultOptions().
+		SetBatchSize(500).
+		SetFlushInterval(1000).
+		SetPrecision(time.Second)
+	c := influxdb2.NewClientWithOptions(url, token, opts)
+
+	r := &InfluxV2Repo{
+		client: c,
+		write:  c.WriteAPI(org, bucket),
+		query:  c.QueryAPI(org),
+		bucket: bucket,
+		done:   make(chan struct{}),
+	}
+
+	// the non-blocking API reports failures asynchronously
+	go func() {
+		defer close(r.done)
+		for err := range r.write.Errors() {
+			log.Printf("[InfluxV2Repo] write error: %v", err)
+		}
+	}()
+
+	return r, nil
+}
+
+// Save queues the point for the next batch and returns immediately
+func (r *InfluxV2Repo) Save(ctx context.Context, record *entities.ObservationRecord) error {
+	r.write.WritePoint(influxdb2.NewPoint(measurement, observationTags(record), observationFields(record), record.EffectiveDateTime))
+	return nil
+}
+
+// SaveBatch queues every point; the client sends them in its own batches
+func (r *InfluxV2Repo) SaveBatch(ctx context.Context, records []*entities.ObservationRecord) error {
+	for _, record := range records {
+		if err := r.Save(ctx, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush sends any buffered points now
+func (r *InfluxV2Repo) Flush() error {
+	r.write.Flush()
+	return nil
+}
+
+// fluxAggregates maps supported aggregates to aggregateWindow functions.
+// Flux functions cannot be passed as parameters, so they are whitelisted.
+var fluxAggregates = map[repository.Aggregate]string{
+	repository.AggregateMean: `mean`,
+	repository.AggregateMin:  `min`,
+	repository.AggregateMax:  `max`,
+	repository.AggregateLast: `last`,
+	repository.AggregateP95:  `(column, tables=<-) => tables |> quantile(q: 0.95, column: column, method: "exact_selector")`,
+}
+
+// buildFluxQuery renders q as Flux. All caller input is passed through
+// params; only the whitelisted aggregate and validated limit are inlined.
+func buildFluxQuery(q repository.ObservationQuery, bucket string) (string, map[string]interface{}) {
+	params := map[string]interface{}{
+		"bucket":    bucket,
+		"patientID": q.PatientID,
+		"start":     q.From.Format(time.RFC3339Nano),
+		// range stop is exclusive while the API treats to as inclusive
+		"stop": q.To.Add(time.Nanosecond).Format(time.RFC3339Nano),
+		"code": q.Code,
+	}
+
+	flux := `from(bucket: params.bucket)
+  |> range(start: time(v: params.start), stop: time(v: params.stop))
+  |> filter(fn: (r) => r._measurement == "vitals" and r.patient_id == params.patientID)
+  |> filter(fn: (r) => params.code == "" or r.code == params.code)
+`
+	if q.Interval > 0 {
+		params["every"] = fmt.Sprintf("%ds", int64(q.Interval/time.Second))
+		flux += fmt.Sprintf(`  |> filter(fn: (r) => r._field == "value")
+  |> group(columns: ["code", "unit"])
+  |> aggregateWindow(every: duration(v: params.every), fn: %s, createEmpty: false, timeSrc: "_start")
+`, fluxAggregates[q.Aggregate])
+	} else {
+		flux += `  |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")
+  |> group(columns: ["code"])
+  |> sort(columns: ["_time"])
+`
+	}
+	if q.Limit > 0 {
+		flux += fmt.Sprintf("  |> limit(n: %d)\n", q.Limit)
+	}
+	return flux, params
+}
+
+func (r *InfluxV2Repo) FetchObservations(ctx context.Context, q repository.ObservationQuery) ([]entities.Observation, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	flux, params := buildFluxQuery(q, r.bucket)
+	log.Printf("[InfluxV2Repo] patient=%s from=%s to=%s interval=%s agg=%s", q.PatientID, q.From.Format(time.RFC3339), q.To.Format(time.RFC3339), q.Interval, q.Aggregate)
+
+	result, err := r.query.QueryWithParams(ctx, flux, params)
+	if err != nil {
+		return nil, fmt.Errorf("influxdb2 query failed: %w", err)
+	}
+	defer result.Close()
+
+	var observations []entities.Observation
+	for result.Next() {
+		record := recordFromFlux(result.Record(), q)
+		if record == nil {
+			continue
+		}
+		observations = append(observations, entities.ToObservation(record))
+	}
+	if result.Err() != nil {
+		return nil, fmt.Errorf("influxdb2 result error: %w", result.Err())
+	}
+	return observations, nil
+}
+
+// recordFromFlux reads a row of either the pivoted raw query (value in
+// "value") or an aggregate query (value in "_value")
+func recordFromFlux(rec *query.FluxRecord, q repository.ObservationQuery) *entities.ObservationRecord {
+	str := func(key string) string {
+		v, _ := rec.ValueByKey(key).(string)
+		return v
+	}
+
+	raw := rec.ValueByKey(fieldValue)
+	if raw == nil {
+		raw = rec.Value()
+	}
+	value, ok := raw.(float64)
+	if !ok {
+		log.Printf("[InfluxV2Repo] unexpected type for value: %T", raw)
+		return nil
+	}
+
+	record := &entities.ObservationRecord{
+		ID:                str(tagObservationID),
+		ResourceType:      "Observation",
+		Status:            str(fieldStatus),
+		CodeText:          str(tagCode),
+		PatientID:         q.PatientID,
+		Subject:           q.PatientID,
+		DeviceID:          str(tagDeviceID),
+		EffectiveDateTime: rec.Time().UTC(),
+		Value:             value,
+		Unit:              str(tagUnit),
+	}
+	if record.Status == "" {
+		record.Status = "Final"
+	}
+	return record
+}
+
+// Close flushes buffered writes and closes the client
+func (r *InfluxV2Repo) Close() error {
+	r.client.Close()
+	<-r.done
+	return nil
+}
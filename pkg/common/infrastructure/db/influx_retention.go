@@ -0,0 +1,330 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client/v2"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+)
+
+// RetentionPolicy is an InfluxDB retention policy. A zero Resolution marks
+// the raw policy that observations are written to; any other policy is a
+// rollup filled by a continuous query at that resolution.
+type RetentionPolicy struct {
+	Name       string
+	Duration   time.Duration // 0 keeps data forever
+	Resolution time.Duration
+}
+
+// DefaultRetentionPolicies keeps raw vitals for 30 days, 1-minute rollups
+// for 2 years and 1-hour rollups forever
+var DefaultRetentionPolicies = []RetentionPolicy{
+	{Name: "raw", Duration: 30 * 24 * time.Hour},
+	{Name: "rollup_1m", Duration: 2 * 365 * 24 * time.Hour, Resolution: time.Minute},
+	{Name: "rollup_1h", Resolution: time.Hour},
+}
+
+// RetentionPoliciesFromEnv returns DefaultRetentionPolicies with durations
+// overridden by INFLUX_RETENTION_RAW, INFLUX_RETENTION_1M and
+// INFLUX_RETENTION_1H ("0" keeps forever). It returns nil when
+// INFLUX_RETENTION=off so the database default policy is used unchanged.
+func RetentionPoliciesFromEnv() []RetentionPolicy {
+	if strings.EqualFold(os.Getenv("INFLUX_RETENTION"), "off") {
+		return nil
+	}
+	policies := append([]RetentionPolicy(nil), DefaultRetentionPolicies...)
+	for i, env := range []string{"INFLUX_RETENTION_RAW", "INFLUX_RETENTION_1M", "INFLUX_RETENTION_1H"} {
+		raw := os.Getenv(env)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			log.Printf("invalid %s %q, keeping %s", env, raw, policies[i].Duration)
+			continue
+		}
+		policies[i].Duration = d
+	}
+	return policies
+}
+
+// InfluxOption configures an InfluxRepo
+type InfluxOption func(*InfluxRepo)
+
+// WithRetentionPolicies writes observations to the raw policy and lets
+// aggregated queries read from rollups
+func WithRetentionPolicies(policies []RetentionPolicy) InfluxOption {
+	return func(r *InfluxRepo) {
+		r.policies = policies
+	}
+}
+
+func (r *InfluxRepo) rawPolicy() string {
+	for _, p := range r.policies {
+		if p.Resolution == 0 {
+			return p.Name
+		}
+	}
+	return ""
+}
+
+// EnsureRetentionPolicies creates or updates every configured retention
+// policy, makes the raw policy the database default and creates the
+// continuous queries that fill the rollups. It is safe to run on every
+// startup and from several services at once.
+func (r *InfluxRepo) EnsureRetentionPolicies() error {
+	raw := r.rawPolicy()
+	if raw == "" {
+		return fmt.Errorf("influxdb: no raw retention policy configured")
+	}
+
+	previous, err := r.defaultPolicy()
+	if err != nil {
+		return err
+	}
+	for _, p := range r.policies {
+		clause := fmt.Sprintf("DURATION %s REPLICATION 1", influxDuration(p.Duration))
+		if p.Name == raw {
+			clause += " DEFAULT"
+		}
+		create := fmt.Sprintf(`CREATE RETENTION POLICY %s ON %s %s`, quoteIdent(p.Name), quoteIdent(r.db), clause)
+		if err := r.exec(create); err != nil {
+			if !strings.Contains(err.Error(), "already exists") {
+				return fmt.Errorf("influxdb: create retention policy %s: %w", p.Name, err)
+			}
+			alter := fmt.Sprintf(`ALTER RETENTION POLICY %s ON %s %s`, quoteIdent(p.Name), quoteIdent(r.db), clause)
+			if err := r.exec(alter); err != nil {
+				return fmt.Errorf("influxdb: alter retention policy %s: %w", p.Name, err)
+			}
+		}
+	}
+	if previous != "" && previous != raw {
+		// reads do not name a policy, so they only see the new default
+		log.Printf("[InfluxRepo] default retention policy changed from %q to %q; points already in %q are no longer returned. "+
+			"To keep serving them, copy them once with: SELECT * INTO %s.%s.%s FROM %s.%s.%s GROUP BY *",
+			previous, raw, previous,
+			quoteIdent(r.db), quoteIdent(raw), measurement, quoteIdent(r.db), quoteIdent(previous), measurement)
+	}
+
+	existing, err := r.continuousQueries()
+	if err != nil {
+		return err
+	}
+	for _, p := range r.policies {
+		if p.Resolution == 0 {
+			continue
+		}
+		// rollups keep patient, code and unit; grouping by every tag would
+		// split buckets per observation_id and store nothing coarser than raw
+		selectInto := fmt.Sprintf(
+			`SELECT MEAN("value") AS "mean", MIN("value") AS "min", MAX("value") AS "max", LAST("value") AS "last", SUM("value") AS "sum", COUNT("value") AS "count" `+
+				`INTO %s.%s.%s FROM %s.%s.%s`,
+			quoteIdent(r.db), quoteIdent(p.Name), measurement,
+			quoteIdent(r.db), quoteIdent(raw), measurement,
+		)
+		groupBy := fmt.Sprintf(` GROUP BY time(%s), "patient_id", "code", "unit"`, influxDuration(p.Resolution))
+		// every run recomputes the last two buckets, so points arriving up
+		// to one resolution late still reach the rollup
+		body := selectInto + groupBy
+		resample := fmt.Sprintf(`RESAMPLE FOR %s`, influxDuration(2*p.Resolution))
+		// the name carries a digest of the definition, so a changed
+		// definition is created under a new name and replaces the old one
+		name := cqName(p.Name, resample+" "+body)
+		created := !slices.Contains(existing, name)
+		cq := fmt.Sprintf(`CREATE CONTINUOUS QUERY %s ON %s %s BEGIN %s END`, quoteIdent(name), quoteIdent(r.db), resample, body)
+		if err := r.exec(cq); err != nil && !strings.Contains(err.Error(), "already exists") {
+			return fmt.Errorf("influxdb: create continuous query for %s: %w", p.Name, err)
+		}
+		if created {
+			// a continuous query only covers data written after it runs, so
+			// fill the rollup once from what raw already holds
+			backfill := selectInto + ` WHERE time >= 0 AND time < now()` + groupBy
+			if err := r.exec(backfill); err != nil {
+				return fmt.Errorf("influxdb: backfill %s: %w", p.Name, err)
+			}
+			log.Printf("[InfluxRepo] backfilled %s from %s", p.Name, raw)
+		}
+		for _, old := range existing {
+			if old == name || !isCQOf(old, p.Name) {
+				continue
+			}
+			drop := fmt.Sprintf(`DROP CONTINUOUS QUERY %s ON %s`, quoteIdent(old), quoteIdent(r.db))
+			if err := r.exec(drop); err != nil && !strings.Contains(err.Error(), "not found") {
+				return fmt.Errorf("influxdb: drop continuous query %s: %w", old, err)
+			}
+			log.Printf("[InfluxRepo] replaced continuous query %s with %s", old, name)
+		}
+	}
+
+	log.Printf("[InfluxRepo] retention policies ready, raw data in %q", raw)
+	return nil
+}
+
+// defaultPolicy returns the database's default retention policy, or "" if
+// the database has none
+func (r *InfluxRepo) defaultPolicy() (string, error) {
+	rows, err := r.show(`SHOW RETENTION POLICIES ON ` + quoteIdent(r.db))
+	if err != nil {
+		return "", fmt.Errorf("influxdb: show retention policies: %w", err)
+	}
+	for _, row := range rows {
+		if isDefault, _ := row["default"].(bool); isDefault {
+			name, _ := row["name"].(string)
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// continuousQueries returns the names of the database's continuous queries
+func (r *InfluxRepo) continuousQueries() ([]string, error) {
+	rows, err := r.show(`SHOW CONTINUOUS QUERIES`)
+	if err != nil {
+		return nil, fmt.Errorf("influxdb: show continuous queries: %w", err)
+	}
+	var names []string
+	for _, row := range rows {
+		if row["database"] != r.db {
+			continue
+		}
+		if name, ok := row["name"].(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// show runs a SHOW statement and returns its rows by column name; rows of
+// SHOW CONTINUOUS QUERIES carry their series name as "database"
+func (r *InfluxRepo) show(command string) ([]map[string]interface{}, error) {
+	resp, err := r.client.Query(client.NewQuery(command, r.db, ""))
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	var rows []map[string]interface{}
+	for _, result := range resp.Results {
+		for _, series := range result.Series {
+			for _, values := range series.Values {
+				row := map[string]interface{}{"database": series.Name}
+				for i, col := range series.Columns {
+					if i < len(values) {
+						row[col] = values[i]
+					}
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// cqName names the continuous query filling policy with definition body
+func cqName(policy, body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return "cq_" + policy + "_" + hex.EncodeToString(sum[:4])
+}
+
+// isCQOf reports whether name is a continuous query created for policy,
+// under any definition; "cq_<policy>" is the unversioned name used before
+// definitions were tracked
+func isCQOf(name, policy string) bool {
+	prefix := "cq_" + policy
+	if name == prefix {
+		return true
+	}
+	digest, ok := strings.CutPrefix(name, prefix+"_")
+	if !ok || len(digest) != 8 {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
+
+// rollupFields maps aggregates that can be derived from a rollup to the
+// InfluxQL selecting them. p95 cannot be rebuilt from rollups.
+var rollupFields = map[repository.Aggregate]string{
+	repository.AggregateMean: `SUM("sum") / SUM("count")`,
+	repository.AggregateMin:  `MIN("min")`,
+	repository.AggregateMax:  `MAX("max")`,
+	repository.AggregateLast: `LAST("last")`,
+}
+
+// rollupFor returns the coarsest rollup whose resolution evenly divides the
+// query interval and whose retention still covers q.From, or nil to read
+// raw data. The rollup only serves buckets before the returned split: the
+// latest buckets are still being filled by the continuous query, so
+// anything from split on is read raw.
+func (r *InfluxRepo) rollupFor(q repository.ObservationQuery, now time.Time) (*RetentionPolicy, time.Time) {
+	if q.Interval == 0 {
+		return nil, time.Time{}
+	}
+	if _, ok := rollupFields[q.Aggregate]; !ok {
+		return nil, time.Time{}
+	}
+	var best *RetentionPolicy
+	for i := range r.policies {
+		p := &r.policies[i]
+		if p.Resolution == 0 || q.Interval%p.Resolution != 0 {
+			continue
+		}
+		if p.Duration > 0 && q.From.Before(now.Add(-p.Duration)) {
+			continue
+		}
+		if best == nil || p.Resolution > best.Resolution {
+			best = p
+		}
+	}
+	if best == nil {
+		return nil, time.Time{}
+	}
+	// the bucket that closed last may not be written yet, and the split
+	// falls on a query bucket so no bucket is read from both sources
+	split := truncateInterval(now.Add(-best.Resolution), q.Interval)
+	if !split.After(q.From) {
+		return nil, time.Time{}
+	}
+	return best, split
+}
+
+// truncateInterval rounds t down to a multiple of d since the Unix epoch,
+// which is where InfluxDB aligns GROUP BY time buckets
+func truncateInterval(t time.Time, d time.Duration) time.Time {
+	epoch := time.Unix(0, 0).UTC()
+	return epoch.Add(t.Sub(epoch) / d * d).In(t.Location())
+}
+
+func (r *InfluxRepo) exec(command string) error {
+	resp, err := r.client.Query(client.NewQuery(command, r.db, ""))
+	if err != nil {
+		return err
+	}
+	return resp.Error()
+}
+
+// influxDuration renders d as an InfluxQL duration literal; 0 is INF
+func influxDuration(d time.Duration) string {
+	switch {
+	case d == 0:
+		return "INF"
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `\"`) + `"`
+}
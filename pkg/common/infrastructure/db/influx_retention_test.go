@@ -0,0 +1,87 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+)
+
+func TestRollupFor(t *testing.T) {
+	r := &InfluxRepo{policies: DefaultRetentionPolicies}
+	now := time.Date(2025, 5, 19, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		from, to  time.Time
+		interval  time.Duration
+		aggregate repository.Aggregate
+		policy    string
+		split     time.Time
+	}{
+		{
+			name: "range ending at now reads the last hours raw",
+			from: now.Add(-6 * time.Hour), to: now, interval: time.Hour, aggregate: repository.AggregateMean,
+			policy: "rollup_1h", split: time.Date(2025, 5, 19, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "minute buckets leave the last closed minute to raw",
+			from: now.Add(-time.Hour), to: now, interval: 5 * time.Minute, aggregate: repository.AggregateMax,
+			policy: "rollup_1m", split: time.Date(2025, 5, 19, 10, 25, 0, 0, time.UTC),
+		},
+		{
+			name: "range inside the open buckets is all raw",
+			from: now.Add(-30 * time.Minute), to: now, interval: time.Hour, aggregate: repository.AggregateMean,
+		},
+		{
+			name: "past range is all rollup",
+			from: now.Add(-48 * time.Hour), to: now.Add(-24 * time.Hour), interval: time.Hour, aggregate: repository.AggregateMin,
+			policy: "rollup_1h", split: time.Date(2025, 5, 19, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "p95 cannot use rollups",
+			from: now.Add(-6 * time.Hour), to: now, interval: time.Hour, aggregate: repository.AggregateP95,
+		},
+		{
+			name: "interval not a multiple of a resolution",
+			from: now.Add(-6 * time.Hour), to: now, interval: 90 * time.Second, aggregate: repository.AggregateMean,
+		},
+		{
+			name: "from beyond the minute rollup retention",
+			from: now.Add(-3 * 365 * 24 * time.Hour), to: now, interval: 5 * time.Minute, aggregate: repository.AggregateMean,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := repository.ObservationQuery{PatientID: "p", From: tt.from, To: tt.to, Interval: tt.interval, Aggregate: tt.aggregate}
+			policy, split := r.rollupFor(q, now)
+			name := ""
+			if policy != nil {
+				name = policy.Name
+			}
+			if name != tt.policy || !split.Equal(tt.split) {
+				t.Errorf("rollupFor = %q split %s, want %q split %s", name, split, tt.policy, tt.split)
+			}
+		})
+	}
+}
+
+func TestJoinSeries(t *testing.T) {
+	obs := func(code string, value float64) entities.Observation {
+		return entities.Observation{Code: entities.Code{Text: code}, ValueQuantity: entities.ValueQuantity{Value: value, Unit: "u"}}
+	}
+	head := []entities.Observation{obs("hr", 1), obs("hr", 2), obs("spo2", 90)}
+	tail := []entities.Observation{obs("hr", 3), obs("spo2", 91), obs("spo2", 92)}
+
+	got := joinSeries(head, tail, 2)
+	want := []entities.Observation{obs("hr", 1), obs("hr", 2), obs("spo2", 90), obs("spo2", 91)}
+	if len(got) != len(want) {
+		t.Fatalf("joinSeries = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].Code.Text != want[i].Code.Text || got[i].ValueQuantity.Value != want[i].ValueQuantity.Value {
+			t.Fatalf("joinSeries = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+-- matches the table GORM AutoMigrate created, so existing databases adopt it
+CREATE TABLE IF NOT EXISTS alerts (
+    id             TEXT PRIMARY KEY,
+    patient_id     TEXT,
+    observation_id TEXT,
+    message        TEXT,
+    type           TEXT,
+    timestamp      TIMESTAMPTZ,
+    acknowledged   BOOLEAN
+);
+
+CREATE INDEX IF NOT EXISTS idx_alerts_patient_id ON alerts (patient_id);
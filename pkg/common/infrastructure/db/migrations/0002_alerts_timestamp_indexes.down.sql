@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_alerts_timestamp;
+DROP INDEX IF EXISTS idx_alerts_patient_id_timestamp;
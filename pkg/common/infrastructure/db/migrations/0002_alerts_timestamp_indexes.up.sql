@@ -0,0 +1,3 @@
+-- newest alerts per patient, and recent alerts across patients
+CREATE INDEX IF NOT EXISTS idx_alerts_patient_id_timestamp ON alerts (patient_id, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_alerts_timestamp ON alerts (timestamp DESC);
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS patients;
+
+DROP INDEX IF EXISTS idx_alerts_open;
+DROP INDEX IF EXISTS idx_alerts_timestamp_id;
+
+ALTER TABLE alerts ALTER COLUMN acknowledged DROP NOT NULL;
+ALTER TABLE alerts ALTER COLUMN acknowledged DROP DEFAULT;
+
+ALTER TABLE alerts
+    DROP COLUMN IF EXISTS resolved,
+    DROP COLUMN IF EXISTS severity;
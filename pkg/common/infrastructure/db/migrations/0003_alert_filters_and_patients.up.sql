@@ -0,0 +1,23 @@
+ALTER TABLE alerts
+    ADD COLUMN IF NOT EXISTS severity TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS resolved BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE alerts SET acknowledged = FALSE WHERE acknowledged IS NULL;
+ALTER TABLE alerts ALTER COLUMN acknowledged SET DEFAULT FALSE;
+ALTER TABLE alerts ALTER COLUMN acknowledged SET NOT NULL;
+
+-- keyset pagination orders by (timestamp, id)
+CREATE INDEX IF NOT EXISTS idx_alerts_timestamp_id ON alerts (timestamp DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_alerts_open ON alerts (timestamp DESC, id DESC) WHERE NOT resolved;
+
+-- patient location for ward and unit views
+CREATE TABLE IF NOT EXISTS patients (
+    id         TEXT PRIMARY KEY,
+    name       TEXT NOT NULL DEFAULT '',
+    birth_date TIMESTAMPTZ,
+    ward       TEXT NOT NULL DEFAULT '',
+    unit       TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_patients_ward ON patients (ward);
+CREATE INDEX IF NOT EXISTS idx_patients_unit ON patients (unit);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_alerts_severity_timestamp;
+
+ALTER TABLE alerts
+    DROP COLUMN IF EXISTS score,
+    DROP COLUMN IF EXISTS threshold,
+    DROP COLUMN IF EXISTS value,
+    DROP COLUMN IF EXISTS code,
+    DROP COLUMN IF EXISTS rule_id,
+    DROP COLUMN IF EXISTS source;
@@ -0,0 +1,16 @@
+ALTER TABLE alerts
+    ADD COLUMN IF NOT EXISTS source    TEXT             NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS rule_id   TEXT             NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS code      TEXT             NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS value     DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS threshold DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS score     DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+-- alerts raised before these columns existed: recover what the type tells
+UPDATE alerts SET source = 'rule', rule_id = 'heart-rate-max', code = 'heart-rate', severity = 'warning'
+    WHERE type = 'HighHeartRate' AND severity = '';
+UPDATE alerts SET source = 'rule', rule_id = 'spo2-min', code = 'spo2', severity = 'critical'
+    WHERE type = 'LowSpO2' AND severity = '';
+UPDATE alerts SET severity = 'warning' WHERE severity = '';
+
+CREATE INDEX IF NOT EXISTS idx_alerts_severity_timestamp ON alerts (severity, timestamp DESC);
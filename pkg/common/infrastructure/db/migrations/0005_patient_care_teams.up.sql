@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS patient_care_teams (
+    patient_id TEXT NOT NULL,
+    care_team  TEXT NOT NULL,
+    PRIMARY KEY (patient_id, care_team)
+);
+
+CREATE INDEX IF NOT EXISTS idx_patient_care_teams_care_team ON patient_care_teams (care_team);
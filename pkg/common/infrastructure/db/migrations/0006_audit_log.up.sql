@@ -0,0 +1,36 @@
+-- append-only, hash-chained record of patient data access
+CREATE TABLE IF NOT EXISTS audit_log (
+    seq         BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    actor       TEXT NOT NULL,
+    roles       TEXT NOT NULL DEFAULT '',
+    action      TEXT NOT NULL,
+    patient_id  TEXT NOT NULL DEFAULT '',
+    resource    TEXT NOT NULL,
+    query       TEXT NOT NULL DEFAULT '',
+    client_ip   TEXT NOT NULL DEFAULT '',
+    status      INTEGER NOT NULL,
+    outcome     TEXT NOT NULL,
+    prev_hash   TEXT NOT NULL,
+    hash        TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_log_hash ON audit_log (hash);
+CREATE INDEX IF NOT EXISTS idx_audit_log_occurred_at ON audit_log (occurred_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor, seq);
+CREATE INDEX IF NOT EXISTS idx_audit_log_patient_id ON audit_log (patient_id, seq);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$;
+
+CREATE TRIGGER audit_log_no_update_delete
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_alerts_seq;
+
+ALTER TABLE alerts DROP COLUMN IF EXISTS seq;
@@ -0,0 +1,6 @@
+-- alerts are numbered in insertion order so WebSocket clients can resume
+-- from the last one they received; existing rows are numbered in whatever
+-- order PostgreSQL rewrites the table
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS seq BIGSERIAL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alerts_seq ON alerts (seq);
@@ -0,0 +1,23 @@
+-- alert notifications, one row per channel and recipient; pending rows are
+-- claimed by notifiers once next_attempt_at is due
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id              TEXT PRIMARY KEY,
+    alert_id        TEXT NOT NULL,
+    patient_id      TEXT NOT NULL,
+    severity        TEXT NOT NULL,
+    route           TEXT NOT NULL DEFAULT '',
+    channel         TEXT NOT NULL,
+    recipient       TEXT NOT NULL,
+    subject         TEXT NOT NULL DEFAULT '',
+    body            TEXT NOT NULL,
+    status          TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL,
+    updated_at      TIMESTAMPTZ NOT NULL,
+    sent_at         TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_alert_id ON notification_deliveries (alert_id);
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_due ON notification_deliveries (next_attempt_at) WHERE status = 'pending';
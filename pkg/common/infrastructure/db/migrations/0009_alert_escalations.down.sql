@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS alert_escalations;
+
+ALTER TABLE alerts
+    DROP COLUMN IF EXISTS acknowledged_at,
+    DROP COLUMN IF EXISTS acknowledged_by;
@@ -0,0 +1,22 @@
+-- who acknowledged an alert and when; acknowledging stops its escalation
+ALTER TABLE alerts
+    ADD COLUMN IF NOT EXISTS acknowledged_by TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS acknowledged_at TIMESTAMPTZ;
+
+-- escalation timers, one per alert; active rows are claimed by notifiers
+-- once due_at is due and move on to the next step of their policy
+CREATE TABLE IF NOT EXISTS alert_escalations (
+    id         TEXT PRIMARY KEY,
+    alert_id   TEXT NOT NULL,
+    patient_id TEXT NOT NULL,
+    ward       TEXT NOT NULL DEFAULT '',
+    policy     TEXT NOT NULL,
+    step       INTEGER NOT NULL DEFAULT 0,
+    status     TEXT NOT NULL,
+    due_at     TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_escalations_alert_id ON alert_escalations (alert_id);
+CREATE INDEX IF NOT EXISTS idx_alert_escalations_due ON alert_escalations (due_at) WHERE status = 'active';
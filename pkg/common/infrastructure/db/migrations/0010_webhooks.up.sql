@@ -0,0 +1,37 @@
+-- outbound webhook subscriptions; filters are JSON arrays of strings and
+-- an empty array matches everything
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id           TEXT PRIMARY KEY,
+    url          TEXT NOT NULL,
+    description  TEXT NOT NULL DEFAULT '',
+    secret       TEXT NOT NULL,
+    event_types  TEXT NOT NULL DEFAULT '[]',
+    patient_ids  TEXT NOT NULL DEFAULT '[]',
+    wards        TEXT NOT NULL DEFAULT '[]',
+    min_severity TEXT NOT NULL DEFAULT '',
+    created_by   TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL,
+    updated_at   TIMESTAMPTZ NOT NULL
+);
+
+-- one row per event and subscription, kept as the delivery log; pending
+-- rows are claimed by senders once next_attempt_at is due
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id              TEXT PRIMARY KEY,
+    subscription_id TEXT NOT NULL,
+    event_id        TEXT NOT NULL,
+    event_type      TEXT NOT NULL,
+    alert_id        TEXT NOT NULL,
+    payload         TEXT NOT NULL,
+    status          TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    response_status INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL,
+    updated_at      TIMESTAMPTZ NOT NULL,
+    delivered_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_log ON webhook_deliveries (subscription_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
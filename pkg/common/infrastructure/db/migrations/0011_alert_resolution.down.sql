@@ -0,0 +1,3 @@
+ALTER TABLE alerts
+    DROP COLUMN IF EXISTS resolved_at,
+    DROP COLUMN IF EXISTS resolved_by;
@@ -0,0 +1,4 @@
+-- who resolved an alert and when; resolving also stops its escalation
+ALTER TABLE alerts
+    ADD COLUMN IF NOT EXISTS resolved_by TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS resolved_at TIMESTAMPTZ;
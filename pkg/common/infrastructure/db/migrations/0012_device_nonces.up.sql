@@ -0,0 +1,9 @@
+-- nonces of signed device requests, shared by every ingest replica so a
+-- request cannot be replayed against another replica or after a restart;
+-- expired rows are deleted as new nonces are claimed
+CREATE TABLE IF NOT EXISTS device_nonces (
+    nonce      TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_nonces_expires_at ON device_nonces (expires_at);
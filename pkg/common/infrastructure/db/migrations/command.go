@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+)
+
+// Usage documents the arguments accepted by Run
+const Usage = `usage: migrate [up [VERSION] | down [STEPS] | version]
+  up       apply pending migrations, up to VERSION when given
+  down     revert the last STEPS migrations (default 1)
+  version  print the applied and expected schema versions`
+
+// Run implements the migrate subcommand shared by the services. No
+// arguments means "up".
+func Run(ctx context.Context, db *sql.DB, args []string) error {
+	cmd := "up"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+	n := 0
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v < 0 || len(args) > 1 {
+			return fmt.Errorf("invalid arguments %q\n%s", args, Usage)
+		}
+		n = v
+	}
+
+	switch cmd {
+	case "up":
+		if err := Up(ctx, db, n); err != nil {
+			return err
+		}
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+		if err := Down(ctx, db, n); err != nil {
+			return err
+		}
+	case "version":
+		if n != 0 {
+			return fmt.Errorf("version takes no arguments\n%s", Usage)
+		}
+	default:
+		return fmt.Errorf("unknown command %q\n%s", cmd, Usage)
+	}
+
+	version, err := Version(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version %d (binary expects %d)\n", version, Latest())
+	return nil
+}
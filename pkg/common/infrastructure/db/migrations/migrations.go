@@ -0,0 +1,220 @@
+// Package migrations applies the numbered SQL migrations embedded in this
+// package to the PostgreSQL database. Files are named
+// NNNN_description.up.sql and NNNN_description.down.sql; every applied
+// version is recorded in the schema_migrations table.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// ErrSchemaOutdated is returned by Check when the database is behind or
+// ahead of the migrations built into the binary
+var ErrSchemaOutdated = errors.New("migrations: schema version mismatch")
+
+// lockID is the advisory lock held while migrating so two processes
+// cannot apply the same migration
+const lockID = 7_310_442_036
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// All returns the embedded migrations ordered by version
+func All() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		m := fileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migrations: unexpected file %s", e.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := files.ReadFile(e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migrations: version %d used by %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migrations: version %d needs both up and down files", mig.Version)
+		}
+		out = append(out, *mig)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Latest is the highest embedded version, the one services expect
+func Latest() int {
+	all, err := All()
+	if err != nil || len(all) == 0 {
+		return 0
+	}
+	return all[len(all)-1].Version
+}
+
+// Version returns the highest applied version, 0 for an empty database
+func Version(ctx context.Context, db *sql.DB) (int, error) {
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("migrations: read version: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+	var version int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("migrations: read version: %w", err)
+	}
+	return version, nil
+}
+
+// Check verifies the database is at Latest without changing it
+func Check(ctx context.Context, db *sql.DB) error {
+	version, err := Version(ctx, db)
+	if err != nil {
+		return err
+	}
+	if want := Latest(); version != want {
+		return fmt.Errorf("%w: database is at %d, binary expects %d; run the migrate subcommand", ErrSchemaOutdated, version, want)
+	}
+	return nil
+}
+
+// Up applies every pending migration up to and including target; a target
+// of 0 means Latest. Each migration runs in its own transaction together
+// with its schema_migrations row.
+func Up(ctx context.Context, db *sql.DB, target int) error {
+	all, err := All()
+	if err != nil {
+		return err
+	}
+	if target == 0 {
+		target = Latest()
+	}
+
+	return withLock(ctx, db, func(conn *sql.Conn) error {
+		version, err := Version(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, m := range all {
+			if m.Version <= version || m.Version > target {
+				continue
+			}
+			err := apply(ctx, conn, m.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("migrations: up %04d_%s: %w", m.Version, m.Name, err)
+			}
+			log.Printf("[Migrations] applied %04d_%s", m.Version, m.Name)
+		}
+		return nil
+	})
+}
+
+// Down reverts the last steps applied migrations, newest first
+func Down(ctx context.Context, db *sql.DB, steps int) error {
+	all, err := All()
+	if err != nil {
+		return err
+	}
+
+	return withLock(ctx, db, func(conn *sql.Conn) error {
+		version, err := Version(ctx, db)
+		if err != nil {
+			return err
+		}
+		for i := len(all) - 1; i >= 0 && steps > 0; i-- {
+			m := all[i]
+			if m.Version > version {
+				continue
+			}
+			err := apply(ctx, conn, m.Down, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+			if err != nil {
+				return fmt.Errorf("migrations: down %04d_%s: %w", m.Version, m.Name, err)
+			}
+			log.Printf("[Migrations] reverted %04d_%s", m.Version, m.Name)
+			steps--
+		}
+		return nil
+	})
+}
+
+// withLock creates schema_migrations if needed and runs fn while holding the
+// migration advisory lock on a single connection
+func withLock(ctx context.Context, db *sql.DB, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("migrations: acquire lock: %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("migrations: create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func apply(ctx context.Context, conn *sql.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
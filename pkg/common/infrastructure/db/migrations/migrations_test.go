@@ -0,0 +1,105 @@
+package migrations_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/migrations"
+)
+
+func TestAll(t *testing.T) {
+	all, err := migrations.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range all {
+		if m.Version != i+1 {
+			t.Fatalf("migration %d_%s: versions must count up from 1 without gaps", m.Version, m.Name)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Fatalf("migration %d_%s has an empty script", m.Version, m.Name)
+		}
+	}
+	if got, want := migrations.Latest(), all[len(all)-1].Version; got != want {
+		t.Fatalf("Latest() = %d, want %d", got, want)
+	}
+}
+
+// TestCheck runs against PostgreSQL when POSTGRES_CONN is set. It works in
+// a schema of its own, so the database's other tables are left alone.
+func TestCheck(t *testing.T) {
+	conn := os.Getenv("POSTGRES_CONN")
+	if conn == "" {
+		t.Skip("POSTGRES_CONN is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	admin, err := sql.Open("postgres", conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	schema := fmt.Sprintf("migrations_test_%d", time.Now().UnixNano())
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	defer admin.ExecContext(context.WithoutCancel(ctx), "DROP SCHEMA "+schema+" CASCADE")
+
+	db, err := sql.Open("postgres", withSearchPath(conn, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	latest := migrations.Latest()
+	cases := []struct {
+		name    string
+		prepare func() error
+		ok      bool
+	}{
+		{"empty database", func() error { return nil }, false},
+		{"behind", func() error { return migrations.Up(ctx, db, latest-1) }, false},
+		{"current", func() error { return migrations.Up(ctx, db, 0) }, true},
+		{"ahead", func() error {
+			_, err := db.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, 'from_a_newer_binary')`, latest+1)
+			return err
+		}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.prepare(); err != nil {
+				t.Fatal(err)
+			}
+			err := migrations.Check(ctx, db)
+			if tc.ok && err != nil {
+				t.Fatalf("rejected: %v", err)
+			}
+			if !tc.ok && !errors.Is(err, migrations.ErrSchemaOutdated) {
+				t.Fatalf("got %v, want ErrSchemaOutdated", err)
+			}
+		})
+	}
+}
+
+// withSearchPath adds search_path to a URL or key=value connection string
+func withSearchPath(conn, schema string) string {
+	switch {
+	case !strings.Contains(conn, "://"):
+		return conn + " search_path=" + schema
+	case strings.Contains(conn, "?"):
+		return conn + "&search_path=" + schema
+	default:
+		return conn + "?search_path=" + schema
+	}
+}
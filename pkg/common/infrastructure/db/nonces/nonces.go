@@ -0,0 +1,28 @@
+// Package nonces stores device signature nonces in the GORM device_nonces
+// table. It is shared by the PostgreSQL and SQLite stores.
+package nonces
+
+import (
+	"context"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Claim deletes every nonce expired at now, then inserts nonce unless it is
+// still recorded. The insert is the check: the primary key lets exactly one
+// of several concurrent claims of a nonce through.
+func Claim(ctx context.Context, db *gorm.DB, nonce string, now, expires time.Time) (bool, error) {
+	tx := db.WithContext(ctx)
+	if err := tx.Where("expires_at <= ?", now).Delete(&entities.DeviceNonce{}).Error; err != nil {
+		return false, err
+	}
+	res := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&entities.DeviceNonce{Nonce: nonce, ExpiresAt: expires})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
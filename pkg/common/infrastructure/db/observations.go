@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+)
+
+const (
+	BackendInfluxDB1 = "influxdb1"
+	BackendInfluxDB2 = "influxdb2"
+	BackendTimescale = "timescale"
+)
+
+// ObservationStore is an ObservationRepository that holds connections and
+// must be closed on shutdown
+type ObservationStore interface {
+	repository.ObservationRepository
+	io.Closer
+}
+
+// ObservationConfig selects and configures the observation backend
+type ObservationConfig struct {
+	Backend string
+
+	// InfluxDB 1.x
+	InfluxAddr      string
+	InfluxDB        string
+	InfluxUser      string
+	InfluxPass      string
+	InfluxRetention []RetentionPolicy
+
+	// InfluxDB 2.x
+	InfluxURL    string
+	InfluxToken  string
+	InfluxOrg    string
+	InfluxBucket string
+
+	// TimescaleDB or plain PostgreSQL
+	PostgresConn  string
+	CompressAfter time.Duration
+}
+
+// ObservationConfigFromEnv reads OBS_BACKEND (influxdb1 by default) and the
+// settings of the selected backend. The timescale backend uses
+// OBS_POSTGRES_CONN, falling back to the alerts database in POSTGRES_CONN.
+func ObservationConfigFromEnv() ObservationConfig {
+	backend := os.Getenv("OBS_BACKEND")
+	if backend == "" {
+		backend = BackendInfluxDB1
+	}
+	conn := os.Getenv("OBS_POSTGRES_CONN")
+	if conn == "" {
+		conn = os.Getenv("POSTGRES_CONN")
+	}
+	compressAfter := DefaultCompressAfter
+	if v := os.Getenv("TIMESCALE_COMPRESS_AFTER"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Printf("[Observations] invalid TIMESCALE_COMPRESS_AFTER %q, using %s", v, DefaultCompressAfter)
+		} else {
+			compressAfter = d
+		}
+	}
+	return ObservationConfig{
+		Backend:         backend,
+		InfluxAddr:      os.Getenv("INFLUX_ADDR"),
+		InfluxDB:        os.Getenv("INFLUX_DB"),
+		InfluxUser:      os.Getenv("INFLUX_USER"),
+		InfluxPass:      os.Getenv("INFLUX_PASS"),
+		InfluxRetention: RetentionPoliciesFromEnv(),
+		InfluxURL:       os.Getenv("INFLUX_URL"),
+		InfluxToken:     os.Getenv("INFLUX_TOKEN"),
+		InfluxOrg:       os.Getenv("INFLUX_ORG"),
+		InfluxBucket:    os.Getenv("INFLUX_BUCKET"),
+		PostgresConn:    conn,
+		CompressAfter:   compressAfter,
+	}
+}
+
+// NewObservationStore opens the configured backend. Services that write
+// observations pass manageSchema so retention and storage layout are
+// created at startup; read-only services leave the schema alone.
+func NewObservationStore(cfg ObservationConfig, manageSchema bool) (ObservationStore, error) {
+	switch cfg.Backend {
+	case BackendInfluxDB1:
+		repo, err := NewInfluxRepo(cfg.InfluxAddr, cfg.InfluxDB, cfg.InfluxUser, cfg.InfluxPass, WithRetentionPolicies(cfg.InfluxRetention))
+		if err != nil {
+			return nil, err
+		}
+		if manageSchema && cfg.InfluxRetention != nil {
+			if err := repo.EnsureRetentionPolicies(); err != nil {
+				repo.Close()
+				return nil, err
+			}
+		}
+		return repo, nil
+	case BackendInfluxDB2:
+		return NewInfluxV2Repo(cfg.InfluxURL, cfg.InfluxToken, cfg.InfluxOrg, cfg.InfluxBucket)
+	case BackendTimescale:
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		repo, err := NewTimescaleRepo(ctx, cfg.PostgresConn, cfg.CompressAfter)
+		if err != nil {
+			return nil, err
+		}
+		if manageSchema {
+			if err := repo.EnsureSchema(ctx); err != nil {
+				repo.Close()
+				return nil, err
+			}
+		}
+		return repo, nil
+	default:
+		return nil, fmt.Errorf("db: unknown observation backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,53 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db"
+	rpmtesting "github.com/lioarce01/remote-patient-monitoring-system/pkg/common/testing"
+)
+
+// The server backends run the conformance suite when their settings are
+// present in the environment and are skipped otherwise
+
+func TestInfluxDB1Conformance(t *testing.T) {
+	cfg := db.ObservationConfigFromEnv()
+	if cfg.InfluxAddr == "" || cfg.InfluxDB == "" {
+		t.Skip("INFLUX_ADDR and INFLUX_DB are not set")
+	}
+	checkBackend(t, cfg, db.BackendInfluxDB1)
+}
+
+func TestInfluxDB2Conformance(t *testing.T) {
+	cfg := db.ObservationConfigFromEnv()
+	if cfg.InfluxURL == "" || cfg.InfluxToken == "" {
+		t.Skip("INFLUX_URL and INFLUX_TOKEN are not set")
+	}
+	checkBackend(t, cfg, db.BackendInfluxDB2)
+}
+
+func TestTimescaleConformance(t *testing.T) {
+	cfg := db.ObservationConfigFromEnv()
+	if cfg.PostgresConn == "" {
+		t.Skip("OBS_POSTGRES_CONN and POSTGRES_CONN are not set")
+	}
+	checkBackend(t, cfg, db.BackendTimescale)
+}
+
+func checkBackend(t *testing.T, cfg db.ObservationConfig, backend string) {
+	t.Helper()
+	cfg.Backend = backend
+	store, err := db.NewObservationStore(cfg, true)
+	if err != nil {
+		t.Fatalf("open %s: %v", backend, err)
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := rpmtesting.CheckObservationRepository(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+}
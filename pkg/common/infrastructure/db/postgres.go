@@ -2,14 +2,29 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/alertquery"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/auditlog"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/deliveries"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/escalations"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/migrations"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/nonces"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/webhooks"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var _ repository.AlertRepository = (*PostgresRepo)(nil)
+
 type PostgresRepo struct {
 	db *gorm.DB
 }
@@ -20,14 +35,32 @@ func NewPostgresRepo(conn string) (*PostgresRepo, error) {
 		return nil, err
 	}
 
-	// auto-migrate schema
-	if err := db.AutoMigrate(&entities.Alert{}); err != nil {
+	// the schema is owned by the migrate subcommand; refuse to start against
+	// a database it has not brought to this binary's version
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := migrations.Check(ctx, sqlDB); err != nil {
+		sqlDB.Close()
 		return nil, err
 	}
 
 	return &PostgresRepo{db: db}, nil
 }
 
+// Migrate runs the migrate subcommand (see migrations.Usage) against conn
+func Migrate(ctx context.Context, conn string, args []string) error {
+	sqlDB, err := sql.Open("postgres", conn)
+	if err != nil {
+		return fmt.Errorf("postgres: open failed: %w", err)
+	}
+	defer sqlDB.Close()
+	return migrations.Run(ctx, sqlDB, args)
+}
+
 func (r *PostgresRepo) Save(ctx context.Context, alert *entities.Alert) error {
 	log.Printf("[PostgresRepo] Trying to save alert: %+v", alert)
 	err := r.db.WithContext(ctx).Create(alert).Error
@@ -41,6 +74,256 @@ func (r *PostgresRepo) Save(ctx context.Context, alert *entities.Alert) error {
 
 func (r *PostgresRepo) FetchByPatient(ctx context.Context, patientID string) ([]entities.Alert, error) {
 	var alerts []entities.Alert
-	err := r.db.WithContext(ctx).Where("patient_id = ?", patientID).Find(&alerts).Error
+	err := r.db.WithContext(ctx).Where("patient_id = ?", patientID).Order("timestamp DESC, id DESC").Find(&alerts).Error
 	return alerts, err
 }
+
+func (r *PostgresRepo) FetchSince(ctx context.Context, seq int64, limit int) ([]entities.Alert, error) {
+	var alerts []entities.Alert
+	err := r.db.WithContext(ctx).Where("seq > ?", seq).Order("seq").Limit(limit).Find(&alerts).Error
+	return alerts, err
+}
+
+// FetchByID returns nil, nil when the alert does not exist
+func (r *PostgresRepo) FetchByID(ctx context.Context, id string) (*entities.Alert, error) {
+	var alert entities.Alert
+	err := r.db.WithContext(ctx).First(&alert, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// Acknowledge only updates alerts that are not acknowledged yet, so
+// concurrent acknowledgements keep the first
+func (r *PostgresRepo) Acknowledge(ctx context.Context, id, by string, at time.Time) (*entities.Alert, error) {
+	err := r.db.WithContext(ctx).Model(&entities.Alert{}).Where("id = ? AND acknowledged IS NOT TRUE", id).
+		Updates(map[string]interface{}{"acknowledged": true, "acknowledged_by": by, "acknowledged_at": at}).Error
+	if err != nil {
+		return nil, err
+	}
+	return r.FetchByID(ctx, id)
+}
+
+// Resolve only updates alerts that are not resolved yet, so concurrent
+// resolutions keep the first
+func (r *PostgresRepo) Resolve(ctx context.Context, id, by string, at time.Time) (*entities.Alert, error) {
+	err := r.db.WithContext(ctx).Model(&entities.Alert{}).Where("id = ? AND resolved IS NOT TRUE", id).
+		Updates(map[string]interface{}{"resolved": true, "resolved_by": by, "resolved_at": at}).Error
+	if err != nil {
+		return nil, err
+	}
+	return r.FetchByID(ctx, id)
+}
+
+// CareTeams lists the care teams patientID is assigned to
+func (r *PostgresRepo) CareTeams(ctx context.Context, patientID string) ([]string, error) {
+	var teams []string
+	err := r.db.WithContext(ctx).Model(&entities.PatientCareTeam{}).Where("patient_id = ?", patientID).Pluck("care_team", &teams).Error
+	return teams, err
+}
+
+// Query returns a page of alerts; ward and unit filters join patients
+func (r *PostgresRepo) Query(ctx context.Context, q repository.AlertQuery) (repository.AlertPage, error) {
+	return alertquery.Page(ctx, r.db, q)
+}
+
+// Patients returns the patients table of the same database
+func (r *PostgresRepo) Patients() *PostgresPatientRepo {
+	return &PostgresPatientRepo{db: r.db}
+}
+
+var _ repository.PatientRepository = (*PostgresPatientRepo)(nil)
+
+type PostgresPatientRepo struct {
+	db *gorm.DB
+}
+
+// Save inserts or replaces the patient
+func (p *PostgresPatientRepo) Save(ctx context.Context, patient *entities.Patient) error {
+	return p.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(patient).Error
+}
+
+// FetchByID returns nil, nil when the patient does not exist
+func (p *PostgresPatientRepo) FetchByID(ctx context.Context, id string) (*entities.Patient, error) {
+	var patient entities.Patient
+	err := p.db.WithContext(ctx).First(&patient, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &patient, nil
+}
+
+// AuditLog returns the audit log stored in the same database
+func (r *PostgresRepo) AuditLog() *PostgresAuditLog {
+	return &PostgresAuditLog{db: r.db}
+}
+
+var _ repository.AuditRepository = (*PostgresAuditLog)(nil)
+
+// auditLockID is the transaction advisory lock serializing audit appends
+// across replicas
+const auditLockID = 7_310_442_041
+
+// PostgresAuditLog is the audit_log table. Migration 0006 makes it
+// append-only with triggers.
+type PostgresAuditLog struct {
+	db *gorm.DB
+}
+
+func (l *PostgresAuditLog) Append(ctx context.Context, e *entities.AuditEvent) error {
+	return auditlog.Append(ctx, l.db, e, func(tx *gorm.DB) error {
+		return tx.Exec("SELECT pg_advisory_xact_lock(?)", auditLockID).Error
+	})
+}
+
+func (l *PostgresAuditLog) Query(ctx context.Context, q repository.AuditQuery) (repository.AuditPage, error) {
+	return auditlog.Page(ctx, l.db, q)
+}
+
+func (l *PostgresAuditLog) Verify(ctx context.Context) (repository.AuditVerification, error) {
+	return auditlog.Verify(ctx, l.db)
+}
+
+// Nonces returns the device signature nonces stored in the same database
+func (r *PostgresRepo) Nonces() *PostgresNonceRepo {
+	return &PostgresNonceRepo{db: r.db}
+}
+
+var _ repository.NonceRepository = (*PostgresNonceRepo)(nil)
+
+// PostgresNonceRepo is the device_nonces table, shared by every ingest
+// replica
+type PostgresNonceRepo struct {
+	db *gorm.DB
+}
+
+func (n *PostgresNonceRepo) Claim(ctx context.Context, nonce string, now, expires time.Time) (bool, error) {
+	return nonces.Claim(ctx, n.db, nonce, now, expires)
+}
+
+// Notifications returns the notification deliveries stored in the same
+// database
+func (r *PostgresRepo) Notifications() *PostgresNotificationRepo {
+	return &PostgresNotificationRepo{db: r.db}
+}
+
+var _ repository.NotificationRepository = (*PostgresNotificationRepo)(nil)
+
+// PostgresNotificationRepo is the notification_deliveries table. Claims
+// skip rows other notifiers are claiming, so replicas never send the same
+// delivery at once.
+type PostgresNotificationRepo struct {
+	db *gorm.DB
+}
+
+func (n *PostgresNotificationRepo) Enqueue(ctx context.Context, ds []entities.NotificationDelivery) error {
+	return deliveries.Enqueue(ctx, n.db, ds)
+}
+
+func (n *PostgresNotificationRepo) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.NotificationDelivery, error) {
+	return deliveries.Claim(ctx, n.db, now, lease, limit, true)
+}
+
+func (n *PostgresNotificationRepo) Update(ctx context.Context, d *entities.NotificationDelivery) error {
+	return deliveries.Update(ctx, n.db, d)
+}
+
+func (n *PostgresNotificationRepo) FetchByAlert(ctx context.Context, alertID string) ([]entities.NotificationDelivery, error) {
+	return deliveries.FetchByAlert(ctx, n.db, alertID)
+}
+
+// Escalations returns the alert escalations stored in the same database
+func (r *PostgresRepo) Escalations() *PostgresEscalationRepo {
+	return &PostgresEscalationRepo{db: r.db}
+}
+
+var _ repository.EscalationRepository = (*PostgresEscalationRepo)(nil)
+
+// PostgresEscalationRepo is the alert_escalations table. Like deliveries,
+// claims skip rows other notifiers are claiming.
+type PostgresEscalationRepo struct {
+	db *gorm.DB
+}
+
+func (e *PostgresEscalationRepo) Start(ctx context.Context, esc *entities.Escalation) error {
+	return escalations.Start(ctx, e.db, esc)
+}
+
+func (e *PostgresEscalationRepo) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.Escalation, error) {
+	return escalations.Claim(ctx, e.db, now, lease, limit, true)
+}
+
+func (e *PostgresEscalationRepo) Update(ctx context.Context, esc *entities.Escalation) error {
+	return escalations.Update(ctx, e.db, esc)
+}
+
+func (e *PostgresEscalationRepo) FetchByAlert(ctx context.Context, alertID string) (*entities.Escalation, error) {
+	return escalations.FetchByAlert(ctx, e.db, alertID)
+}
+
+// Webhooks returns the webhook subscriptions and deliveries stored in the
+// same database
+func (r *PostgresRepo) Webhooks() *PostgresWebhookRepo {
+	return &PostgresWebhookRepo{db: r.db}
+}
+
+var _ repository.WebhookRepository = (*PostgresWebhookRepo)(nil)
+
+// PostgresWebhookRepo is the webhook_subscriptions and webhook_deliveries
+// tables. Like notification deliveries, claims skip rows other senders are
+// claiming.
+type PostgresWebhookRepo struct {
+	db *gorm.DB
+}
+
+func (w *PostgresWebhookRepo) CreateSubscription(ctx context.Context, s *entities.WebhookSubscription) error {
+	return webhooks.CreateSubscription(ctx, w.db, s)
+}
+
+func (w *PostgresWebhookRepo) Subscriptions(ctx context.Context) ([]entities.WebhookSubscription, error) {
+	return webhooks.Subscriptions(ctx, w.db)
+}
+
+func (w *PostgresWebhookRepo) FetchSubscription(ctx context.Context, id string) (*entities.WebhookSubscription, error) {
+	return webhooks.FetchSubscription(ctx, w.db, id)
+}
+
+func (w *PostgresWebhookRepo) DeleteSubscription(ctx context.Context, id string) (bool, error) {
+	return webhooks.DeleteSubscription(ctx, w.db, id)
+}
+
+func (w *PostgresWebhookRepo) EnqueueDeliveries(ctx context.Context, ds []entities.WebhookDelivery) error {
+	return webhooks.EnqueueDeliveries(ctx, w.db, ds)
+}
+
+func (w *PostgresWebhookRepo) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.WebhookDelivery, error) {
+	return webhooks.ClaimDeliveries(ctx, w.db, now, lease, limit, true)
+}
+
+func (w *PostgresWebhookRepo) UpdateDelivery(ctx context.Context, d *entities.WebhookDelivery) error {
+	return webhooks.UpdateDelivery(ctx, w.db, d)
+}
+
+func (w *PostgresWebhookRepo) FetchDelivery(ctx context.Context, id string) (*entities.WebhookDelivery, error) {
+	return webhooks.FetchDelivery(ctx, w.db, id)
+}
+
+func (w *PostgresWebhookRepo) Deliveries(ctx context.Context, q repository.WebhookDeliveryQuery) (repository.WebhookDeliveryPage, error) {
+	return webhooks.Deliveries(ctx, w.db, q)
+}
+
+// Close closes the underlying connection pool.
+func (r *PostgresRepo) Close() error {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
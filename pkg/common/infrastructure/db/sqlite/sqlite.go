@@ -0,0 +1,433 @@
+// Package sqlite stores alerts, patients and observations in a single
+// embedded SQLite file for the all-in-one deployment. It uses a pure-Go
+// driver so binaries still build with CGO disabled.
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/alertquery"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/auditlog"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/deliveries"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/escalations"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/nonces"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/webhooks"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// observationRow is the time-series layout for observations: one row per
+// sample, indexed by patient and time for range scans
+type observationRow struct {
+	ID                string    `gorm:"primaryKey"`
+	PatientID         string    `gorm:"index:idx_observations_patient_time,priority:1"`
+	EffectiveDateTime time.Time `gorm:"index:idx_observations_patient_time,priority:2"`
+	ResourceType      string
+	Status            string
+	CodeText          string
+	DeviceID          string
+	Value             float64
+	Unit              string
+}
+
+func (observationRow) TableName() string { return "observations" }
+
+// Open opens (or creates) the database file at path and migrates its schema
+func Open(path string) (*gorm.DB, error) {
+	// WAL lets API reads proceed while processing writes. Transactions
+	// take the write lock up front: a transaction that reads and then
+	// writes, like a claim, would otherwise fail with SQLITE_BUSY instead
+	// of waiting out the busy timeout when another writer got there first.
+	dsn := fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_txlock=immediate", path)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: open %s failed: %w", path, err)
+	}
+	if err := db.AutoMigrate(&entities.Alert{}, &entities.Patient{}, &entities.PatientCareTeam{}, &entities.AuditEvent{}, &entities.NotificationDelivery{}, &entities.Escalation{}, &entities.WebhookSubscription{}, &entities.WebhookDelivery{}, &entities.DeviceNonce{}, &observationRow{}); err != nil {
+		return nil, fmt.Errorf("sqlite: migrate failed: %w", err)
+	}
+	// the audit log is append-only, as in PostgreSQL
+	for _, op := range []string{"UPDATE", "DELETE"} {
+		trigger := fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS audit_log_no_%s BEFORE %s ON audit_log
+			BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`, strings.ToLower(op), op)
+		if err := db.Exec(trigger).Error; err != nil {
+			return nil, fmt.Errorf("sqlite: migrate failed: %w", err)
+		}
+	}
+	return db, nil
+}
+
+// Close closes the database file
+func Close(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+var _ repository.AlertRepository = (*AlertRepo)(nil)
+
+type AlertRepo struct {
+	db *gorm.DB
+	// SQLite has no sequences, so Save numbers alerts itself
+	seqMu sync.Mutex
+}
+
+func NewAlertRepo(db *gorm.DB) *AlertRepo {
+	return &AlertRepo{db: db}
+}
+
+func (r *AlertRepo) Save(ctx context.Context, alert *entities.Alert) error {
+	// SQLite compares timestamps as text, so store them all in UTC
+	row := *alert
+	row.Timestamp = row.Timestamp.UTC()
+
+	r.seqMu.Lock()
+	defer r.seqMu.Unlock()
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var last int64
+		if err := tx.Model(&entities.Alert{}).Select("COALESCE(MAX(seq), 0)").Scan(&last).Error; err != nil {
+			return err
+		}
+		row.Seq = last + 1
+		return tx.Create(&row).Error
+	})
+	if err != nil {
+		log.Printf("[SQLiteAlertRepo] Error saving alert: %v", err)
+		return err
+	}
+	alert.Seq = row.Seq
+	return nil
+}
+
+func (r *AlertRepo) FetchByPatient(ctx context.Context, patientID string) ([]entities.Alert, error) {
+	var alerts []entities.Alert
+	err := r.db.WithContext(ctx).Where("patient_id = ?", patientID).Order("timestamp DESC, id DESC").Find(&alerts).Error
+	return alerts, err
+}
+
+func (r *AlertRepo) FetchSince(ctx context.Context, seq int64, limit int) ([]entities.Alert, error) {
+	var alerts []entities.Alert
+	err := r.db.WithContext(ctx).Where("seq > ?", seq).Order("seq").Limit(limit).Find(&alerts).Error
+	return alerts, err
+}
+
+func (r *AlertRepo) Query(ctx context.Context, q repository.AlertQuery) (repository.AlertPage, error) {
+	return alertquery.Page(ctx, r.db, q)
+}
+
+// FetchByID returns nil, nil when the alert does not exist
+func (r *AlertRepo) FetchByID(ctx context.Context, id string) (*entities.Alert, error) {
+	var alert entities.Alert
+	err := r.db.WithContext(ctx).First(&alert, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+func (r *AlertRepo) Acknowledge(ctx context.Context, id, by string, at time.Time) (*entities.Alert, error) {
+	err := r.db.WithContext(ctx).Model(&entities.Alert{}).Where("id = ? AND NOT acknowledged", id).
+		Updates(map[string]interface{}{"acknowledged": true, "acknowledged_by": by, "acknowledged_at": at.UTC()}).Error
+	if err != nil {
+		return nil, err
+	}
+	return r.FetchByID(ctx, id)
+}
+
+func (r *AlertRepo) Resolve(ctx context.Context, id, by string, at time.Time) (*entities.Alert, error) {
+	err := r.db.WithContext(ctx).Model(&entities.Alert{}).Where("id = ? AND NOT resolved", id).
+		Updates(map[string]interface{}{"resolved": true, "resolved_by": by, "resolved_at": at.UTC()}).Error
+	if err != nil {
+		return nil, err
+	}
+	return r.FetchByID(ctx, id)
+}
+
+var _ repository.PatientRepository = (*PatientRepo)(nil)
+var _ repository.CareTeamRepository = (*PatientRepo)(nil)
+
+type PatientRepo struct {
+	db *gorm.DB
+}
+
+func NewPatientRepo(db *gorm.DB) *PatientRepo {
+	return &PatientRepo{db: db}
+}
+
+// Save inserts or replaces the patient
+func (r *PatientRepo) Save(ctx context.Context, patient *entities.Patient) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(patient).Error
+}
+
+// AssignCareTeam adds the patient to a care team
+func (r *PatientRepo) AssignCareTeam(ctx context.Context, patientID, careTeam string) error {
+	row := entities.PatientCareTeam{PatientID: patientID, CareTeam: careTeam}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error
+}
+
+func (r *PatientRepo) CareTeams(ctx context.Context, patientID string) ([]string, error) {
+	var teams []string
+	err := r.db.WithContext(ctx).Model(&entities.PatientCareTeam{}).Where("patient_id = ?", patientID).Pluck("care_team", &teams).Error
+	return teams, err
+}
+
+// FetchByID returns nil, nil when the patient does not exist
+func (r *PatientRepo) FetchByID(ctx context.Context, id string) (*entities.Patient, error) {
+	var patient entities.Patient
+	err := r.db.WithContext(ctx).First(&patient, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &patient, nil
+}
+
+var _ repository.AuditRepository = (*AuditLog)(nil)
+
+// AuditLog is the append-only audit_log table
+type AuditLog struct {
+	db *gorm.DB
+	// appends are serialized in process; the file has a single writer
+	mu sync.Mutex
+}
+
+func NewAuditLog(db *gorm.DB) *AuditLog {
+	return &AuditLog{db: db}
+}
+
+func (l *AuditLog) Append(ctx context.Context, e *entities.AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return auditlog.Append(ctx, l.db, e, func(tx *gorm.DB) error { return nil })
+}
+
+func (l *AuditLog) Query(ctx context.Context, q repository.AuditQuery) (repository.AuditPage, error) {
+	return auditlog.Page(ctx, l.db, q)
+}
+
+func (l *AuditLog) Verify(ctx context.Context) (repository.AuditVerification, error) {
+	return auditlog.Verify(ctx, l.db)
+}
+
+var _ repository.NonceRepository = (*NonceRepo)(nil)
+
+// NonceRepo is the device_nonces table. Unlike an in-memory set it survives
+// restarts.
+type NonceRepo struct {
+	db *gorm.DB
+}
+
+func NewNonceRepo(db *gorm.DB) *NonceRepo {
+	return &NonceRepo{db: db}
+}
+
+func (n *NonceRepo) Claim(ctx context.Context, nonce string, now, expires time.Time) (bool, error) {
+	return nonces.Claim(ctx, n.db, nonce, now, expires)
+}
+
+var _ repository.NotificationRepository = (*NotificationRepo)(nil)
+
+// NotificationRepo is the notification_deliveries table
+type NotificationRepo struct {
+	db *gorm.DB
+	// claims are serialized in process; SQLite cannot skip locked rows
+	mu sync.Mutex
+}
+
+func NewNotificationRepo(db *gorm.DB) *NotificationRepo {
+	return &NotificationRepo{db: db}
+}
+
+func (n *NotificationRepo) Enqueue(ctx context.Context, ds []entities.NotificationDelivery) error {
+	return deliveries.Enqueue(ctx, n.db, ds)
+}
+
+func (n *NotificationRepo) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.NotificationDelivery, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return deliveries.Claim(ctx, n.db, now, lease, limit, false)
+}
+
+func (n *NotificationRepo) Update(ctx context.Context, d *entities.NotificationDelivery) error {
+	return deliveries.Update(ctx, n.db, d)
+}
+
+func (n *NotificationRepo) FetchByAlert(ctx context.Context, alertID string) ([]entities.NotificationDelivery, error) {
+	return deliveries.FetchByAlert(ctx, n.db, alertID)
+}
+
+var _ repository.EscalationRepository = (*EscalationRepo)(nil)
+
+// EscalationRepo is the alert_escalations table
+type EscalationRepo struct {
+	db *gorm.DB
+	// claims are serialized in process, as for deliveries
+	mu sync.Mutex
+}
+
+func NewEscalationRepo(db *gorm.DB) *EscalationRepo {
+	return &EscalationRepo{db: db}
+}
+
+func (e *EscalationRepo) Start(ctx context.Context, esc *entities.Escalation) error {
+	return escalations.Start(ctx, e.db, esc)
+}
+
+func (e *EscalationRepo) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.Escalation, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return escalations.Claim(ctx, e.db, now, lease, limit, false)
+}
+
+func (e *EscalationRepo) Update(ctx context.Context, esc *entities.Escalation) error {
+	return escalations.Update(ctx, e.db, esc)
+}
+
+func (e *EscalationRepo) FetchByAlert(ctx context.Context, alertID string) (*entities.Escalation, error) {
+	return escalations.FetchByAlert(ctx, e.db, alertID)
+}
+
+var _ repository.WebhookRepository = (*WebhookRepo)(nil)
+
+// WebhookRepo is the webhook_subscriptions and webhook_deliveries tables
+type WebhookRepo struct {
+	db *gorm.DB
+	// claims are serialized in process, as for notification deliveries
+	mu sync.Mutex
+}
+
+func NewWebhookRepo(db *gorm.DB) *WebhookRepo {
+	return &WebhookRepo{db: db}
+}
+
+func (w *WebhookRepo) CreateSubscription(ctx context.Context, s *entities.WebhookSubscription) error {
+	return webhooks.CreateSubscription(ctx, w.db, s)
+}
+
+func (w *WebhookRepo) Subscriptions(ctx context.Context) ([]entities.WebhookSubscription, error) {
+	return webhooks.Subscriptions(ctx, w.db)
+}
+
+func (w *WebhookRepo) FetchSubscription(ctx context.Context, id string) (*entities.WebhookSubscription, error) {
+	return webhooks.FetchSubscription(ctx, w.db, id)
+}
+
+func (w *WebhookRepo) DeleteSubscription(ctx context.Context, id string) (bool, error) {
+	return webhooks.DeleteSubscription(ctx, w.db, id)
+}
+
+func (w *WebhookRepo) EnqueueDeliveries(ctx context.Context, ds []entities.WebhookDelivery) error {
+	return webhooks.EnqueueDeliveries(ctx, w.db, ds)
+}
+
+func (w *WebhookRepo) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.WebhookDelivery, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return webhooks.ClaimDeliveries(ctx, w.db, now, lease, limit, false)
+}
+
+func (w *WebhookRepo) UpdateDelivery(ctx context.Context, d *entities.WebhookDelivery) error {
+	return webhooks.UpdateDelivery(ctx, w.db, d)
+}
+
+func (w *WebhookRepo) FetchDelivery(ctx context.Context, id string) (*entities.WebhookDelivery, error) {
+	return webhooks.FetchDelivery(ctx, w.db, id)
+}
+
+func (w *WebhookRepo) Deliveries(ctx context.Context, q repository.WebhookDeliveryQuery) (repository.WebhookDeliveryPage, error) {
+	return webhooks.Deliveries(ctx, w.db, q)
+}
+
+var _ repository.ObservationRepository = (*ObservationRepo)(nil)
+
+type ObservationRepo struct {
+	db *gorm.DB
+}
+
+func NewObservationRepo(db *gorm.DB) *ObservationRepo {
+	return &ObservationRepo{db: db}
+}
+
+// Save upserts by observation ID. Ingest and processing both write every
+// observation, so the second write must overwrite rather than fail, the same
+// way a repeated InfluxDB point does.
+func (r *ObservationRepo) Save(ctx context.Context, record *entities.ObservationRecord) error {
+	row := toObservationRow(record)
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&row).Error
+}
+
+// SaveBatch upserts records in multi-row inserts
+func (r *ObservationRepo) SaveBatch(ctx context.Context, records []*entities.ObservationRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	rows := make([]observationRow, len(records))
+	for i, record := range records {
+		rows[i] = toObservationRow(record)
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(rows, 500).Error
+}
+
+func toObservationRow(record *entities.ObservationRecord) observationRow {
+	return observationRow{
+		ID:                record.ID,
+		PatientID:         record.PatientID,
+		EffectiveDateTime: record.EffectiveDateTime.UTC(),
+		ResourceType:      record.ResourceType,
+		Status:            record.Status,
+		CodeText:          record.CodeText,
+		DeviceID:          record.DeviceID,
+		Value:             record.Value,
+		Unit:              record.Unit,
+	}
+}
+
+func (r *ObservationRepo) FetchObservations(ctx context.Context, q repository.ObservationQuery) ([]entities.Observation, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	tx := r.db.WithContext(ctx).
+		Where("patient_id = ?", q.PatientID).
+		Where("effective_date_time >= ? AND effective_date_time <= ?", q.From.UTC(), q.To.UTC())
+	if q.Code != "" {
+		tx = tx.Where("code_text = ?", q.Code)
+	}
+
+	var rows []observationRow
+	if err := tx.Order("effective_date_time").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	records := make([]entities.ObservationRecord, 0, len(rows))
+	for _, row := range rows {
+		records = append(records, entities.ObservationRecord{
+			ID:                row.ID,
+			ResourceType:      row.ResourceType,
+			Status:            row.Status,
+			CodeText:          row.CodeText,
+			PatientID:         row.PatientID,
+			Subject:           row.PatientID,
+			DeviceID:          row.DeviceID,
+			EffectiveDateTime: row.EffectiveDateTime,
+			Value:             row.Value,
+			Unit:              row.Unit,
+		})
+	}
+	return repository.Downsample(records, q), nil
+}
@@ -0,0 +1,65 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/sqlite"
+	rpmtesting "github.com/lioarce01/remote-patient-monitoring-system/pkg/common/testing"
+)
+
+func TestObservationRepoConformance(t *testing.T) {
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "rpm.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlite.Close(store)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := rpmtesting.CheckObservationRepository(ctx, sqlite.NewObservationRepo(store)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNonceRepo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rpm.db")
+	store, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	now := time.Now()
+	nonces := sqlite.NewNonceRepo(store)
+	claim := func(nonce string, at time.Time, want bool) {
+		t.Helper()
+		fresh, err := nonces.Claim(ctx, nonce, at, at.Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fresh != want {
+			t.Fatalf("Claim(%s) at %s = %v, want %v", nonce, at.Format(time.TimeOnly), fresh, want)
+		}
+	}
+	claim("dev-1/a", now, true)
+	claim("dev-1/a", now.Add(30*time.Second), false)
+	claim("dev-2/a", now, true)
+
+	// claimed nonces survive a restart
+	if err := sqlite.Close(store); err != nil {
+		t.Fatal(err)
+	}
+	if store, err = sqlite.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer sqlite.Close(store)
+	nonces = sqlite.NewNonceRepo(store)
+	claim("dev-1/a", now.Add(30*time.Second), false)
+
+	// and may be claimed again once expired
+	claim("dev-1/a", now.Add(2*time.Minute), true)
+}
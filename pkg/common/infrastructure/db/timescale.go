@@ -0,0 +1,395 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+)
+
+var _ repository.ObservationRepository = (*TimescaleRepo)(nil)
+
+// DefaultCompressAfter is how old hypertable chunks get before the
+// compression policy compresses them
+const DefaultCompressAfter = 7 * 24 * time.Hour
+
+// TimescaleRepo stores observations in the "observations" table of a
+// PostgreSQL database. With the timescaledb extension the table is a
+// hypertable with a compression policy; without it the table is range
+// partitioned by month and partitions are created as points arrive.
+type TimescaleRepo struct {
+	pool          *pgxpool.Pool
+	timescale     bool
+	partitioned   bool
+	compressAfter time.Duration
+
+	mu         sync.Mutex
+	partitions map[string]bool
+}
+
+func NewTimescaleRepo(ctx context.Context, conn string, compressAfter time.Duration) (*TimescaleRepo, error) {
+	if conn == "" {
+		return nil, fmt.Errorf("timescale: connection string must be provided")
+	}
+	pool, err := pgxpool.New(ctx, conn)
+	if err != nil {
+		return nil, fmt.Errorf("timescale: pool init failed: %w", err)
+	}
+	r := &TimescaleRepo{pool: pool, compressAfter: compressAfter, partitions: make(map[string]bool)}
+	if err := r.detect(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// detect records whether timescaledb is installed and whether an existing
+// observations table is a partitioned one
+func (r *TimescaleRepo) detect(ctx context.Context) error {
+	err := r.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')`).Scan(&r.timescale)
+	if err != nil {
+		return fmt.Errorf("timescale: extension lookup failed: %w", err)
+	}
+	var kind string
+	err = r.pool.QueryRow(ctx, `SELECT COALESCE((SELECT relkind::text FROM pg_class WHERE oid = to_regclass('observations')), '')`).Scan(&kind)
+	if err != nil {
+		return fmt.Errorf("timescale: table lookup failed: %w", err)
+	}
+	r.partitioned = kind == "p"
+	return nil
+}
+
+const observationColumns = `time, patient_id, code, unit, value, status, device_id, observation_id`
+
+// EnsureSchema creates the observations table, turning it into a compressed
+// hypertable when timescaledb can be installed and into a monthly
+// partitioned table otherwise. It is safe to run on every start.
+func (r *TimescaleRepo) EnsureSchema(ctx context.Context) error {
+	if !r.timescale {
+		var available bool
+		err := r.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'timescaledb')`).Scan(&available)
+		if err != nil {
+			return fmt.Errorf("timescale: extension lookup failed: %w", err)
+		}
+		if available {
+			if _, err := r.pool.Exec(ctx, `CREATE EXTENSION IF NOT EXISTS timescaledb`); err != nil {
+				log.Printf("[TimescaleRepo] cannot install timescaledb, using plain partitions: %v", err)
+			} else {
+				r.timescale = true
+			}
+		}
+	}
+
+	var exists bool
+	if err := r.pool.QueryRow(ctx, `SELECT to_regclass('observations') IS NOT NULL`).Scan(&exists); err != nil {
+		return fmt.Errorf("timescale: table lookup failed: %w", err)
+	}
+	if !exists {
+		ddl := `CREATE TABLE IF NOT EXISTS observations (
+			time           TIMESTAMPTZ      NOT NULL,
+			patient_id     TEXT             NOT NULL,
+			code           TEXT             NOT NULL,
+			unit           TEXT             NOT NULL DEFAULT '',
+			value          DOUBLE PRECISION NOT NULL,
+			status         TEXT             NOT NULL DEFAULT '',
+			device_id      TEXT             NOT NULL DEFAULT '',
+			observation_id TEXT             NOT NULL,
+			PRIMARY KEY (observation_id, time)
+		)`
+		if !r.timescale {
+			ddl += ` PARTITION BY RANGE (time)`
+		}
+		if _, err := r.pool.Exec(ctx, ddl); err != nil {
+			return fmt.Errorf("timescale: create table failed: %w", err)
+		}
+	}
+	if _, err := r.pool.Exec(ctx, `CREATE INDEX IF NOT EXISTS observations_patient_code_time_idx ON observations (patient_id, code, time DESC)`); err != nil {
+		return fmt.Errorf("timescale: create index failed: %w", err)
+	}
+
+	if err := r.detect(ctx); err != nil {
+		return err
+	}
+	if r.partitioned || !r.timescale {
+		log.Printf("[TimescaleRepo] observations stored in monthly partitions")
+		return nil
+	}
+
+	return r.ensureHypertable(ctx)
+}
+
+// ensureHypertable turns observations into a hypertable, enables
+// compression segmented by patient and code and keeps the policy in step
+// with compressAfter; zero removes the policy. Ingest and processing run it
+// concurrently on start, so it holds an advisory lock like partition
+// creation and leaves a policy with the same compress_after alone.
+func (r *TimescaleRepo) ensureHypertable(ctx context.Context) error {
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('observations_hypertable'))`); err != nil {
+			return fmt.Errorf("timescale: hypertable lock failed: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `SELECT create_hypertable('observations', 'time', chunk_time_interval => INTERVAL '1 day', if_not_exists => TRUE)`); err != nil {
+			return fmt.Errorf("timescale: create hypertable failed: %w", err)
+		}
+
+		var enabled bool
+		err := tx.QueryRow(ctx, `SELECT compression_enabled FROM timescaledb_information.hypertables WHERE hypertable_name = 'observations'`).Scan(&enabled)
+		if err != nil {
+			return fmt.Errorf("timescale: hypertable lookup failed: %w", err)
+		}
+		if !enabled {
+			_, err := tx.Exec(ctx, `ALTER TABLE observations SET (
+				timescaledb.compress,
+				timescaledb.compress_segmentby = 'patient_id, code',
+				timescaledb.compress_orderby = 'time DESC'
+			)`)
+			if err != nil {
+				return fmt.Errorf("timescale: enable compression failed: %w", err)
+			}
+		}
+
+		// the policy's compress_after compared with the wanted one; no row
+		// means there is no policy
+		var current bool
+		hasPolicy := true
+		err = tx.QueryRow(ctx, `SELECT (config->>'compress_after')::interval = $1::interval
+			FROM timescaledb_information.jobs
+			WHERE proc_name = 'policy_compression' AND hypertable_name = 'observations'`,
+			pgInterval(r.compressAfter)).Scan(&current)
+		if errors.Is(err, pgx.ErrNoRows) {
+			hasPolicy, err = false, nil
+		}
+		if err != nil {
+			return fmt.Errorf("timescale: compression policy lookup failed: %w", err)
+		}
+
+		want := r.compressAfter > 0
+		if hasPolicy && (!want || !current) {
+			if _, err := tx.Exec(ctx, `SELECT remove_compression_policy('observations', if_exists => TRUE)`); err != nil {
+				return fmt.Errorf("timescale: remove compression policy failed: %w", err)
+			}
+		}
+		if want && !(hasPolicy && current) {
+			if _, err := tx.Exec(ctx, `SELECT add_compression_policy('observations', $1::interval)`, pgInterval(r.compressAfter)); err != nil {
+				return fmt.Errorf("timescale: add compression policy failed: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if r.compressAfter <= 0 {
+		log.Printf("[TimescaleRepo] observations hypertable ready, compression policy disabled")
+		return nil
+	}
+	log.Printf("[TimescaleRepo] observations hypertable ready, compressing chunks older than %s", r.compressAfter)
+	return nil
+}
+
+// ensurePartitions creates the monthly partitions covering records. Each
+// creation holds an advisory lock so ingest and processing starting the
+// same month do not race.
+func (r *TimescaleRepo) ensurePartitions(ctx context.Context, records []*entities.ObservationRecord) error {
+	if !r.partitioned {
+		return nil
+	}
+	for _, rec := range records {
+		t := rec.EffectiveDateTime.UTC()
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		name := fmt.Sprintf("observations_y%04dm%02d", start.Year(), start.Month())
+
+		r.mu.Lock()
+		done := r.partitions[name]
+		r.mu.Unlock()
+		if done {
+			continue
+		}
+
+		err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, name); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF observations FOR VALUES FROM ('%s') TO ('%s')`,
+				name, start.Format(time.RFC3339), start.AddDate(0, 1, 0).Format(time.RFC3339)))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("timescale: create partition %s failed: %w", name, err)
+		}
+
+		r.mu.Lock()
+		r.partitions[name] = true
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+// Save inserts one point. Ingest and processing both save every
+// observation, so a point already stored under the same ID is ignored.
+func (r *TimescaleRepo) Save(ctx context.Context, record *entities.ObservationRecord) error {
+	if err := r.ensurePartitions(ctx, []*entities.ObservationRecord{record}); err != nil {
+		return err
+	}
+
+	log.Printf("[TimescaleRepo] Saving metric: %s=%f", record.CodeText, record.Value)
+
+	_, err := r.pool.Exec(ctx, `INSERT INTO observations (`+observationColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT DO NOTHING`,
+		record.EffectiveDateTime, record.PatientID, record.CodeText, record.Unit,
+		record.Value, record.Status, record.DeviceID, record.ID)
+	if err != nil {
+		return fmt.Errorf("timescale: insert failed: %w", err)
+	}
+	return nil
+}
+
+// SaveBatch loads records with COPY into a staging table and moves them
+// into observations in the same transaction, skipping IDs already stored.
+func (r *TimescaleRepo) SaveBatch(ctx context.Context, records []*entities.ObservationRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := r.ensurePartitions(ctx, records); err != nil {
+		return err
+	}
+
+	rows := make([][]interface{}, len(records))
+	for i, rec := range records {
+		rows[i] = []interface{}{
+			rec.EffectiveDateTime, rec.PatientID, rec.CodeText, rec.Unit,
+			rec.Value, rec.Status, rec.DeviceID, rec.ID,
+		}
+	}
+
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `CREATE TEMP TABLE observations_stage (LIKE observations INCLUDING DEFAULTS) ON COMMIT DROP`); err != nil {
+			return err
+		}
+		columns := strings.Split(strings.ReplaceAll(observationColumns, " ", ""), ",")
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"observations_stage"}, columns, pgx.CopyFromRows(rows)); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO observations (`+observationColumns+`)
+			SELECT `+observationColumns+` FROM observations_stage ON CONFLICT DO NOTHING`)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("timescale: batch insert failed: %w", err)
+	}
+
+	log.Printf("[TimescaleRepo] Saved batch of %d metrics", len(records))
+	return nil
+}
+
+// sqlAggregates maps supported aggregates to SQL; p95 uses percentile_disc
+// so it returns a measured value like the nearest-rank Downsample does
+var sqlAggregates = map[repository.Aggregate]string{
+	repository.AggregateMean: `avg(value)`,
+	repository.AggregateMin:  `min(value)`,
+	repository.AggregateMax:  `max(value)`,
+	repository.AggregateP95:  `percentile_disc(0.95) WITHIN GROUP (ORDER BY value)`,
+	repository.AggregateLast: `(array_agg(value ORDER BY time DESC))[1]`,
+}
+
+// buildSQLQuery renders q as SQL. Buckets are aligned to the Unix epoch with
+// time_bucket on TimescaleDB and date_bin on plain PostgreSQL. The limit is
+// applied per code, matching the other backends.
+func buildSQLQuery(q repository.ObservationQuery, timescale bool) (string, []interface{}) {
+	args := []interface{}{q.PatientID, q.From, q.To}
+	where := `patient_id = $1 AND time >= $2 AND time <= $3`
+	if q.Code != "" {
+		args = append(args, q.Code)
+		where += fmt.Sprintf(` AND code = $%d`, len(args))
+	}
+
+	var inner, partition, order, columns string
+	if q.Interval == 0 {
+		inner = `SELECT ` + observationColumns + ` FROM observations WHERE ` + where
+		columns, partition, order = observationColumns, `code`, `time, code`
+	} else {
+		args = append(args, pgInterval(q.Interval))
+		bucket := fmt.Sprintf(`date_bin($%d::interval, time, TIMESTAMPTZ 'epoch')`, len(args))
+		agg := sqlAggregates[q.Aggregate]
+		if timescale {
+			bucket = fmt.Sprintf(`time_bucket($%d::interval, time, TIMESTAMPTZ 'epoch')`, len(args))
+			if q.Aggregate == repository.AggregateLast {
+				agg = `last(value, time)`
+			}
+		}
+		inner = fmt.Sprintf(`SELECT %s AS bucket, code, unit, %s AS value FROM observations WHERE %s GROUP BY 1, 2, 3`, bucket, agg, where)
+		columns, partition, order = `bucket, code, unit, value`, `code, unit`, `code, unit, bucket`
+	}
+
+	if q.Limit == 0 {
+		return fmt.Sprintf(`SELECT %s FROM (%s) o ORDER BY %s`, columns, inner, order), args
+	}
+	args = append(args, q.Limit)
+	return fmt.Sprintf(`SELECT %s FROM (SELECT o.*, row_number() OVER (PARTITION BY %s ORDER BY %s) AS n FROM (%s) o) r WHERE n <= $%d ORDER BY %s`,
+		columns, partition, order, inner, len(args), order), args
+}
+
+func (r *TimescaleRepo) FetchObservations(ctx context.Context, q repository.ObservationQuery) ([]entities.Observation, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	command, args := buildSQLQuery(q, r.timescale)
+
+	log.Printf("[FetchObservations] patient=%s from=%s to=%s interval=%s agg=%s", q.PatientID, q.From.Format(time.RFC3339), q.To.Format(time.RFC3339), q.Interval, q.Aggregate)
+
+	rows, err := r.pool.Query(ctx, command, args...)
+	if err != nil {
+		return nil, fmt.Errorf("timescale query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var observations []entities.Observation
+	for rows.Next() {
+		record := &entities.ObservationRecord{
+			ResourceType: "Observation",
+			Status:       "Final",
+			PatientID:    q.PatientID,
+			Subject:      q.PatientID,
+		}
+		if q.Interval == 0 {
+			err = rows.Scan(&record.EffectiveDateTime, &record.PatientID, &record.CodeText, &record.Unit,
+				&record.Value, &record.Status, &record.DeviceID, &record.ID)
+			record.Subject = record.PatientID
+		} else {
+			err = rows.Scan(&record.EffectiveDateTime, &record.CodeText, &record.Unit, &record.Value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("timescale scan failed: %w", err)
+		}
+		record.EffectiveDateTime = record.EffectiveDateTime.UTC()
+		if record.Status == "" {
+			record.Status = "Final"
+		}
+		observations = append(observations, entities.ToObservation(record))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("timescale query failed: %w", err)
+	}
+
+	return observations, nil
+}
+
+// pgInterval renders d as a PostgreSQL interval literal
+func pgInterval(d time.Duration) string {
+	return fmt.Sprintf("%d microseconds", d.Microseconds())
+}
+
+// Close closes the connection pool.
+func (r *TimescaleRepo) Close() error {
+	r.pool.Close()
+	return nil
+}
@@ -0,0 +1,126 @@
+// Package webhooks stores webhook subscriptions and deliveries in the GORM
+// webhook_subscriptions and webhook_deliveries tables. It is shared by the
+// PostgreSQL and SQLite stores.
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func CreateSubscription(ctx context.Context, db *gorm.DB, s *entities.WebhookSubscription) error {
+	return db.WithContext(ctx).Create(s).Error
+}
+
+// Subscriptions returns every subscription, oldest first
+func Subscriptions(ctx context.Context, db *gorm.DB) ([]entities.WebhookSubscription, error) {
+	var subs []entities.WebhookSubscription
+	err := db.WithContext(ctx).Order("created_at, id").Find(&subs).Error
+	return subs, err
+}
+
+// FetchSubscription returns the subscription with id, or nil
+func FetchSubscription(ctx context.Context, db *gorm.DB, id string) (*entities.WebhookSubscription, error) {
+	var s entities.WebhookSubscription
+	err := db.WithContext(ctx).First(&s, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// DeleteSubscription deletes the subscription with id and reports whether
+// it existed
+func DeleteSubscription(ctx context.Context, db *gorm.DB, id string) (bool, error) {
+	res := db.WithContext(ctx).Delete(&entities.WebhookSubscription{}, "id = ?", id)
+	return res.RowsAffected > 0, res.Error
+}
+
+// EnqueueDeliveries inserts ds, skipping deliveries that are already stored
+func EnqueueDeliveries(ctx context.Context, db *gorm.DB, ds []entities.WebhookDelivery) error {
+	if len(ds) == 0 {
+		return nil
+	}
+	return db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&ds).Error
+}
+
+// ClaimDeliveries postpones up to limit due pending deliveries by lease
+// inside one transaction and returns them. skipLocked is as in
+// deliveries.Claim.
+func ClaimDeliveries(ctx context.Context, db *gorm.DB, now time.Time, lease time.Duration, limit int, skipLocked bool) ([]entities.WebhookDelivery, error) {
+	var claimed []entities.WebhookDelivery
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		q := tx.Where("status = ? AND next_attempt_at <= ?", entities.WebhookPending, now).
+			Order("next_attempt_at").Limit(limit)
+		if skipLocked {
+			q = q.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := q.Find(&claimed).Error; err != nil || len(claimed) == 0 {
+			return err
+		}
+		ids := make([]string, len(claimed))
+		until := now.Add(lease)
+		for i := range claimed {
+			ids[i] = claimed[i].ID
+			claimed[i].NextAttemptAt = until
+		}
+		return tx.Model(&entities.WebhookDelivery{}).Where("id IN ?", ids).
+			Update("next_attempt_at", until).Error
+	})
+	return claimed, err
+}
+
+// UpdateDelivery stores every field of d
+func UpdateDelivery(ctx context.Context, db *gorm.DB, d *entities.WebhookDelivery) error {
+	return db.WithContext(ctx).Save(d).Error
+}
+
+// FetchDelivery returns the delivery with id, or nil
+func FetchDelivery(ctx context.Context, db *gorm.DB, id string) (*entities.WebhookDelivery, error) {
+	var d entities.WebhookDelivery
+	err := db.WithContext(ctx).First(&d, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Deliveries returns the page of deliveries selected by q, read with a
+// keyset on (created_at, id)
+func Deliveries(ctx context.Context, db *gorm.DB, q repository.WebhookDeliveryQuery) (repository.WebhookDeliveryPage, error) {
+	if err := q.Validate(); err != nil {
+		return repository.WebhookDeliveryPage{}, err
+	}
+	page := repository.WebhookDeliveryPage{Deliveries: []entities.WebhookDelivery{}}
+	tx := db.WithContext(ctx).Where("subscription_id = ?", q.SubscriptionID)
+	if q.Status != "" {
+		tx = tx.Where("status = ?", q.Status)
+	}
+	if q.Cursor != "" {
+		c, _ := repository.DecodeWebhookDeliveryCursor(q.Cursor)
+		tx = tx.Where("(created_at, id) < (?, ?)", c.Timestamp, c.ID)
+	}
+	// one extra row tells whether there is a next page
+	err := tx.Order("created_at DESC, id DESC").Limit(q.Limit + 1).Find(&page.Deliveries).Error
+	if err != nil {
+		return page, fmt.Errorf("query webhook deliveries: %w", err)
+	}
+	if len(page.Deliveries) > q.Limit {
+		page.Deliveries = page.Deliveries[:q.Limit]
+		page.NextCursor = repository.EncodeWebhookDeliveryCursor(page.Deliveries[q.Limit-1])
+	}
+	return page, nil
+}
@@ -2,15 +2,29 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"io"
 	"log"
 	"time"
 
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
 	kafka "github.com/segmentio/kafka-go"
 )
 
+var _ repository.Subscriber = (*KafkaConsumer)(nil)
+
 type KafkaConsumer struct{ r *kafka.Reader }
 
-func NewKafkaConsumer(brokers []string, topic, group string) *KafkaConsumer {
+// ConsumerOption adjusts the reader of a KafkaConsumer
+type ConsumerOption func(*kafka.ReaderConfig)
+
+// StartAtNewest makes a group without committed offsets start at the end
+// of the topic instead of at the oldest retained message
+func StartAtNewest() ConsumerOption {
+	return func(cfg *kafka.ReaderConfig) { cfg.StartOffset = kafka.LastOffset }
+}
+
+func NewKafkaConsumer(brokers []string, topic, group string, opts ...ConsumerOption) *KafkaConsumer {
 	if topic == "" {
 		log.Fatal("Kafka topic must be provided but is empty")
 	}
@@ -21,22 +35,65 @@ func NewKafkaConsumer(brokers []string, topic, group string) *KafkaConsumer {
 		log.Fatal("Kafka brokers must be provided")
 	}
 
-	return &KafkaConsumer{
-		kafka.NewReader(kafka.ReaderConfig{
-			Brokers: brokers,
-			Topic:   topic,
-			GroupID: group,
-		}),
+	cfg := kafka.ReaderConfig{
+		Brokers: brokers,
+		Topic:   topic,
+		GroupID: group,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
 	}
+	return &KafkaConsumer{kafka.NewReader(cfg)}
 }
 
-func (c *KafkaConsumer) Consume(ctx context.Context, handler func(key, val []byte)) {
+// Consume reads messages until ctx is cancelled. Offsets are committed only
+// after the handler succeeds, so a message being handled when shutdown starts
+// is finished and committed instead of being dropped. A failed message is
+// retried in place, holding back its partition, until the handler succeeds
+// or ctx is cancelled; it is then left uncommitted for the next consumer.
+func (c *KafkaConsumer) Consume(ctx context.Context, handler func(key, val []byte) error) error {
 	for {
-		msg, err := c.r.ReadMessage(ctx)
+		msg, err := c.r.FetchMessage(ctx)
 		if err != nil {
-			time.Sleep(time.Second)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				return err
+			}
+			log.Printf("[KafkaConsumer] fetch error: %v", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
 			continue
 		}
-		handler(msg.Key, msg.Value)
+
+		for attempt := 1; ; attempt++ {
+			err := handler(msg.Key, msg.Value)
+			if err == nil {
+				break
+			}
+			delay := repository.RedeliveryDelay(attempt)
+			log.Printf("[KafkaConsumer] handler error at %s/%d offset %d, retrying in %s: %v",
+				msg.Topic, msg.Partition, msg.Offset, delay, err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		// commit with a detached context so the last offset is stored even
+		// when ctx was cancelled while the handler was running
+		if err := c.r.CommitMessages(context.WithoutCancel(ctx), msg); err != nil {
+			log.Printf("[KafkaConsumer] commit error: %v", err)
+		}
 	}
 }
+
+// Close leaves the consumer group and releases the reader connections.
+func (c *KafkaConsumer) Close() error {
+	return c.r.Close()
+}
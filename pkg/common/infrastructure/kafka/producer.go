@@ -6,9 +6,12 @@ import (
 	"log"
 
 	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
 	kafka "github.com/segmentio/kafka-go"
 )
 
+var _ repository.Publisher = (*KafkaPublisher)(nil)
+
 type KafkaPublisher struct {
 	w     *kafka.Writer
 	topic string
@@ -41,3 +44,8 @@ func (p *KafkaPublisher) PublishFHIR(ctx context.Context, payload []byte) error
 		Value: payload,
 	})
 }
+
+// Close flushes any pending writes and closes the writer.
+func (p *KafkaPublisher) Close() error {
+	return p.w.Close()
+}
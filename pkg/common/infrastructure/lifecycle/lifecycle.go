@@ -0,0 +1,104 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultShutdownTimeout is used when SHUTDOWN_TIMEOUT is unset or invalid
+const DefaultShutdownTimeout = 15 * time.Second
+
+// ShutdownTimeout reads SHUTDOWN_TIMEOUT as a Go duration (e.g. "30s")
+func ShutdownTimeout() time.Duration {
+	raw := os.Getenv("SHUTDOWN_TIMEOUT")
+	if raw == "" {
+		return DefaultShutdownTimeout
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		log.Printf("invalid SHUTDOWN_TIMEOUT %q, defaulting to %s", raw, DefaultShutdownTimeout)
+		return DefaultShutdownTimeout
+	}
+	return d
+}
+
+// Deadline bounds a whole shutdown to one timeout. Its clock starts the
+// first time Remaining is called, so each later step only gets what the
+// earlier ones left.
+type Deadline struct {
+	timeout time.Duration
+	once    sync.Once
+	at      time.Time
+}
+
+func NewDeadline(timeout time.Duration) *Deadline {
+	return &Deadline{timeout: timeout}
+}
+
+// Remaining returns the time left before the deadline, never less than zero
+func (d *Deadline) Remaining() time.Duration {
+	d.once.Do(func() { d.at = time.Now().Add(d.timeout) })
+	return max(time.Until(d.at), 0)
+}
+
+// Serve runs srv until ctx is cancelled, then stops accepting connections
+// and waits for in-flight requests to finish before deadline. srv serves
+// HTTPS when its TLSConfig carries a certificate.
+func Serve(ctx context.Context, srv *http.Server, deadline *Deadline) error {
+	errCh := make(chan error, 1)
+	go func() {
+		listen := srv.ListenAndServe
+		if srv.TLSConfig != nil && len(srv.TLSConfig.Certificates) > 0 {
+			listen = func() error { return srv.ListenAndServeTLS("", "") }
+		}
+		if err := listen(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	select {
+	case err, ok := <-errCh:
+		if ok {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), deadline.Remaining())
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	return <-errCh
+}
+
+// Wait blocks until done is closed or timeout elapses. It reports whether
+// done was closed in time.
+func Wait(done <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Close closes c and logs any error under the given name.
+func Close(name string, c io.Closer) {
+	if c == nil {
+		return
+	}
+	if err := c.Close(); err != nil {
+		log.Printf("error closing %s: %v", name, err)
+		return
+	}
+	log.Printf("%s closed", name)
+}
@@ -0,0 +1,29 @@
+package lifecycle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeadlineIsSharedBySteps(t *testing.T) {
+	d := NewDeadline(100 * time.Millisecond)
+	if got := d.Remaining(); got <= 50*time.Millisecond || got > 100*time.Millisecond {
+		t.Fatalf("first Remaining = %s, want about 100ms", got)
+	}
+
+	// a step that never finishes uses up the deadline
+	if Wait(make(chan struct{}), d.Remaining()) {
+		t.Fatal("Wait on an open channel reported done")
+	}
+	if got := d.Remaining(); got != 0 {
+		t.Fatalf("Remaining after the deadline = %s, want 0", got)
+	}
+
+	start := time.Now()
+	if Wait(make(chan struct{}), d.Remaining()) {
+		t.Fatal("Wait on an open channel reported done")
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("Wait after the deadline took %s, want it to return at once", elapsed)
+	}
+}
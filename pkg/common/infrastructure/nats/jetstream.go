@@ -0,0 +1,199 @@
+// Package nats implements the publisher and subscriber contracts on NATS
+// JetStream, for sites that would rather not operate a Kafka cluster.
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// keyHeader carries the Kafka-style message key
+const keyHeader = "Rpm-Key"
+
+// connect opens a connection and ensures a stream exists for topic. Each
+// topic is stored in its own stream whose only subject is the topic name.
+func connect(ctx context.Context, url, topic string) (*natsgo.Conn, jetstream.JetStream, string, error) {
+	if url == "" || topic == "" {
+		return nil, nil, "", errors.New("nats: url and topic are required")
+	}
+	nc, err := natsgo.Connect(url, natsgo.Name("rpm-"+topic))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("nats: connect failed: %w", err)
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, nil, "", fmt.Errorf("nats: jetstream init failed: %w", err)
+	}
+	stream := streamName(topic)
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     stream,
+		Subjects: []string{topic},
+	})
+	if err != nil {
+		nc.Close()
+		return nil, nil, "", fmt.Errorf("nats: ensure stream %s failed: %w", stream, err)
+	}
+	return nc, js, stream, nil
+}
+
+// streamName maps a topic to a valid JetStream stream or consumer name
+func streamName(topic string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ' ', '*', '>', '/', '\\':
+			return '_'
+		}
+		return r
+	}, strings.ToUpper(topic))
+}
+
+var _ repository.Publisher = (*JetStreamPublisher)(nil)
+
+type JetStreamPublisher struct {
+	nc    *natsgo.Conn
+	js    jetstream.JetStream
+	topic string
+}
+
+func NewJetStreamPublisher(ctx context.Context, url, topic string) (*JetStreamPublisher, error) {
+	nc, js, _, err := connect(ctx, url, topic)
+	if err != nil {
+		return nil, err
+	}
+	return &JetStreamPublisher{nc: nc, js: js, topic: topic}, nil
+}
+
+func (p *JetStreamPublisher) publish(ctx context.Context, key, value []byte) error {
+	msg := natsgo.NewMsg(p.topic)
+	msg.Data = value
+	if len(key) > 0 {
+		msg.Header.Set(keyHeader, string(key))
+	}
+	_, err := p.js.PublishMsg(ctx, msg)
+	return err
+}
+
+func (p *JetStreamPublisher) PublishObservation(ctx context.Context, obs *entities.ObservationRecord) error {
+	msg, _ := json.Marshal(obs)
+	return p.publish(ctx, []byte(obs.PatientID), msg)
+}
+
+func (p *JetStreamPublisher) PublishAlert(ctx context.Context, alert *entities.Alert) error {
+	msg, _ := json.Marshal(alert)
+	return p.publish(ctx, []byte(alert.PatientID), msg)
+}
+
+func (p *JetStreamPublisher) PublishFHIR(ctx context.Context, payload []byte) error {
+	return p.publish(ctx, nil, payload)
+}
+
+// Close flushes buffered publishes and closes the connection
+func (p *JetStreamPublisher) Close() error {
+	return p.nc.Drain()
+}
+
+var _ repository.Subscriber = (*JetStreamSubscriber)(nil)
+
+type JetStreamSubscriber struct {
+	nc       *natsgo.Conn
+	consumer jetstream.Consumer
+}
+
+// SubscriberOption adjusts the consumer of a JetStreamSubscriber
+type SubscriberOption func(*jetstream.ConsumerConfig)
+
+// ExpireAfter deletes the durable consumer once nothing has consumed from
+// it for d, for groups that are not reused after their subscriber leaves
+func ExpireAfter(d time.Duration) SubscriberOption {
+	return func(cfg *jetstream.ConsumerConfig) { cfg.InactiveThreshold = d }
+}
+
+// NewJetStreamSubscriber binds a durable pull consumer named after group,
+// so subscribers sharing a group split the messages like a Kafka group.
+func NewJetStreamSubscriber(ctx context.Context, url, topic, group string, opts ...SubscriberOption) (*JetStreamSubscriber, error) {
+	if group == "" {
+		return nil, errors.New("nats: group is required")
+	}
+	nc, js, stream, err := connect(ctx, url, topic)
+	if err != nil {
+		return nil, err
+	}
+	cfg := jetstream.ConsumerConfig{
+		Durable:       streamName(group),
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		DeliverPolicy: jetstream.DeliverNewPolicy,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	consumer, err := js.CreateOrUpdateConsumer(ctx, stream, cfg)
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("nats: ensure consumer %s failed: %w", group, err)
+	}
+	return &JetStreamSubscriber{nc: nc, consumer: consumer}, nil
+}
+
+// Consume delivers messages until ctx is cancelled. Each message is acked
+// after handler succeeds; a failed message is nacked so the server
+// redelivers it after a backoff, and unacked messages are redelivered.
+func (s *JetStreamSubscriber) Consume(ctx context.Context, handler func(key, val []byte) error) error {
+	iter, err := s.consumer.Messages()
+	if err != nil {
+		return fmt.Errorf("nats: start consuming failed: %w", err)
+	}
+	stop := context.AfterFunc(ctx, iter.Stop)
+	defer stop()
+
+	for {
+		msg, err := iter.Next()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+				return err
+			}
+			log.Printf("[JetStreamSubscriber] fetch error: %v", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		if err := handler([]byte(msg.Headers().Get(keyHeader)), msg.Data()); err != nil {
+			attempt := 1
+			if meta, merr := msg.Metadata(); merr == nil {
+				attempt = int(meta.NumDelivered)
+			}
+			delay := repository.RedeliveryDelay(attempt)
+			log.Printf("[JetStreamSubscriber] handler error, redelivering in %s: %v", delay, err)
+			if err := msg.NakWithDelay(delay); err != nil {
+				log.Printf("[JetStreamSubscriber] nak error: %v", err)
+			}
+			continue
+		}
+
+		if err := msg.Ack(); err != nil {
+			log.Printf("[JetStreamSubscriber] ack error: %v", err)
+		}
+	}
+}
+
+// Close drains pending acks and closes the connection
+func (s *JetStreamSubscriber) Close() error {
+	return s.nc.Drain()
+}
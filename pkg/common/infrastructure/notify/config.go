@@ -0,0 +1,49 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+// ChannelsFromEnv builds the channels the environment configures, keyed by
+// channel name. Email needs SMTP_HOST and SMTP_FROM (SMTP_PORT,
+// SMTP_USERNAME and SMTP_PASSWORD are optional). SMS needs SMS_PROVIDER
+// and the provider's SMS_URL, SMS_ACCOUNT_SID, SMS_AUTH_TOKEN, SMS_TOKEN
+// and SMS_FROM. Webhooks and pagers need no setup; PAGER_URL overrides the
+// PagerDuty endpoint.
+func ChannelsFromEnv() (map[string]Channel, error) {
+	channels := map[string]Channel{
+		entities.ChannelWebhook: NewWebhook(),
+		entities.ChannelPager:   NewPager(os.Getenv("PAGER_URL")),
+	}
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		from := os.Getenv("SMTP_FROM")
+		if from == "" {
+			return nil, fmt.Errorf("notify: SMTP_FROM is required with SMTP_HOST")
+		}
+		channels[entities.ChannelEmail] = NewEmail(SMTPConfig{
+			Host:     host,
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		})
+	}
+	if provider := os.Getenv("SMS_PROVIDER"); provider != "" {
+		sms, err := NewSMS(SMSConfig{
+			Provider:   provider,
+			URL:        os.Getenv("SMS_URL"),
+			AccountSID: os.Getenv("SMS_ACCOUNT_SID"),
+			AuthToken:  os.Getenv("SMS_AUTH_TOKEN"),
+			Token:      os.Getenv("SMS_TOKEN"),
+			From:       os.Getenv("SMS_FROM"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		channels[entities.ChannelSMS] = sms
+	}
+	return channels, nil
+}
@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+// SMTPConfig is the relay email is sent through. Username and Password
+// enable PLAIN authentication, which net/smtp only allows over TLS or to
+// localhost.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Email sends deliveries as plain-text mail; Recipient is the address
+type Email struct {
+	cfg SMTPConfig
+}
+
+func NewEmail(cfg SMTPConfig) *Email {
+	if cfg.Port == "" {
+		cfg.Port = "25"
+	}
+	return &Email{cfg: cfg}
+}
+
+func (e *Email) Send(ctx context.Context, d *entities.NotificationDelivery) error {
+	if strings.ContainsAny(d.Recipient, "\r\n") {
+		return Permanent(fmt.Errorf("invalid email recipient %q", d.Recipient))
+	}
+	var auth smtp.Auth
+	if e.cfg.Username != "" {
+		auth = smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", d.Recipient)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", d.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@rpm>\r\n", d.ID)
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(d.Body, "\r\n", "\n"), "\n", "\r\n"))
+
+	// net/smtp has no context; the send runs until the relay answers
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(net.JoinHostPort(e.cfg.Host, e.cfg.Port), auth, e.cfg.From, []string{d.Recipient}, []byte(msg.String()))
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	// 5xx replies reject the message or recipient for good
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return Permanent(err)
+	}
+	return err
+}
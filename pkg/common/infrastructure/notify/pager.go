@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+// pagerDutyURL is the PagerDuty Events API v2 endpoint
+const pagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Pager triggers PagerDuty incidents through the Events API v2. Recipient
+// is the integration's routing key. Deliveries of one alert share a dedup
+// key, so PagerDuty folds them into one incident.
+type Pager struct {
+	url    string
+	client *http.Client
+}
+
+// NewPager posts to url, or to PagerDuty when url is empty
+func NewPager(url string) *Pager {
+	if url == "" {
+		url = pagerDutyURL
+	}
+	return &Pager{url: url, client: newHTTPClient()}
+}
+
+type pagerEvent struct {
+	RoutingKey  string       `json:"routing_key"`
+	EventAction string       `json:"event_action"`
+	DedupKey    string       `json:"dedup_key"`
+	Payload     pagerPayload `json:"payload"`
+}
+
+type pagerPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	CustomDetails map[string]string `json:"custom_details"`
+}
+
+func (p *Pager) Send(ctx context.Context, d *entities.NotificationDelivery) error {
+	summary := d.Subject
+	if summary == "" {
+		summary = d.Body
+	}
+	// PagerDuty caps summaries at 1024 characters
+	if len(summary) > 1024 {
+		summary = summary[:1024]
+	}
+	severity := d.Severity
+	if entities.SeverityRank(severity) == 0 {
+		severity = entities.SeverityWarning
+	}
+	body, err := json.Marshal(pagerEvent{
+		RoutingKey:  d.Recipient,
+		EventAction: "trigger",
+		DedupKey:    d.AlertID,
+		Payload: pagerPayload{
+			Summary:  summary,
+			Source:   "rpm",
+			Severity: severity,
+			CustomDetails: map[string]string{
+				"alert_id":   d.AlertID,
+				"patient_id": d.PatientID,
+				"details":    d.Body,
+			},
+		},
+	})
+	if err != nil {
+		return Permanent(err)
+	}
+	return post(ctx, p.client, p.url, "application/json", body, nil)
+}
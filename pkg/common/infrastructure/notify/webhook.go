@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+// Webhook posts the delivery Body, a JSON document, to the Recipient URL
+type Webhook struct {
+	client *http.Client
+}
+
+func NewWebhook() *Webhook {
+	return &Webhook{client: newHTTPClient()}
+}
+
+func (w *Webhook) Send(ctx context.Context, d *entities.NotificationDelivery) error {
+	if u, err := url.Parse(d.Recipient); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Permanent(fmt.Errorf("invalid webhook URL %q", d.Recipient))
+	}
+	header := http.Header{}
+	header.Set("Idempotency-Key", d.ID)
+	return post(ctx, w.client, d.Recipient, "application/json", []byte(d.Body), header)
+}
@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config tunes delivery. Attempt n waits Backoff doubled n-1 times, at most
+// MaxBackoff; after MaxAttempts failed attempts a delivery is dead.
+type Config struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	// Timeout bounds one attempt
+	Timeout time.Duration
+	// PollInterval is how often due deliveries are looked for
+	PollInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:  10,
+		Backoff:      10 * time.Second,
+		MaxBackoff:   time.Hour,
+		Timeout:      10 * time.Second,
+		PollInterval: time.Second,
+	}
+}
+
+// ConfigFromEnv reads WEBHOOK_MAX_ATTEMPTS, WEBHOOK_BACKOFF,
+// WEBHOOK_MAX_BACKOFF, WEBHOOK_TIMEOUT and WEBHOOK_POLL_INTERVAL, keeping
+// the default for unset or invalid values
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if raw := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			cfg.MaxAttempts = n
+		} else {
+			log.Printf("invalid WEBHOOK_MAX_ATTEMPTS %q, defaulting to %d", raw, cfg.MaxAttempts)
+		}
+	}
+	for name, d := range map[string]*time.Duration{
+		"WEBHOOK_BACKOFF":       &cfg.Backoff,
+		"WEBHOOK_MAX_BACKOFF":   &cfg.MaxBackoff,
+		"WEBHOOK_TIMEOUT":       &cfg.Timeout,
+		"WEBHOOK_POLL_INTERVAL": &cfg.PollInterval,
+	} {
+		raw := os.Getenv(name)
+		if raw == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(raw); err == nil && v > 0 {
+			*d = v
+		} else {
+			log.Printf("invalid %s %q, defaulting to %s", name, raw, *d)
+		}
+	}
+	return cfg.normalize()
+}
+
+// normalize repairs settings that cannot work
+func (c Config) normalize() Config {
+	def := DefaultConfig()
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = def.MaxAttempts
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = def.Backoff
+	}
+	if c.MaxBackoff < c.Backoff {
+		c.MaxBackoff = c.Backoff
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = def.Timeout
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = def.PollInterval
+	}
+	return c
+}
+
+// Delay is the wait after the given number of failed attempts
+func (c Config) Delay(attempts int) time.Duration {
+	d := c.Backoff
+	for i := 1; i < attempts && d < c.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, c.MaxBackoff)
+}
@@ -0,0 +1,30 @@
+package webhook_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/webhook"
+)
+
+func TestConfigDelay(t *testing.T) {
+	cfg := webhook.Config{Backoff: 10 * time.Second, MaxBackoff: time.Minute}
+
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute},
+		{5, time.Minute},
+		{1000, time.Minute},
+	}
+	for _, tc := range cases {
+		if got := cfg.Delay(tc.attempts); got != tc.want {
+			t.Errorf("Delay(%d) = %s, want %s", tc.attempts, got, tc.want)
+		}
+	}
+}
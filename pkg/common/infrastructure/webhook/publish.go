@@ -0,0 +1,128 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+)
+
+// Event is something that happened to an alert. Role and Step describe an
+// escalation step.
+type Event struct {
+	Type  string
+	Alert *entities.Alert
+	Role  string
+	Step  int
+}
+
+// Publisher queues a delivery of each event to every subscription whose
+// filters match it. Publishing the same event twice queues it once.
+type Publisher struct {
+	store    repository.WebhookRepository
+	patients repository.PatientRepository
+}
+
+// NewPublisher builds a Publisher; patients resolves the ward of alerts and
+// may be nil when no subscription filters by ward
+func NewPublisher(store repository.WebhookRepository, patients repository.PatientRepository) *Publisher {
+	return &Publisher{store: store, patients: patients}
+}
+
+// Publish queues e and returns how many subscriptions it was queued for
+func (p *Publisher) Publish(ctx context.Context, e Event) (int, error) {
+	subs, err := p.store.Subscriptions(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("load webhook subscriptions: %w", err)
+	}
+	if len(subs) == 0 {
+		return 0, nil
+	}
+
+	ward, err := p.ward(ctx, e.Alert.PatientID)
+	if err != nil {
+		return 0, err
+	}
+	detail := ""
+	if e.Type == entities.EventAlertEscalated {
+		detail = strconv.Itoa(e.Step)
+	}
+	now := time.Now().UTC()
+	event := entities.WebhookEvent{
+		ID:        entities.WebhookEventID(e.Type, e.Alert.ID, detail),
+		Type:      e.Type,
+		CreatedAt: now,
+		Data:      entities.WebhookEventData{Alert: e.Alert, Ward: ward, Role: e.Role, Step: e.Step},
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, fmt.Errorf("encode webhook event: %w", err)
+	}
+
+	var ds []entities.WebhookDelivery
+	for _, s := range subs {
+		if !Matches(s, e.Type, e.Alert, ward) {
+			continue
+		}
+		ds = append(ds, entities.WebhookDelivery{
+			ID:             entities.WebhookDeliveryID(s.ID, event.ID),
+			SubscriptionID: s.ID,
+			EventID:        event.ID,
+			EventType:      e.Type,
+			AlertID:        e.Alert.ID,
+			Payload:        string(payload),
+			Status:         entities.WebhookPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+	}
+	if err := p.store.EnqueueDeliveries(ctx, ds); err != nil {
+		return 0, fmt.Errorf("enqueue webhook deliveries for alert %s: %w", e.Alert.ID, err)
+	}
+	return len(ds), nil
+}
+
+// ward returns the patient's ward, which the payload carries and ward
+// filters select on
+func (p *Publisher) ward(ctx context.Context, patientID string) (string, error) {
+	if p.patients == nil {
+		return "", nil
+	}
+	patient, err := p.patients.FetchByID(ctx, patientID)
+	if err != nil {
+		return "", fmt.Errorf("patient lookup for %s: %w", patientID, err)
+	}
+	if patient == nil {
+		return "", nil
+	}
+	return patient.Ward, nil
+}
+
+// Matches reports whether s selects an event of eventType about alert, whose
+// patient is in ward
+func Matches(s entities.WebhookSubscription, eventType string, alert *entities.Alert, ward string) bool {
+	if len(s.EventTypes) > 0 && !contains(s.EventTypes, eventType) {
+		return false
+	}
+	if s.MinSeverity != "" && entities.SeverityRank(alert.Severity) < entities.SeverityRank(s.MinSeverity) {
+		return false
+	}
+	if len(s.PatientIDs) == 0 && len(s.Wards) == 0 {
+		return true
+	}
+	return contains(s.PatientIDs, alert.PatientID) || contains(s.Wards, ward)
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v && v != "" {
+			return true
+		}
+	}
+	return false
+}
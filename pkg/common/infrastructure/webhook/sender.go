@@ -0,0 +1,153 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// claimBatch is how many due deliveries one claim takes; they are posted
+// concurrently
+const claimBatch = 16
+
+var deliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "rpm_webhook_deliveries_total",
+	Help: "Webhook delivery attempts, by event type and outcome (delivered, retry, dead).",
+}, []string{"event", "outcome"})
+
+// Sender posts due deliveries to their subscription. Several senders may
+// share one store.
+type Sender struct {
+	store  repository.WebhookRepository
+	cfg    Config
+	client *http.Client
+}
+
+func NewSender(store repository.WebhookRepository, cfg Config) *Sender {
+	cfg = cfg.normalize()
+	return &Sender{store: store, cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// Run posts due deliveries until ctx is cancelled. Attempts in flight when
+// ctx is cancelled finish and record their outcome.
+func (s *Sender) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		for s.sendBatch(ctx) {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendBatch posts one claimed batch and reports whether it was full
+func (s *Sender) sendBatch(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	// the lease outlasts an attempt, so a claim never lapses mid-request
+	claimed, err := s.store.ClaimDeliveries(ctx, time.Now().UTC(), 2*s.cfg.Timeout, claimBatch)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("[Webhooks] claiming due deliveries failed: %v", err)
+		}
+		return false
+	}
+	workCtx := context.WithoutCancel(ctx)
+	var wg sync.WaitGroup
+	for i := range claimed {
+		wg.Add(1)
+		go func(d *entities.WebhookDelivery) {
+			defer wg.Done()
+			s.attempt(workCtx, d)
+		}(&claimed[i])
+	}
+	wg.Wait()
+	return len(claimed) == claimBatch
+}
+
+// attempt posts d once and stores the outcome. Deliveries of deleted
+// subscriptions are dead at once.
+func (s *Sender) attempt(ctx context.Context, d *entities.WebhookDelivery) {
+	sub, err := s.store.FetchSubscription(ctx, d.SubscriptionID)
+	if err != nil {
+		log.Printf("[Webhooks] loading subscription %s failed: %v", d.SubscriptionID, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	d.UpdatedAt = now
+	d.ResponseStatus = 0
+	if sub == nil {
+		err = fmt.Errorf("subscription %s was deleted", d.SubscriptionID)
+	} else {
+		d.Attempts++
+		d.ResponseStatus, err = s.post(ctx, sub, d, now)
+		now = time.Now().UTC()
+		d.UpdatedAt = now
+	}
+
+	outcome := entities.WebhookDelivered
+	switch {
+	case err == nil:
+		d.Status = entities.WebhookDelivered
+		d.DeliveredAt = &now
+		d.LastError = ""
+	case sub == nil || d.Attempts >= s.cfg.MaxAttempts:
+		d.Status = entities.WebhookDead
+		d.LastError = err.Error()
+		outcome = entities.WebhookDead
+		log.Printf("[Webhooks] delivery %s of %s dead-lettered after %d attempts: %v", d.ID, d.EventType, d.Attempts, err)
+	default:
+		d.NextAttemptAt = now.Add(s.cfg.Delay(d.Attempts))
+		d.LastError = err.Error()
+		outcome = "retry"
+		log.Printf("[Webhooks] delivery %s of %s failed, retrying at %s: %v", d.ID, d.EventType, d.NextAttemptAt.Format(time.RFC3339), err)
+	}
+	deliveries.WithLabelValues(d.EventType, outcome).Inc()
+	if err := s.store.UpdateDelivery(ctx, d); err != nil {
+		log.Printf("[Webhooks] storing outcome of delivery %s failed: %v", d.ID, err)
+	}
+}
+
+// post sends the signed payload and returns the response status; anything
+// but 2xx is a failure
+func (s *Sender) post(ctx context.Context, sub *entities.WebhookSubscription, d *entities.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "rpm-webhooks/1")
+	req.Header.Set(HeaderEvent, d.EventType)
+	req.Header.Set(HeaderIdempotencyKey, d.ID)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set(HeaderSignatureTimestamp, ts)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, ts, d.ID, body))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, fmt.Errorf("%s %s", resp.Status, bytes.TrimSpace(snippet))
+}
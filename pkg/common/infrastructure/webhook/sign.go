@@ -0,0 +1,74 @@
+// Package webhook posts alert events to the URLs admins subscribe. Events
+// are queued as deliveries, signed with the subscription's secret and
+// retried with exponential backoff until they are delivered or
+// dead-lettered.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+)
+
+// Headers of every delivery. Deliveries are signed the way devices sign
+// ingest requests: X-Signature is "sha256=<hex HMAC-SHA256 of
+// "timestamp.nonce.body">" where the nonce is the Idempotency-Key, the
+// delivery ID, which is stable across retries so receivers can drop
+// repeats.
+const (
+	HeaderEvent              = "X-RPM-Event"
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderSignature          = auth.HeaderSignature
+	HeaderSignatureTimestamp = auth.HeaderSignatureTimestamp
+)
+
+// ErrBadSignature is returned by Verify for unsigned, forged or stale
+// requests
+var ErrBadSignature = errors.New("webhook: bad signature")
+
+// NewSecret returns a random signing secret
+func NewSecret() (string, error) {
+	return random("whsec_", 32)
+}
+
+// NewSubscriptionID returns a random subscription ID
+func NewSubscriptionID() (string, error) {
+	return random("wh-", 12)
+}
+
+func random(prefix string, n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate random webhook value: %w", err)
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// Sign returns the X-Signature value of a delivery sent at timestamp, in
+// Unix seconds
+func Sign(secret, timestamp, deliveryID string, body []byte) string {
+	return auth.SignPayload(secret, timestamp, deliveryID, body)
+}
+
+// Verify checks the signature headers of a delivery and rejects timestamps
+// further than skew from now; a zero skew skips that check. It is what a
+// receiver runs on every request.
+func Verify(secret, timestamp, deliveryID, signature string, body []byte, now time.Time, skew time.Duration) error {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signature == "" || deliveryID == "" {
+		return ErrBadSignature
+	}
+	if age := now.Sub(time.Unix(sec, 0)); skew > 0 && (age > skew || age < -skew) {
+		return fmt.Errorf("%w: signed %s ago", ErrBadSignature, age.Round(time.Second))
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, deliveryID, body))) {
+		return ErrBadSignature
+	}
+	return nil
+}
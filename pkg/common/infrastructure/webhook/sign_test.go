@@ -0,0 +1,85 @@
+package webhook_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/webhook"
+)
+
+func TestVerify(t *testing.T) {
+	const (
+		secret = "whsec_test"
+		id     = "del-1"
+		skew   = 5 * time.Minute
+	)
+	body := []byte(`{"type":"alert.created"}`)
+	now := time.Unix(1_700_000_000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	sig := webhook.Sign(secret, ts, id, body)
+
+	cases := []struct {
+		name      string
+		secret    string
+		timestamp string
+		id        string
+		signature string
+		body      []byte
+		skew      time.Duration
+		ok        bool
+	}{
+		{"valid", secret, ts, id, sig, body, skew, true},
+		{"tampered body", secret, ts, id, sig, []byte(`{"type":"alert.resolved"}`), skew, false},
+		{"wrong secret", "whsec_other", ts, id, sig, body, skew, false},
+		{"other delivery", secret, ts, "del-2", sig, body, skew, false},
+		{"timestamp changed", secret, strconv.FormatInt(now.Unix()+1, 10), id, sig, body, skew, false},
+		{"missing signature", secret, ts, id, "", body, skew, false},
+		{"missing delivery id", secret, ts, "", webhook.Sign(secret, ts, "", body), body, skew, false},
+		{"malformed timestamp", secret, "now", id, webhook.Sign(secret, "now", id, body), body, skew, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := webhook.Verify(tc.secret, tc.timestamp, tc.id, tc.signature, tc.body, now, tc.skew)
+			if tc.ok && err != nil {
+				t.Fatalf("rejected: %v", err)
+			}
+			if !tc.ok && !errors.Is(err, webhook.ErrBadSignature) {
+				t.Fatalf("got %v, want ErrBadSignature", err)
+			}
+		})
+	}
+}
+
+func TestVerifySkew(t *testing.T) {
+	const secret, id = "whsec_test", "del-1"
+	body := []byte(`{}`)
+	signedAt := time.Unix(1_700_000_000, 0)
+	ts := strconv.FormatInt(signedAt.Unix(), 10)
+	sig := webhook.Sign(secret, ts, id, body)
+
+	cases := []struct {
+		name string
+		now  time.Time
+		skew time.Duration
+		ok   bool
+	}{
+		{"on time", signedAt, time.Minute, true},
+		{"at the edge", signedAt.Add(time.Minute), time.Minute, true},
+		{"too old", signedAt.Add(time.Minute + time.Second), time.Minute, false},
+		{"from the future", signedAt.Add(-time.Minute - time.Second), time.Minute, false},
+		{"zero skew accepts any age", signedAt.Add(30 * 24 * time.Hour), 0, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := webhook.Verify(secret, ts, id, sig, body, tc.now, tc.skew)
+			if tc.ok && err != nil {
+				t.Fatalf("rejected: %v", err)
+			}
+			if !tc.ok && !errors.Is(err, webhook.ErrBadSignature) {
+				t.Fatalf("got %v, want ErrBadSignature", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package ws
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxMessageSize bounds a client message
+const maxMessageSize = 64 << 10
+
+// transport writes frames to one WebSocket or SSE connection. Only the
+// client's writer calls write and ping; close may be called at any time.
+type transport interface {
+	write(msg ServerMessage) error
+	ping() error
+	// close ends the connection, telling the peer code and text if the
+	// protocol can
+	close(code int, text string)
+	name() string
+	remoteAddr() string
+}
+
+// frame is a queued message. A broadcast frame carries selects, which the
+// writer runs before sending: it applies the client's subscriptions and
+// access filter, whose lookups may wait on the database.
+type frame struct {
+	msg     ServerMessage
+	selects func(c *client) bool
+}
+
+// client is one connection. Its writer goroutine is the only one writing
+// frames; everyone else queues them.
+type client struct {
+	t      transport
+	filter AccessFilter
+
+	queue     chan frame
+	done      chan struct{}
+	closeOnce sync.Once
+
+	subsMu sync.Mutex
+	subs   map[string]Subscription
+	// sent holds, per subscription, when each patient and code was last
+	// sent, for subscriptions with a MaxRate
+	sent map[string]map[string]time.Time
+	// replaying holds the subscriptions replaying stored alerts, and
+	// recent the alerts sent while one did, to send each alert once
+	replaying map[string]*replayState
+	recent    map[string]time.Time
+	pruneAt   time.Time
+}
+
+func newClient(t transport, filter AccessFilter, queueSize int) *client {
+	return &client{
+		t:      t,
+		filter: filter,
+		queue:  make(chan frame, queueSize),
+		done:   make(chan struct{}),
+		subs:   make(map[string]Subscription),
+		sent:   make(map[string]map[string]time.Time),
+
+		replaying: make(map[string]*replayState),
+		recent:    make(map[string]time.Time),
+	}
+}
+
+// offer queues f without blocking. It returns false when the queue is
+// full; frames for a closed client are discarded.
+func (c *client) offer(f frame) bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+	}
+	select {
+	case c.queue <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+// reply queues a reply to the client's own request, waiting for room. It
+// returns false once the client is closed.
+func (c *client) reply(msg ServerMessage) bool {
+	select {
+	case c.queue <- frame{msg: msg}:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// writePump sends queued frames the client selects, and pings, until the
+// client is closed
+func (c *client) writePump(pingInterval time.Duration) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case f := <-c.queue:
+			if f.selects != nil && !f.selects(c) {
+				continue
+			}
+			if err := c.t.write(f.msg); err != nil {
+				c.close(reasonWriteError, 0, "")
+				return
+			}
+		case <-ticker.C:
+			if err := c.t.ping(); err != nil {
+				c.close(reasonWriteError, 0, "")
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// readPump hands WebSocket messages to handle until the connection fails
+// or nothing, not even a pong, arrives within pongWait
+func (c *client) readPump(conn *websocket.Conn, pongWait time.Duration, handle func([]byte) bool) {
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			reason := reasonClient
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				reason = reasonTimeout
+			}
+			c.close(reason, 0, "")
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		if !handle(raw) {
+			return
+		}
+	}
+}
+
+// close disconnects the client once, counting reason. A non-zero code is
+// a WebSocket close code sent to the peer first.
+func (c *client) close(reason string, code int, text string) {
+	c.closeOnce.Do(func() {
+		disconnects.WithLabelValues(reason).Inc()
+		close(c.done)
+		c.t.close(code, text)
+	})
+}
+
+// wsTransport is a WebSocket connection
+type wsTransport struct {
+	conn *websocket.Conn
+}
+
+func (t wsTransport) write(msg ServerMessage) error {
+	t.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return t.conn.WriteJSON(msg)
+}
+
+func (t wsTransport) ping() error {
+	return t.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+}
+
+func (t wsTransport) close(code int, text string) {
+	if code != 0 {
+		msg := websocket.FormatCloseMessage(code, text)
+		t.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	}
+	t.conn.Close()
+}
+
+func (t wsTransport) name() string       { return "websocket" }
+func (t wsTransport) remoteAddr() string { return t.conn.RemoteAddr().String() }
@@ -0,0 +1,90 @@
+package ws
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Slow client policies, applied to an alert that does not fit in a
+// client's send queue. Vitals that do not fit are always dropped.
+const (
+	SlowClientDisconnect = "disconnect"
+	SlowClientDrop       = "drop"
+)
+
+// Config tunes per-connection queueing and keepalives
+type Config struct {
+	// SendQueue is how many frames may wait for one client's writer
+	SendQueue int
+	// SlowClient is SlowClientDisconnect or SlowClientDrop
+	SlowClient string
+	// PingInterval is how often the server pings each client
+	PingInterval time.Duration
+	// PongWait is how long a client may stay silent, pongs included,
+	// before it is considered dead
+	PongWait time.Duration
+}
+
+// DefaultConfig disconnects slow clients and detects dead peers within
+// a minute
+func DefaultConfig() Config {
+	return Config{
+		SendQueue:    256,
+		SlowClient:   SlowClientDisconnect,
+		PingInterval: 30 * time.Second,
+		PongWait:     60 * time.Second,
+	}
+}
+
+// ConfigFromEnv reads WS_SEND_QUEUE, WS_SLOW_CLIENT, WS_PING_INTERVAL and
+// WS_PONG_WAIT, keeping the defaults for unset or invalid values
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if raw := os.Getenv("WS_SEND_QUEUE"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			cfg.SendQueue = n
+		} else {
+			log.Printf("invalid WS_SEND_QUEUE %q, defaulting to %d", raw, cfg.SendQueue)
+		}
+	}
+	if raw := os.Getenv("WS_SLOW_CLIENT"); raw != "" {
+		if raw == SlowClientDisconnect || raw == SlowClientDrop {
+			cfg.SlowClient = raw
+		} else {
+			log.Printf("invalid WS_SLOW_CLIENT %q, defaulting to %s", raw, cfg.SlowClient)
+		}
+	}
+	for name, d := range map[string]*time.Duration{"WS_PING_INTERVAL": &cfg.PingInterval, "WS_PONG_WAIT": &cfg.PongWait} {
+		raw := os.Getenv(name)
+		if raw == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(raw); err == nil && v > 0 {
+			*d = v
+		} else {
+			log.Printf("invalid %s %q, defaulting to %s", name, raw, *d)
+		}
+	}
+	return cfg.normalize()
+}
+
+// normalize repairs settings that cannot work together
+func (c Config) normalize() Config {
+	def := DefaultConfig()
+	if c.SendQueue <= 0 {
+		c.SendQueue = def.SendQueue
+	}
+	if c.SlowClient != SlowClientDrop {
+		c.SlowClient = SlowClientDisconnect
+	}
+	if c.PingInterval <= 0 {
+		c.PingInterval = def.PingInterval
+	}
+	// a pong can only arrive after a ping was sent
+	if c.PongWait <= c.PingInterval {
+		c.PongWait = 2 * c.PingInterval
+	}
+	return c
+}
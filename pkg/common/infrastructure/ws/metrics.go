@@ -0,0 +1,30 @@
+package ws
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Disconnect reasons
+const (
+	reasonClient     = "client"
+	reasonTimeout    = "timeout"
+	reasonSlow       = "slow"
+	reasonWriteError = "write_error"
+	reasonShutdown   = "shutdown"
+)
+
+var (
+	connectedClients = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpm_ws_connected_clients",
+		Help: "Alert and vital stream clients currently connected, by transport.",
+	}, []string{"transport"})
+	droppedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpm_ws_dropped_messages_total",
+		Help: "Frames not sent because a client's send queue was full, by frame type.",
+	}, []string{"type"})
+	disconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpm_ws_disconnects_total",
+		Help: "Alert and vital stream clients disconnected, by reason.",
+	}, []string{"reason"})
+)
@@ -0,0 +1,156 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+const (
+	// replayBatch is how many stored alerts one history read returns
+	replayBatch = 200
+	// maxReplay bounds the stored alerts examined by one subscribe
+	maxReplay = 5000
+	// replayTimeout bounds one history read
+	replayTimeout = 10 * time.Second
+	// sentWindow is how long replayed alert IDs are remembered, so an alert
+	// both replayed and published shortly after is sent once
+	sentWindow = time.Minute
+	// replayOverlap is how far below since a replay starts. Seq is assigned
+	// when an alert is saved but visible once its transaction commits, so
+	// with concurrent writers an alert may be delivered live before one
+	// with a lower Seq is stored.
+	replayOverlap = 100
+)
+
+// AlertHistory returns up to limit stored alerts with a Seq above seq, in
+// Seq order
+type AlertHistory func(ctx context.Context, seq int64, limit int) ([]entities.Alert, error)
+
+// WithAlertHistory lets subscribers replay missed alerts with since;
+// without it since is rejected
+func WithAlertHistory(history AlertHistory) Option {
+	return func(w *WSHandler) { w.history = history }
+}
+
+// replayState is a subscription replaying stored alerts. Live alerts it
+// selects are buffered until the replay ends.
+type replayState struct {
+	since    int64
+	buffered []*entities.Alert
+}
+
+// replay sends the stored alerts subscription id selects after its since,
+// less replayOverlap, then the live alerts buffered meanwhile, and switches
+// the subscription to live delivery. Alerts in the overlap may have been
+// received before; clients drop them by ID. It returns false once the
+// client is closed.
+func (w *WSHandler) replay(c *client, id string) bool {
+	c.subsMu.Lock()
+	sub, subscribed := c.subs[id]
+	state, replaying := c.replaying[id]
+	c.subsMu.Unlock()
+	if !subscribed || !replaying {
+		return true
+	}
+
+	last, examined, more := max(state.since-replayOverlap, 0), 0, false
+	var failure error
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), replayTimeout)
+		alerts, err := w.history(ctx, last, replayBatch)
+		cancel()
+		if err != nil {
+			failure = err
+			break
+		}
+		for i := range alerts {
+			alert := &alerts[i]
+			last = alert.Seq
+			patient := func() PatientInfo { return w.patients.get(alert.PatientID) }
+			if !sub.matches(alert, patient) || (c.filter != nil && !c.filter(alert.PatientID)) {
+				continue
+			}
+			if c.markSent(alert.ID) && !c.reply(ServerMessage{Type: TypeAlert, Alert: alert}) {
+				return false
+			}
+		}
+		examined += len(alerts)
+		if len(alerts) < replayBatch {
+			break
+		}
+		if examined >= maxReplay {
+			more = true
+			break
+		}
+	}
+
+	for _, alert := range c.endReplay(id) {
+		if c.markSent(alert.ID) && !c.reply(ServerMessage{Type: TypeAlert, Alert: alert}) {
+			return false
+		}
+	}
+	// the overlap is not reported as progress
+	last = max(last, state.since)
+	if failure != nil {
+		log.Printf("[WS] replay after seq %d failed: %v", last, failure)
+		return c.reply(ServerMessage{Type: TypeError, ID: id, Seq: last, Error: "replay failed, live delivery resumed"})
+	}
+	return c.reply(ServerMessage{Type: TypeReplayed, ID: id, Seq: last, More: more})
+}
+
+// buffer holds a live alert for replaying subscription id. A client whose
+// replay falls too far behind live traffic is disconnected.
+func (c *client) buffer(id string, alert *entities.Alert, limit int) {
+	state := c.replaying[id]
+	if len(state.buffered) >= limit {
+		droppedMessages.WithLabelValues(TypeAlert).Inc()
+		go c.close(reasonSlow, websocket.CloseTryAgainLater, "replay fell behind")
+		return
+	}
+	state.buffered = append(state.buffered, alert)
+}
+
+// endReplay switches subscription id to live delivery and returns what was
+// buffered meanwhile
+func (c *client) endReplay(id string) []*entities.Alert {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	state, ok := c.replaying[id]
+	if !ok {
+		return nil
+	}
+	delete(c.replaying, id)
+	return state.buffered
+}
+
+// markSent reports whether alert id should be sent, remembering it while a
+// replay runs or recently ran
+func (c *client) markSent(id string) bool {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	return c.markSentLocked(id)
+}
+
+func (c *client) markSentLocked(id string) bool {
+	if len(c.replaying) == 0 && len(c.recent) == 0 {
+		return true
+	}
+	now := time.Now()
+	if now.After(c.pruneAt) {
+		for sentID, at := range c.recent {
+			if now.Sub(at) > sentWindow {
+				delete(c.recent, sentID)
+			}
+		}
+		c.pruneAt = now.Add(sentWindow)
+	}
+	if at, ok := c.recent[id]; ok && now.Sub(at) <= sentWindow {
+		return false
+	}
+	c.recent[id] = now
+	return true
+}
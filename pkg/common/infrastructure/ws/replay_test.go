@@ -0,0 +1,109 @@
+package ws
+
+import (
+	"context"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+// commitLog is an AlertHistory whose alerts become readable when
+// committed, in any order
+type commitLog struct {
+	mu     sync.Mutex
+	alerts []entities.Alert
+}
+
+func (l *commitLog) commit(a entities.Alert) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.alerts = append(l.alerts, a)
+}
+
+func (l *commitLog) since(ctx context.Context, seq int64, limit int) ([]entities.Alert, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []entities.Alert
+	for _, a := range l.alerts {
+		if a.Seq > seq {
+			out = append(out, a)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Seq < out[j].Seq })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func dialAndSubscribe(t *testing.T, url string, since int64) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := conn.WriteJSON(ClientMessage{Type: TypeSubscribe, ID: "all", Since: since}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if m := readFrame(t, conn); m.Type != TypeSubscribed {
+		t.Fatalf("got %+v, want subscribed", m)
+	}
+	return conn
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) ServerMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var m ServerMessage
+	if err := conn.ReadJSON(&m); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return m
+}
+
+func TestReplayCoversAlertsCommittedOutOfOrder(t *testing.T) {
+	history := &commitLog{}
+	w := NewWSHandler(WithAlertHistory(history.since))
+	srv := httptest.NewServer(w.Handler())
+	defer srv.Close()
+	defer w.Close()
+
+	// seq 2 commits and goes out live while seq 1 is still uncommitted
+	slow := entities.Alert{ID: "alert-slow", PatientID: "p", Seq: 1}
+	fast := entities.Alert{ID: "alert-fast", PatientID: "p", Seq: 2}
+	live := dialAndSubscribe(t, srv.URL, 0)
+	history.commit(fast)
+	w.BroadcastAlert(&fast)
+	if m := readFrame(t, live); m.Type != TypeAlert || m.Alert.ID != fast.ID {
+		t.Fatalf("got %+v, want live %s", m, fast.ID)
+	}
+	live.Close()
+
+	// the client resumes after the highest seq it received
+	history.commit(slow)
+	resumed := dialAndSubscribe(t, srv.URL, fast.Seq)
+	got := make(map[string]bool)
+	for {
+		m := readFrame(t, resumed)
+		if m.Type == TypeReplayed {
+			if m.Seq != fast.Seq {
+				t.Errorf("replayed up to seq %d, want %d", m.Seq, fast.Seq)
+			}
+			break
+		}
+		if m.Type != TypeAlert {
+			t.Fatalf("unexpected frame %+v", m)
+		}
+		got[m.Alert.ID] = true
+	}
+	if !got[slow.ID] {
+		t.Fatalf("replay after seq %d sent %v, missing %s committed late with seq %d", fast.Seq, got, slow.ID, slow.Seq)
+	}
+}
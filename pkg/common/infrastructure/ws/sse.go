@@ -0,0 +1,191 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sseSubscriptionID names the single subscription of an SSE stream
+	sseSubscriptionID = "sse"
+	// sseRetry is the reconnect delay suggested to EventSource clients
+	sseRetry = 3 * time.Second
+)
+
+// SSE serves the stream of Handler as Server-Sent Events. SSE clients share
+// the broadcast hub, authorizer, queues and keepalives with WebSocket ones.
+// The query string holds the one subscription of the stream:
+// patient_ids, wards, care_teams, streams and codes are comma-separated
+// lists, and min_severity and max_rate are as on the WebSocket.
+//
+// Every frame is an event named after its type, whose data is the frame's
+// JSON, starting with subscribed. Alerts carry their Seq as event ID, and so does replayed, so a
+// reconnecting EventSource sends Last-Event-ID and missed alerts are
+// replayed; since in the query string does the same for the first
+// connection. Heartbeat comments are sent every PingInterval.
+func (w *WSHandler) SSE() http.HandlerFunc {
+	return func(wr http.ResponseWriter, r *http.Request) {
+		var filter AccessFilter
+		if w.authorize != nil {
+			f, status, err := w.authorize(r)
+			if err != nil {
+				http.Error(wr, err.Error(), status)
+				return
+			}
+			filter = f
+		}
+		flusher, ok := wr.(http.Flusher)
+		if !ok {
+			http.Error(wr, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		sub, since, err := parseSSERequest(r)
+		if err == nil && since > 0 && w.history == nil {
+			err = fmt.Errorf("alert replay is not available")
+		}
+		if err != nil {
+			http.Error(wr, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		header := wr.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		// nginx buffers responses unless told otherwise
+		header.Set("X-Accel-Buffering", "no")
+		wr.WriteHeader(http.StatusOK)
+		fmt.Fprintf(wr, "retry: %d\n\n", sseRetry.Milliseconds())
+		flusher.Flush()
+
+		t := &sseTransport{w: wr, flusher: flusher, addr: r.RemoteAddr}
+		c := newClient(t, filter, w.cfg.SendQueue)
+		c.subs[sseSubscriptionID] = sub
+		if since > 0 {
+			c.replaying[sseSubscriptionID] = &replayState{since: since}
+		}
+		w.add(c)
+		defer w.remove(c)
+
+		// this goroutine is the writer, so the first frames are queued
+		// from another
+		go func() {
+			if !c.reply(ServerMessage{Type: TypeSubscribed, ID: sseSubscriptionID}) {
+				return
+			}
+			if snapshot, ok := w.vitalSnapshot(c, sseSubscriptionID); ok && !c.reply(snapshot) {
+				return
+			}
+			w.replay(c, sseSubscriptionID)
+		}()
+		go func() {
+			select {
+			case <-r.Context().Done():
+				c.close(reasonClient, 0, "")
+			case <-c.done:
+			}
+		}()
+		c.writePump(w.cfg.PingInterval)
+	}
+}
+
+// parseSSERequest reads the subscription and resume point of an SSE
+// request. Last-Event-ID takes precedence over since.
+func parseSSERequest(r *http.Request) (Subscription, int64, error) {
+	q := r.URL.Query()
+	sub := Subscription{
+		PatientIDs:  queryList(q, "patient_ids"),
+		Wards:       queryList(q, "wards"),
+		CareTeams:   queryList(q, "care_teams"),
+		Streams:     queryList(q, "streams"),
+		MinSeverity: q.Get("min_severity"),
+		Codes:       queryList(q, "codes"),
+	}
+	if raw := q.Get("max_rate"); raw != "" {
+		rate, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return sub, 0, fmt.Errorf("max_rate must be a number")
+		}
+		sub.MaxRate = rate
+	}
+	if err := sub.validate(); err != nil {
+		return sub, 0, err
+	}
+
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = q.Get("since")
+	}
+	if raw == "" {
+		return sub, 0, nil
+	}
+	since, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || since < 0 {
+		return sub, 0, fmt.Errorf("Last-Event-ID and since must be an alert seq")
+	}
+	return sub, since, nil
+}
+
+// queryList splits the comma-separated values of a repeated parameter
+func queryList(q url.Values, name string) []string {
+	var out []string
+	for _, v := range q[name] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+// sseTransport is a Server-Sent Events response. It is written only by
+// the writer running in SSE, so the response ends when the client closes.
+type sseTransport struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	addr    string
+}
+
+func (t *sseTransport) write(msg ServerMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	switch {
+	case msg.Type == TypeAlert && msg.Alert != nil && msg.Alert.Seq > 0:
+		fmt.Fprintf(&b, "id: %d\n", msg.Alert.Seq)
+	case msg.Type == TypeReplayed && msg.Seq > 0:
+		fmt.Fprintf(&b, "id: %d\n", msg.Seq)
+	}
+	fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", msg.Type, data)
+	return t.send(b.String())
+}
+
+func (t *sseTransport) ping() error {
+	return t.send(": heartbeat\n\n")
+}
+
+func (t *sseTransport) send(frame string) error {
+	if _, err := t.w.Write([]byte(frame)); err != nil {
+		return err
+	}
+	t.flusher.Flush()
+	return nil
+}
+
+func (t *sseTransport) close(code int, text string) {
+	if code != 0 {
+		log.Printf("[SSE] closing stream to %s: %s", t.addr, text)
+	}
+}
+
+func (t *sseTransport) name() string       { return "sse" }
+func (t *sseTransport) remoteAddr() string { return t.addr }
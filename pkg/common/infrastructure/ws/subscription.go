@@ -0,0 +1,255 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+// Message types exchanged on the socket
+const (
+	TypeSubscribe    = "subscribe"
+	TypeUnsubscribe  = "unsubscribe"
+	TypeSubscribed   = "subscribed"
+	TypeUnsubscribed = "unsubscribed"
+	TypeAlert        = "alert"
+	TypeVital        = "vital"
+	TypeSnapshot     = "snapshot"
+	TypeReplayed     = "replayed"
+	TypeError        = "error"
+)
+
+// Streams a subscription may select
+const (
+	StreamAlerts = "alerts"
+	StreamVitals = "vitals"
+)
+
+const (
+	// maxSubscriptions bounds the subscriptions one connection may hold
+	maxSubscriptions = 16
+	// maxSelectors bounds each of a subscription's lists
+	maxSelectors = 256
+	// defaultSubscriptionID names a subscription sent without an id
+	defaultSubscriptionID = "default"
+)
+
+// ClientMessage is sent by clients to manage their subscriptions. A
+// subscribe with an existing id replaces that subscription. A positive
+// Since first replays the stored alerts the subscription selects with a
+// higher Seq.
+type ClientMessage struct {
+	Type  string `json:"type"`
+	ID    string `json:"id,omitempty"`
+	Since int64  `json:"since,omitempty"`
+	Subscription
+}
+
+// ServerMessage is every frame the server sends. A snapshot carries the
+// latest vitals selected by subscription ID. Replayed ends a replay: Seq
+// is the last alert examined, and More asks the client to subscribe again
+// from there for the rest.
+type ServerMessage struct {
+	Type   string          `json:"type"`
+	ID     string          `json:"id,omitempty"`
+	Alert  *entities.Alert `json:"alert,omitempty"`
+	Vital  *Vital          `json:"vital,omitempty"`
+	Vitals []Vital         `json:"vitals,omitempty"`
+	Seq    int64           `json:"seq,omitempty"`
+	More   bool            `json:"more,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Subscription selects alerts and live vitals. A patient matches when it
+// is listed in PatientIDs, is in one of Wards or belongs to one of
+// CareTeams; with all three empty every patient the client may read
+// matches.
+//
+// Streams lists what is delivered, alerts only when empty. MinSeverity
+// drops less severe alerts. Codes limits vitals to those codes, and a
+// positive MaxRate sends at most that many samples per second for each
+// patient and code.
+type Subscription struct {
+	PatientIDs  []string `json:"patient_ids,omitempty"`
+	Wards       []string `json:"wards,omitempty"`
+	CareTeams   []string `json:"care_teams,omitempty"`
+	Streams     []string `json:"streams,omitempty"`
+	MinSeverity string   `json:"min_severity,omitempty"`
+	Codes       []string `json:"codes,omitempty"`
+	MaxRate     float64  `json:"max_rate,omitempty"`
+}
+
+func (s Subscription) validate() error {
+	if len(s.PatientIDs) > maxSelectors || len(s.Wards) > maxSelectors || len(s.CareTeams) > maxSelectors || len(s.Codes) > maxSelectors {
+		return fmt.Errorf("at most %d patient_ids, wards, care_teams and codes each", maxSelectors)
+	}
+	for _, stream := range s.Streams {
+		if stream != StreamAlerts && stream != StreamVitals {
+			return fmt.Errorf("streams must be alerts or vitals")
+		}
+	}
+	if s.MinSeverity != "" && entities.SeverityRank(s.MinSeverity) == 0 {
+		return fmt.Errorf("min_severity must be info, warning or critical")
+	}
+	if s.MaxRate < 0 {
+		return fmt.Errorf("max_rate must not be negative")
+	}
+	return nil
+}
+
+func (s Subscription) wantsAlerts() bool {
+	return len(s.Streams) == 0 || contains(s.Streams, StreamAlerts)
+}
+
+func (s Subscription) wantsVitals() bool {
+	return contains(s.Streams, StreamVitals)
+}
+
+// interval is the minimum time between two samples of one patient and code
+func (s Subscription) interval() time.Duration {
+	if s.MaxRate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / s.MaxRate)
+}
+
+// needsPatient reports whether matching needs the patient's ward or teams
+func (s Subscription) needsPatient() bool {
+	return len(s.Wards) > 0 || len(s.CareTeams) > 0
+}
+
+func (s Subscription) matches(alert *entities.Alert, patient func() PatientInfo) bool {
+	return s.mayMatch(alert) && s.selects(alert.PatientID, patient)
+}
+
+func (s Subscription) matchesVital(v Vital, patient func() PatientInfo) bool {
+	return s.mayMatchVital(v) && s.selects(v.PatientID, patient)
+}
+
+// mayMatch is matches before the patient is looked up: it is only false
+// when no ward or care team could make the alert match
+func (s Subscription) mayMatch(alert *entities.Alert) bool {
+	if !s.wantsAlerts() {
+		return false
+	}
+	if s.MinSeverity != "" && entities.SeverityRank(alert.Severity) < entities.SeverityRank(s.MinSeverity) {
+		return false
+	}
+	return s.needsPatient() || s.selects(alert.PatientID, nil)
+}
+
+// mayMatchVital is mayMatch for vitals
+func (s Subscription) mayMatchVital(v Vital) bool {
+	if !s.wantsVitals() {
+		return false
+	}
+	if len(s.Codes) > 0 && !contains(s.Codes, v.Code) {
+		return false
+	}
+	return s.needsPatient() || s.selects(v.PatientID, nil)
+}
+
+// selects applies the patient, ward and care-team lists. patient is only
+// called when the subscription needs it.
+func (s Subscription) selects(patientID string, patient func() PatientInfo) bool {
+	if len(s.PatientIDs) == 0 && !s.needsPatient() {
+		return true
+	}
+	if contains(s.PatientIDs, patientID) {
+		return true
+	}
+	if !s.needsPatient() {
+		return false
+	}
+	info := patient()
+	if info.Ward != "" && contains(s.Wards, info.Ward) {
+		return true
+	}
+	for _, t := range info.CareTeams {
+		if contains(s.CareTeams, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeClientMessage(raw []byte) (ClientMessage, error) {
+	var msg ClientMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return msg, fmt.Errorf("malformed message: %v", err)
+	}
+	if msg.ID == "" {
+		msg.ID = defaultSubscriptionID
+	}
+	return msg, nil
+}
+
+// PatientInfo is what ward and care-team subscriptions match against
+type PatientInfo struct {
+	Ward      string
+	CareTeams []string
+}
+
+// PatientLookup resolves the patient of an alert or vital for ward and
+// care-team subscriptions
+type PatientLookup func(ctx context.Context, patientID string) (PatientInfo, error)
+
+// patientTTL bounds how long a looked up patient is reused
+const patientTTL = time.Minute
+
+// patientCache memoizes a PatientLookup
+type patientCache struct {
+	lookup PatientLookup
+
+	mu      sync.Mutex
+	entries map[string]cachedPatient
+}
+
+type cachedPatient struct {
+	info    PatientInfo
+	expires time.Time
+}
+
+func newPatientCache(lookup PatientLookup) *patientCache {
+	return &patientCache{lookup: lookup, entries: make(map[string]cachedPatient)}
+}
+
+// get returns the zero PatientInfo when no lookup is configured or it fails
+func (c *patientCache) get(patientID string) PatientInfo {
+	if c.lookup == nil {
+		return PatientInfo{}
+	}
+	now := time.Now()
+	c.mu.Lock()
+	e, ok := c.entries[patientID]
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.info
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	info, err := c.lookup(ctx, patientID)
+	if err != nil {
+		log.Printf("[WS] patient lookup for %s failed: %v", patientID, err)
+		return PatientInfo{}
+	}
+	c.mu.Lock()
+	c.entries[patientID] = cachedPatient{info: info, expires: now.Add(patientTTL)}
+	c.mu.Unlock()
+	return info
+}
@@ -0,0 +1,88 @@
+package ws
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+)
+
+// staleVital is the age past which a sample only updates the snapshot.
+// Consumers catching up on a backlog would otherwise replay it live.
+const staleVital = 5 * time.Minute
+
+// Vital is one live sample of a patient's vital sign
+type Vital struct {
+	PatientID string    `json:"patient_id"`
+	Code      string    `json:"code"`
+	Value     float64   `json:"value"`
+	Unit      string    `json:"unit,omitempty"`
+	DeviceID  string    `json:"device_id,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// VitalFromRecord converts a stored observation
+func VitalFromRecord(r *entities.ObservationRecord) Vital {
+	return Vital{
+		PatientID: r.PatientID,
+		Code:      r.CodeText,
+		Value:     r.Value,
+		Unit:      r.Unit,
+		DeviceID:  r.DeviceID,
+		Time:      r.EffectiveDateTime,
+	}
+}
+
+// latestVitals keeps the newest sample of every patient and code seen
+// since the process started
+type latestVitals struct {
+	mu        sync.Mutex
+	byPatient map[string]map[string]Vital
+}
+
+func newLatestVitals() *latestVitals {
+	return &latestVitals{byPatient: make(map[string]map[string]Vital)}
+}
+
+// update stores v unless a newer sample of its patient and code is known
+func (l *latestVitals) update(v Vital) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	codes, ok := l.byPatient[v.PatientID]
+	if !ok {
+		codes = make(map[string]Vital)
+		l.byPatient[v.PatientID] = codes
+	}
+	if prev, ok := codes[v.Code]; ok && prev.Time.After(v.Time) {
+		return false
+	}
+	codes[v.Code] = v
+	return true
+}
+
+// matching returns the samples that match, ordered by patient and code
+func (l *latestVitals) matching(match func(Vital) bool) []Vital {
+	l.mu.Lock()
+	var all []Vital
+	for _, codes := range l.byPatient {
+		for _, v := range codes {
+			all = append(all, v)
+		}
+	}
+	l.mu.Unlock()
+
+	out := []Vital{}
+	for _, v := range all {
+		if match(v) {
+			out = append(out, v)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].PatientID != out[j].PatientID {
+			return out[i].PatientID < out[j].PatientID
+		}
+		return out[i].Code < out[j].Code
+	})
+	return out
+}
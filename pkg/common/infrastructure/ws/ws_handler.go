@@ -4,61 +4,339 @@ import (
 	"log"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
 )
 
+// writeWait bounds a single frame write
+const writeWait = 10 * time.Second
+
+// AccessFilter decides whether a client may receive a patient's alerts
+// and vitals
+type AccessFilter func(patientID string) bool
+
+// Authorizer admits a connection before the upgrade and returns the filter
+// applied to every alert and vital sent to it. Returning an error rejects
+// the upgrade with the given HTTP status.
+type Authorizer func(r *http.Request) (AccessFilter, int, error)
+
+// WSHandler streams alerts and live vitals to clients. A client receives
+// nothing until it subscribes, and then only what its Authorizer filter
+// allows and one of its subscriptions selects.
+//
+// Broadcasts never write to a socket or wait on a lookup: frames go to each
+// client's bounded queue, and that client's writer applies its
+// subscriptions and filter before sending, so one slow client or a slow
+// database cannot delay the others or the consumer calling Broadcast.
 type WSHandler struct {
 	upgrader  websocket.Upgrader
-	clients   map[*websocket.Conn]bool
+	authorize Authorizer
+	patients  *patientCache
+	latest    *latestVitals
+	history   AlertHistory
+	cfg       Config
+	clients   map[*client]struct{}
 	clientsMu sync.Mutex
 }
 
-func NewWSHandler() *WSHandler {
-	return &WSHandler{
-		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool { return true },
-		},
-		clients: make(map[*websocket.Conn]bool),
+type Option func(*WSHandler)
+
+// WithOriginCheck replaces the default same-origin check
+func WithOriginCheck(check func(r *http.Request) bool) Option {
+	return func(w *WSHandler) { w.upgrader.CheckOrigin = check }
+}
+
+// WithAuthorizer authenticates every upgrade request
+func WithAuthorizer(authorize Authorizer) Option {
+	return func(w *WSHandler) { w.authorize = authorize }
+}
+
+// WithPatientLookup enables ward and care-team subscriptions; without it
+// they match nothing
+func WithPatientLookup(lookup PatientLookup) Option {
+	return func(w *WSHandler) { w.patients = newPatientCache(lookup) }
+}
+
+// WithConfig replaces DefaultConfig
+func WithConfig(cfg Config) Option {
+	return func(w *WSHandler) { w.cfg = cfg.normalize() }
+}
+
+// NewWSHandler accepts same-origin connections and lets every client
+// subscribe to every alert unless options say otherwise
+func NewWSHandler(opts ...Option) *WSHandler {
+	w := &WSHandler{
+		patients: newPatientCache(nil),
+		latest:   newLatestVitals(),
+		cfg:      DefaultConfig(),
+		clients:  make(map[*client]struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
 	}
+	return w
 }
 
 func (w *WSHandler) BroadcastAlert(alert *entities.Alert) {
+	// the patient is looked up at most once, by the first writer whose
+	// subscription selects by ward or care team
+	patient := sync.OnceValue(func() PatientInfo { return w.patients.get(alert.PatientID) })
+	f := frame{
+		msg:     ServerMessage{Type: TypeAlert, Alert: alert},
+		selects: func(c *client) bool { return c.wants(alert, patient, w.cfg.SendQueue) },
+	}
+
+	for _, c := range w.snapshot() {
+		if c.mayWant(func(s Subscription) bool { return s.mayMatch(alert) }) {
+			w.deliver(c, f)
+		}
+	}
+}
+
+// BroadcastVital records v as the latest sample of its patient and code
+// and sends it to clients whose subscriptions select it, subject to each
+// subscription's MaxRate. Samples older than the latest known one, or
+// stale, are not sent.
+func (w *WSHandler) BroadcastVital(v Vital) {
+	if !w.latest.update(v) || time.Since(v.Time) > staleVital {
+		return
+	}
+	patient := sync.OnceValue(func() PatientInfo { return w.patients.get(v.PatientID) })
+	now := time.Now()
+	f := frame{
+		msg:     ServerMessage{Type: TypeVital, Vital: &v},
+		selects: func(c *client) bool { return c.wantsVital(v, patient, now) },
+	}
+
+	for _, c := range w.snapshot() {
+		if c.mayWant(func(s Subscription) bool { return s.mayMatchVital(v) }) {
+			w.deliver(c, f)
+		}
+	}
+}
+
+// deliver queues f for c. When the queue is full the frame is dropped,
+// and a client missing an alert is disconnected unless the policy is
+// SlowClientDrop, so that it reconnects and replays what it missed.
+func (w *WSHandler) deliver(c *client, f frame) {
+	if c.offer(f) {
+		return
+	}
+	droppedMessages.WithLabelValues(f.msg.Type).Inc()
+	if f.msg.Type == TypeAlert && w.cfg.SlowClient == SlowClientDisconnect {
+		log.Printf("[WS] disconnecting slow %s client %s: send queue full", c.t.name(), c.t.remoteAddr())
+		c.close(reasonSlow, websocket.CloseTryAgainLater, "send queue full")
+	}
+}
+
+func (w *WSHandler) snapshot() []*client {
 	w.clientsMu.Lock()
 	defer w.clientsMu.Unlock()
-	for conn := range w.clients {
-		if err := conn.WriteJSON(alert); err != nil {
-			log.Println("Error al enviar alerta por WebSocket:", err)
-			conn.Close()
-			delete(w.clients, conn)
-		}
+	out := make([]*client, 0, len(w.clients))
+	for c := range w.clients {
+		out = append(out, c)
 	}
+	return out
+}
+
+func (w *WSHandler) add(c *client) {
+	w.clientsMu.Lock()
+	w.clients[c] = struct{}{}
+	w.clientsMu.Unlock()
+	connectedClients.WithLabelValues(c.t.name()).Inc()
+}
+
+func (w *WSHandler) remove(c *client) {
+	w.clientsMu.Lock()
+	delete(w.clients, c)
+	w.clientsMu.Unlock()
+	connectedClients.WithLabelValues(c.t.name()).Dec()
 }
 
 func (w *WSHandler) Handler() http.HandlerFunc {
 	return func(wr http.ResponseWriter, r *http.Request) {
+		var filter AccessFilter
+		if w.authorize != nil {
+			f, status, err := w.authorize(r)
+			if err != nil {
+				http.Error(wr, err.Error(), status)
+				return
+			}
+			filter = f
+		}
+
 		wsConn, err := w.upgrader.Upgrade(wr, r, nil)
 		if err != nil {
 			log.Println("Error al actualizar conexión WebSocket:", err)
 			return
 		}
 
-		w.clientsMu.Lock()
-		w.clients[wsConn] = true
-		w.clientsMu.Unlock()
-
-		defer func() {
-			w.clientsMu.Lock()
-			delete(w.clients, wsConn)
-			w.clientsMu.Unlock()
-			wsConn.Close()
-		}()
+		c := newClient(wsTransport{conn: wsConn}, filter, w.cfg.SendQueue)
+		w.add(c)
+		defer w.remove(c)
+		go c.writePump(w.cfg.PingInterval)
 
-		for {
-			if _, _, err := wsConn.NextReader(); err != nil {
-				break
+		c.readPump(wsConn, w.cfg.PongWait, func(raw []byte) bool {
+			reply := c.handle(raw, w.history != nil)
+			if !c.reply(reply) {
+				return false
+			}
+			if reply.Type != TypeSubscribed {
+				return true
 			}
+			if snapshot, ok := w.vitalSnapshot(c, reply.ID); ok && !c.reply(snapshot) {
+				return false
+			}
+			return w.replay(c, reply.ID)
+		})
+	}
+}
+
+// vitalSnapshot returns the latest vitals selected by subscription id, if
+// it is a vitals subscription
+func (w *WSHandler) vitalSnapshot(c *client, id string) (ServerMessage, bool) {
+	c.subsMu.Lock()
+	sub, ok := c.subs[id]
+	c.subsMu.Unlock()
+	if !ok || !sub.wantsVitals() {
+		return ServerMessage{}, false
+	}
+	vitals := w.latest.matching(func(v Vital) bool {
+		patient := func() PatientInfo { return w.patients.get(v.PatientID) }
+		return sub.matchesVital(v, patient) && (c.filter == nil || c.filter(v.PatientID))
+	})
+	return ServerMessage{Type: TypeSnapshot, ID: id, Vitals: vitals}, true
+}
+
+// handle applies one client message and returns the reply. A subscribe
+// with since is left replaying for WSHandler.replay.
+func (c *client) handle(raw []byte, canReplay bool) ServerMessage {
+	msg, err := decodeClientMessage(raw)
+	if err != nil {
+		return ServerMessage{Type: TypeError, Error: err.Error()}
+	}
+
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	switch msg.Type {
+	case TypeSubscribe:
+		if err := msg.Subscription.validate(); err != nil {
+			return ServerMessage{Type: TypeError, ID: msg.ID, Error: err.Error()}
+		}
+		if msg.Since < 0 {
+			return ServerMessage{Type: TypeError, ID: msg.ID, Error: "since must not be negative"}
+		}
+		if msg.Since > 0 && !canReplay {
+			return ServerMessage{Type: TypeError, ID: msg.ID, Error: "alert replay is not available"}
+		}
+		if _, exists := c.subs[msg.ID]; !exists && len(c.subs) >= maxSubscriptions {
+			return ServerMessage{Type: TypeError, ID: msg.ID, Error: "too many subscriptions"}
+		}
+		c.subs[msg.ID] = msg.Subscription
+		delete(c.sent, msg.ID)
+		delete(c.replaying, msg.ID)
+		if msg.Since > 0 {
+			c.replaying[msg.ID] = &replayState{since: msg.Since}
+		}
+		return ServerMessage{Type: TypeSubscribed, ID: msg.ID}
+	case TypeUnsubscribe:
+		delete(c.subs, msg.ID)
+		delete(c.sent, msg.ID)
+		delete(c.replaying, msg.ID)
+		return ServerMessage{Type: TypeUnsubscribed, ID: msg.ID}
+	}
+	return ServerMessage{Type: TypeError, ID: msg.ID, Error: "type must be subscribe or unsubscribe"}
+}
+
+// mayWant reports whether one of the client's subscriptions may select a
+// message, judged without lookups
+func (c *client) mayWant(match func(Subscription) bool) bool {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	for _, s := range c.subs {
+		if match(s) {
+			return true
 		}
 	}
+	return false
+}
+
+// wants applies the client's subscriptions, then its access filter. It
+// runs on the client's writer. An alert selected by a replaying
+// subscription is buffered for it, holding at most limit; wants reports
+// whether the alert should be sent now.
+func (c *client) wants(alert *entities.Alert, patient func() PatientInfo, limit int) bool {
+	c.subsMu.Lock()
+	matched := false
+	for _, s := range c.subs {
+		if s.matches(alert, patient) {
+			matched = true
+			break
+		}
+	}
+	c.subsMu.Unlock()
+	if !matched || (c.filter != nil && !c.filter(alert.PatientID)) {
+		return false
+	}
+
+	// subscriptions may have changed while the filter ran
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	live := false
+	for id, s := range c.subs {
+		if !s.matches(alert, patient) {
+			continue
+		}
+		if _, replaying := c.replaying[id]; replaying {
+			c.buffer(id, alert, limit)
+		} else {
+			live = true
+		}
+	}
+	return live && c.markSentLocked(alert.ID)
+}
+
+// wantsVital is wants for vitals, run on the client's writer with the time
+// the sample was broadcast. A sample is sent when a subscription
+// selecting it has no MaxRate or is due, and every due subscription
+// restarts its interval.
+func (c *client) wantsVital(v Vital, patient func() PatientInfo, now time.Time) bool {
+	key := v.PatientID + "\x00" + v.Code
+	c.subsMu.Lock()
+	matched := false
+	for id, s := range c.subs {
+		if !s.matchesVital(v, patient) {
+			continue
+		}
+		interval := s.interval()
+		if interval == 0 {
+			matched = true
+			continue
+		}
+		sent := c.sent[id]
+		if sent == nil {
+			sent = make(map[string]time.Time)
+			c.sent[id] = sent
+		}
+		if last, ok := sent[key]; ok && now.Sub(last) < interval {
+			continue
+		}
+		sent[key] = now
+		matched = true
+	}
+	c.subsMu.Unlock()
+	return matched && (c.filter == nil || c.filter(v.PatientID))
+}
+
+// Close sends a close frame to every connected client and drops them.
+// Hijacked WebSocket connections are not tracked by http.Server.Shutdown,
+// and SSE streams would hold it until its deadline, so this must be called
+// explicitly during shutdown.
+func (w *WSHandler) Close() error {
+	for _, c := range w.snapshot() {
+		c.close(reasonShutdown, websocket.CloseGoingAway, "server shutting down")
+	}
+	return nil
 }
@@ -0,0 +1,13 @@
+// Package testing provides in-memory implementations of the repository
+// interfaces and a message bus so services can be exercised without Kafka,
+// InfluxDB or PostgreSQL.
+package testing
+
+import "github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/bus"
+
+// Bus is the in-process event bus used in place of Kafka
+type Bus = bus.Bus
+
+func NewBus() *Bus {
+	return bus.New()
+}
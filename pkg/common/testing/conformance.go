@@ -0,0 +1,184 @@
+package testing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+)
+
+// CheckObservationRepository is the conformance suite every
+// repository.ObservationRepository must pass. It writes a handful of points
+// for a fresh patient ID, reads them back raw, filtered and aggregated, and
+// returns the first mismatch. Repositories that buffer writes should
+// implement Flush() error so the suite can make its writes visible.
+func CheckObservationRepository(ctx context.Context, repo repository.ObservationRepository) error {
+	patientID := fmt.Sprintf("conformance-%d", time.Now().UnixNano())
+	// a whole hour a few hours back keeps buckets aligned and inside any
+	// raw retention window
+	base := time.Now().UTC().Truncate(time.Hour).Add(-3 * time.Hour)
+
+	records := []entities.ObservationRecord{
+		{ID: patientID + "-1", CodeText: "heart-rate", Unit: "bpm", Value: 60, EffectiveDateTime: base.Add(5 * time.Minute), DeviceID: "device-a"},
+		{ID: patientID + "-2", CodeText: "heart-rate", Unit: "bpm", Value: 80, EffectiveDateTime: base.Add(20 * time.Minute)},
+		{ID: patientID + "-3", CodeText: "heart-rate", Unit: "bpm", Value: 100, EffectiveDateTime: base.Add(70 * time.Minute)},
+		{ID: patientID + "-4", CodeText: "spo2", Unit: "%", Value: 97, EffectiveDateTime: base.Add(10 * time.Minute)},
+	}
+	// the first point is saved alone and the rest as one batch
+	batch := make([]*entities.ObservationRecord, 0, len(records)-1)
+	for i := range records {
+		records[i].ResourceType = "Observation"
+		records[i].Status = "Final"
+		records[i].PatientID = patientID
+		records[i].Subject = patientID
+		if i > 0 {
+			batch = append(batch, &records[i])
+		}
+	}
+	if err := repo.Save(ctx, &records[0]); err != nil {
+		return fmt.Errorf("save %s: %w", records[0].ID, err)
+	}
+	if err := repo.SaveBatch(ctx, batch); err != nil {
+		return fmt.Errorf("save batch: %w", err)
+	}
+	if f, ok := repo.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return fmt.Errorf("flush: %w", err)
+		}
+	}
+
+	window := repository.ObservationQuery{PatientID: patientID, From: base, To: base.Add(2 * time.Hour)}
+	fetch := func(name string, q repository.ObservationQuery, want int) ([]entities.Observation, error) {
+		// allow asynchronous backends a moment to make writes visible
+		var got []entities.Observation
+		var err error
+		for attempt := 0; attempt < 20; attempt++ {
+			got, err = repo.FetchObservations(ctx, q)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if len(got) == want {
+				return got, nil
+			}
+			time.Sleep(250 * time.Millisecond)
+		}
+		return nil, fmt.Errorf("%s: got %d observations, want %d", name, len(got), want)
+	}
+
+	// raw round trip preserves every FHIR field
+	raw, err := fetch("raw", window, len(records))
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]entities.Observation, len(raw))
+	for _, obs := range raw {
+		byID[obs.ID] = obs
+	}
+	for i := range records {
+		want := entities.ToObservation(&records[i])
+		got, ok := byID[want.ID]
+		if !ok {
+			return fmt.Errorf("raw: observation %s missing", want.ID)
+		}
+		if err := sameObservation(got, want); err != nil {
+			return fmt.Errorf("raw: observation %s: %w", want.ID, err)
+		}
+	}
+
+	// code filter and ordering
+	q := window
+	q.Code = "heart-rate"
+	hr, err := fetch("code filter", q, 3)
+	if err != nil {
+		return err
+	}
+	for i := 1; i < len(hr); i++ {
+		if hr[i].EffectiveDateTime < hr[i-1].EffectiveDateTime {
+			return fmt.Errorf("code filter: observations not in time order")
+		}
+	}
+
+	// limit applies per code, with and without a code filter
+	q.Limit = 2
+	if _, err := fetch("limit", q, 2); err != nil {
+		return err
+	}
+	q = window
+	q.Limit = 2
+	limited, err := fetch("limit without code", q, 3)
+	if err != nil {
+		return err
+	}
+	perCode := make(map[string]int)
+	for _, obs := range limited {
+		perCode[obs.Code.Text]++
+	}
+	if perCode["heart-rate"] != 2 || perCode["spo2"] != 1 {
+		return fmt.Errorf("limit without code: got %v per code, want 2 heart-rate and 1 spo2", perCode)
+	}
+
+	// hourly aggregates
+	for _, tc := range []struct {
+		agg  repository.Aggregate
+		want [2]float64
+	}{
+		{repository.AggregateMean, [2]float64{70, 100}},
+		{repository.AggregateMax, [2]float64{80, 100}},
+		{repository.AggregateMin, [2]float64{60, 100}},
+		{repository.AggregateLast, [2]float64{80, 100}},
+	} {
+		q := window
+		q.Code = "heart-rate"
+		q.Interval = time.Hour
+		q.Aggregate = tc.agg
+		got, err := fetch(string(tc.agg), q, 2)
+		if err != nil {
+			return err
+		}
+		for i, obs := range got {
+			wantStart := base.Add(time.Duration(i) * time.Hour).Format(time.RFC3339)
+			if obs.EffectiveDateTime != wantStart || obs.ValueQuantity.Value != tc.want[i] || obs.Code.Text != "heart-rate" || obs.ValueQuantity.Unit != "bpm" {
+				return fmt.Errorf("%s: bucket %d = %s %s %v %s, want %s heart-rate %v bpm",
+					tc.agg, i, obs.EffectiveDateTime, obs.Code.Text, obs.ValueQuantity.Value, obs.ValueQuantity.Unit, wantStart, tc.want[i])
+			}
+		}
+	}
+
+	// invalid queries are rejected as caller errors
+	bad := window
+	bad.From, bad.To = bad.To, bad.From
+	if _, err := repo.FetchObservations(ctx, bad); !errors.Is(err, repository.ErrInvalidQuery) {
+		return fmt.Errorf("inverted range: got %v, want ErrInvalidQuery", err)
+	}
+	bad = window
+	bad.Interval = time.Minute
+	bad.Aggregate = "median"
+	if _, err := repo.FetchObservations(ctx, bad); !errors.Is(err, repository.ErrInvalidQuery) {
+		return fmt.Errorf("unknown aggregate: got %v, want ErrInvalidQuery", err)
+	}
+
+	return nil
+}
+
+func sameObservation(got, want entities.Observation) error {
+	switch {
+	case got.ResourceType != want.ResourceType:
+		return fmt.Errorf("resourceType %q, want %q", got.ResourceType, want.ResourceType)
+	case got.Status != want.Status:
+		return fmt.Errorf("status %q, want %q", got.Status, want.Status)
+	case got.Code != want.Code:
+		return fmt.Errorf("code %q, want %q", got.Code.Text, want.Code.Text)
+	case got.Subject != want.Subject:
+		return fmt.Errorf("subject %q, want %q", got.Subject.Reference, want.Subject.Reference)
+	case got.EffectiveDateTime != want.EffectiveDateTime:
+		return fmt.Errorf("effectiveDateTime %s, want %s", got.EffectiveDateTime, want.EffectiveDateTime)
+	case got.ValueQuantity != want.ValueQuantity:
+		return fmt.Errorf("valueQuantity %+v, want %+v", got.ValueQuantity, want.ValueQuantity)
+	case (got.Device == nil) != (want.Device == nil) || (got.Device != nil && *got.Device != *want.Device):
+		return fmt.Errorf("device %+v, want %+v", got.Device, want.Device)
+	}
+	return nil
+}
@@ -0,0 +1,639 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+)
+
+// ObservationRepo is an in-memory repository.ObservationRepository
+type ObservationRepo struct {
+	mu      sync.Mutex
+	records []entities.ObservationRecord
+}
+
+func NewObservationRepo() *ObservationRepo {
+	return &ObservationRepo{}
+}
+
+func (r *ObservationRepo) Save(ctx context.Context, record *entities.ObservationRecord) error {
+	if record == nil {
+		return fmt.Errorf("memory: nil observation record")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, *record)
+	return nil
+}
+
+func (r *ObservationRepo) SaveBatch(ctx context.Context, records []*entities.ObservationRecord) error {
+	for _, record := range records {
+		if err := r.Save(ctx, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ObservationRepo) FetchObservations(ctx context.Context, q repository.ObservationQuery) ([]entities.Observation, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var matched []entities.ObservationRecord
+	for _, rec := range r.records {
+		if rec.PatientID != q.PatientID {
+			continue
+		}
+		if q.Code != "" && rec.CodeText != q.Code {
+			continue
+		}
+		if rec.EffectiveDateTime.Before(q.From) || rec.EffectiveDateTime.After(q.To) {
+			continue
+		}
+		matched = append(matched, rec)
+	}
+	return repository.Downsample(matched, q), nil
+}
+
+// Records returns a copy of everything saved so far
+func (r *ObservationRepo) Records() []entities.ObservationRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]entities.ObservationRecord(nil), r.records...)
+}
+
+func (r *ObservationRepo) Close() error { return nil }
+
+// AlertRepo is an in-memory repository.AlertRepository
+type AlertRepo struct {
+	mu        sync.Mutex
+	alerts    []entities.Alert
+	patients  map[string]entities.Patient
+	careTeams map[string][]string
+	// stall, while open, makes CareTeams wait for its context
+	stall chan struct{}
+}
+
+func NewAlertRepo() *AlertRepo {
+	return &AlertRepo{patients: make(map[string]entities.Patient), careTeams: make(map[string][]string)}
+}
+
+// SavePatient records the ward and unit used by Query filters
+func (r *AlertRepo) SavePatient(patient entities.Patient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patients[patient.ID] = patient
+}
+
+func (r *AlertRepo) Save(ctx context.Context, alert *entities.Alert) error {
+	if alert == nil {
+		return fmt.Errorf("memory: nil alert")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, a := range r.alerts {
+		if a.ID == alert.ID {
+			return fmt.Errorf("memory: duplicate alert id %s", alert.ID)
+		}
+	}
+	alert.Seq = int64(len(r.alerts)) + 1
+	r.alerts = append(r.alerts, *alert)
+	return nil
+}
+
+func (r *AlertRepo) FetchSince(ctx context.Context, seq int64, limit int) ([]entities.Alert, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// alerts are appended in Seq order
+	var out []entities.Alert
+	for _, a := range r.alerts {
+		if a.Seq > seq && len(out) < limit {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func (r *AlertRepo) FetchByPatient(ctx context.Context, patientID string) ([]entities.Alert, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []entities.Alert
+	for _, a := range r.alerts {
+		if a.PatientID == patientID {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func (r *AlertRepo) FetchByID(ctx context.Context, id string) (*entities.Alert, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, a := range r.alerts {
+		if a.ID == id {
+			return &a, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *AlertRepo) Acknowledge(ctx context.Context, id, by string, at time.Time) (*entities.Alert, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.alerts {
+		a := &r.alerts[i]
+		if a.ID != id {
+			continue
+		}
+		if !a.Acknowledged {
+			a.Acknowledged, a.AcknowledgedBy, a.AcknowledgedAt = true, by, &at
+		}
+		alert := *a
+		return &alert, nil
+	}
+	return nil, nil
+}
+
+func (r *AlertRepo) Resolve(ctx context.Context, id, by string, at time.Time) (*entities.Alert, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.alerts {
+		a := &r.alerts[i]
+		if a.ID != id {
+			continue
+		}
+		if !a.Resolved {
+			a.Resolved, a.ResolvedBy, a.ResolvedAt = true, by, &at
+		}
+		alert := *a
+		return &alert, nil
+	}
+	return nil, nil
+}
+
+// AssignCareTeam adds the patient to a care team
+func (r *AlertRepo) AssignCareTeam(patientID, careTeam string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.careTeams[patientID] = append(r.careTeams[patientID], careTeam)
+}
+
+// StallCareTeams makes CareTeams block until its context ends, as an
+// unreachable database would. Calling it with false answers the calls
+// still waiting.
+func (r *AlertRepo) StallCareTeams(stalled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case stalled && r.stall == nil:
+		r.stall = make(chan struct{})
+	case !stalled && r.stall != nil:
+		close(r.stall)
+		r.stall = nil
+	}
+}
+
+func (r *AlertRepo) CareTeams(ctx context.Context, patientID string) ([]string, error) {
+	r.mu.Lock()
+	stall := r.stall
+	r.mu.Unlock()
+	if stall != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-stall:
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.careTeams[patientID]...), nil
+}
+
+func (r *AlertRepo) Query(ctx context.Context, q repository.AlertQuery) (repository.AlertPage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return repository.PageAlerts(r.alerts, r.patients, r.careTeams, q)
+}
+
+// Patients exposes the patients recorded by SavePatient as a
+// repository.PatientRepository
+func (r *AlertRepo) Patients() repository.PatientRepository {
+	return patientView{r}
+}
+
+type patientView struct{ r *AlertRepo }
+
+func (v patientView) Save(ctx context.Context, patient *entities.Patient) error {
+	v.r.SavePatient(*patient)
+	return nil
+}
+
+func (v patientView) FetchByID(ctx context.Context, id string) (*entities.Patient, error) {
+	v.r.mu.Lock()
+	defer v.r.mu.Unlock()
+	p, ok := v.r.patients[id]
+	if !ok {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+// Alerts returns a copy of every stored alert
+func (r *AlertRepo) Alerts() []entities.Alert {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]entities.Alert(nil), r.alerts...)
+}
+
+func (r *AlertRepo) Close() error { return nil }
+
+// AuditLog is an in-memory repository.AuditRepository
+type AuditLog struct {
+	mu     sync.Mutex
+	events []entities.AuditEvent
+}
+
+func NewAuditLog() *AuditLog {
+	return &AuditLog{}
+}
+
+func (l *AuditLog) Append(ctx context.Context, e *entities.AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	head := ""
+	if n := len(l.events); n > 0 {
+		head = l.events[n-1].Hash
+	}
+	e.Seq = int64(len(l.events) + 1)
+	e.Seal(head)
+	l.events = append(l.events, *e)
+	return nil
+}
+
+func (l *AuditLog) Query(ctx context.Context, q repository.AuditQuery) (repository.AuditPage, error) {
+	if err := q.Validate(); err != nil {
+		return repository.AuditPage{}, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	page := repository.AuditPage{Events: []entities.AuditEvent{}}
+	for i := len(l.events) - 1; i >= 0; i-- {
+		if !q.Matches(l.events[i]) {
+			continue
+		}
+		if len(page.Events) == q.Limit {
+			page.NextCursor = strconv.FormatInt(page.Events[q.Limit-1].Seq, 10)
+			break
+		}
+		page.Events = append(page.Events, l.events[i])
+	}
+	return page, nil
+}
+
+func (l *AuditLog) Verify(ctx context.Context) (repository.AuditVerification, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	v := repository.NewAuditVerification()
+	for _, e := range l.events {
+		if !v.Add(e) {
+			break
+		}
+	}
+	return v, nil
+}
+
+// Events returns a copy of every recorded event, oldest first
+func (l *AuditLog) Events() []entities.AuditEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]entities.AuditEvent(nil), l.events...)
+}
+
+var _ repository.NonceRepository = (*NonceRepo)(nil)
+
+// NonceRepo is an in-memory repository.NonceRepository
+type NonceRepo struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+func NewNonceRepo() *NonceRepo {
+	return &NonceRepo{nonces: make(map[string]time.Time)}
+}
+
+func (r *NonceRepo) Claim(ctx context.Context, nonce string, now, expires time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if exp, ok := r.nonces[nonce]; ok && now.Before(exp) {
+		return false, nil
+	}
+	r.nonces[nonce] = expires
+	return true, nil
+}
+
+var _ repository.NotificationRepository = (*NotificationRepo)(nil)
+
+// NotificationRepo is an in-memory repository.NotificationRepository
+type NotificationRepo struct {
+	mu         sync.Mutex
+	deliveries []entities.NotificationDelivery
+	failures   []error
+}
+
+func NewNotificationRepo() *NotificationRepo {
+	return &NotificationRepo{}
+}
+
+// FailEnqueue makes the next calls to Enqueue return errs, one each, in
+// order, without storing anything
+func (n *NotificationRepo) FailEnqueue(errs ...error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failures = append(n.failures, errs...)
+}
+
+func (n *NotificationRepo) Enqueue(ctx context.Context, ds []entities.NotificationDelivery) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.failures) > 0 {
+		err := n.failures[0]
+		n.failures = n.failures[1:]
+		return err
+	}
+next:
+	for _, d := range ds {
+		for _, stored := range n.deliveries {
+			if stored.ID == d.ID {
+				continue next
+			}
+		}
+		n.deliveries = append(n.deliveries, d)
+	}
+	return nil
+}
+
+func (n *NotificationRepo) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.NotificationDelivery, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var due []*entities.NotificationDelivery
+	for i := range n.deliveries {
+		d := &n.deliveries[i]
+		if d.Status == entities.DeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	claimed := make([]entities.NotificationDelivery, 0, len(due))
+	for _, d := range due {
+		d.NextAttemptAt = now.Add(lease)
+		claimed = append(claimed, *d)
+	}
+	return claimed, nil
+}
+
+func (n *NotificationRepo) Update(ctx context.Context, d *entities.NotificationDelivery) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i := range n.deliveries {
+		if n.deliveries[i].ID == d.ID {
+			n.deliveries[i] = *d
+			return nil
+		}
+	}
+	return fmt.Errorf("notification delivery %s not found", d.ID)
+}
+
+func (n *NotificationRepo) FetchByAlert(ctx context.Context, alertID string) ([]entities.NotificationDelivery, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var out []entities.NotificationDelivery
+	for _, d := range n.deliveries {
+		if d.AlertID == alertID {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+// Deliveries returns a copy of every stored delivery, oldest first
+func (n *NotificationRepo) Deliveries() []entities.NotificationDelivery {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]entities.NotificationDelivery(nil), n.deliveries...)
+}
+
+var _ repository.EscalationRepository = (*EscalationRepo)(nil)
+
+// EscalationRepo is an in-memory repository.EscalationRepository
+type EscalationRepo struct {
+	mu          sync.Mutex
+	escalations []entities.Escalation
+}
+
+func NewEscalationRepo() *EscalationRepo {
+	return &EscalationRepo{}
+}
+
+func (r *EscalationRepo) Start(ctx context.Context, e *entities.Escalation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stored := range r.escalations {
+		if stored.ID == e.ID {
+			return nil
+		}
+	}
+	r.escalations = append(r.escalations, *e)
+	return nil
+}
+
+func (r *EscalationRepo) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.Escalation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var due []*entities.Escalation
+	for i := range r.escalations {
+		e := &r.escalations[i]
+		if e.Status == entities.EscalationActive && !e.DueAt.After(now) {
+			due = append(due, e)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].DueAt.Before(due[j].DueAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	claimed := make([]entities.Escalation, 0, len(due))
+	for _, e := range due {
+		e.DueAt = now.Add(lease)
+		claimed = append(claimed, *e)
+	}
+	return claimed, nil
+}
+
+func (r *EscalationRepo) Update(ctx context.Context, e *entities.Escalation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.escalations {
+		if r.escalations[i].ID == e.ID {
+			r.escalations[i] = *e
+			return nil
+		}
+	}
+	return fmt.Errorf("escalation %s not found", e.ID)
+}
+
+func (r *EscalationRepo) FetchByAlert(ctx context.Context, alertID string) (*entities.Escalation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.escalations {
+		if e.AlertID == alertID {
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+var _ repository.WebhookRepository = (*WebhookRepo)(nil)
+
+// WebhookRepo is an in-memory repository.WebhookRepository
+type WebhookRepo struct {
+	mu            sync.Mutex
+	subscriptions []entities.WebhookSubscription
+	deliveries    []entities.WebhookDelivery
+	failures      []error
+}
+
+func NewWebhookRepo() *WebhookRepo {
+	return &WebhookRepo{}
+}
+
+func (r *WebhookRepo) CreateSubscription(ctx context.Context, s *entities.WebhookSubscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stored := range r.subscriptions {
+		if stored.ID == s.ID {
+			return fmt.Errorf("webhook subscription %s already exists", s.ID)
+		}
+	}
+	r.subscriptions = append(r.subscriptions, *s)
+	return nil
+}
+
+func (r *WebhookRepo) Subscriptions(ctx context.Context) ([]entities.WebhookSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]entities.WebhookSubscription(nil), r.subscriptions...), nil
+}
+
+func (r *WebhookRepo) FetchSubscription(ctx context.Context, id string) (*entities.WebhookSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.subscriptions {
+		if s.ID == id {
+			return &s, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *WebhookRepo) DeleteSubscription(ctx context.Context, id string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, s := range r.subscriptions {
+		if s.ID == id {
+			r.subscriptions = append(r.subscriptions[:i], r.subscriptions[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FailEnqueue makes the next calls to EnqueueDeliveries return errs, one
+// each, in order, without storing anything
+func (r *WebhookRepo) FailEnqueue(errs ...error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, errs...)
+}
+
+func (r *WebhookRepo) EnqueueDeliveries(ctx context.Context, ds []entities.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.failures) > 0 {
+		err := r.failures[0]
+		r.failures = r.failures[1:]
+		return err
+	}
+next:
+	for _, d := range ds {
+		for _, stored := range r.deliveries {
+			if stored.ID == d.ID {
+				continue next
+			}
+		}
+		r.deliveries = append(r.deliveries, d)
+	}
+	return nil
+}
+
+func (r *WebhookRepo) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var due []*entities.WebhookDelivery
+	for i := range r.deliveries {
+		d := &r.deliveries[i]
+		if d.Status == entities.WebhookPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	claimed := make([]entities.WebhookDelivery, 0, len(due))
+	for _, d := range due {
+		d.NextAttemptAt = now.Add(lease)
+		claimed = append(claimed, *d)
+	}
+	return claimed, nil
+}
+
+func (r *WebhookRepo) UpdateDelivery(ctx context.Context, d *entities.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.deliveries {
+		if r.deliveries[i].ID == d.ID {
+			r.deliveries[i] = *d
+			return nil
+		}
+	}
+	return fmt.Errorf("webhook delivery %s not found", d.ID)
+}
+
+func (r *WebhookRepo) FetchDelivery(ctx context.Context, id string) (*entities.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.deliveries {
+		if d.ID == id {
+			return &d, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *WebhookRepo) Deliveries(ctx context.Context, q repository.WebhookDeliveryQuery) (repository.WebhookDeliveryPage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return repository.PageWebhookDeliveries(r.deliveries, q)
+}
@@ -0,0 +1,17 @@
+package testing_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rpmtesting "github.com/lioarce01/remote-patient-monitoring-system/pkg/common/testing"
+)
+
+func TestObservationRepoConformance(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := rpmtesting.CheckObservationRepository(ctx, rpmtesting.NewObservationRepo()); err != nil {
+		t.Fatal(err)
+	}
+}
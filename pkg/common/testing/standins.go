@@ -0,0 +1,193 @@
+package testing
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// Mail is a message accepted by SMTPServer
+type Mail struct {
+	From string
+	To   []string
+	Data string
+}
+
+// SMTPServer is a local SMTP relay standing in for a mail server. It
+// accepts every message except those to rejected recipients; it offers
+// neither TLS nor authentication.
+type SMTPServer struct {
+	Host string
+	Port string
+
+	ln       net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	messages []Mail
+	rejected map[string]bool
+}
+
+// NewSMTPServer listens on a free local port
+func NewSMTPServer() (*SMTPServer, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	s := &SMTPServer{Host: host, Port: port, ln: ln, rejected: make(map[string]bool)}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Reject answers 550 to RCPT TO for addr
+func (s *SMTPServer) Reject(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejected[strings.ToLower(addr)] = true
+}
+
+// Messages returns a copy of every accepted message, oldest first
+func (s *SMTPServer) Messages() []Mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Mail(nil), s.messages...)
+}
+
+func (s *SMTPServer) Close() error {
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *SMTPServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.session(textproto.NewConn(conn))
+		}()
+	}
+}
+
+// session speaks just enough SMTP for net/smtp.SendMail
+func (s *SMTPServer) session(c *textproto.Conn) {
+	var mail Mail
+	c.PrintfLine("220 localhost ESMTP stand-in")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			c.PrintfLine("250-localhost")
+			c.PrintfLine("250 8BITMIME")
+		case "HELO", "NOOP":
+			c.PrintfLine("250 OK")
+		case "RSET":
+			mail = Mail{}
+			c.PrintfLine("250 OK")
+		case "MAIL":
+			mail = Mail{From: smtpAddress(arg)}
+			c.PrintfLine("250 OK")
+		case "RCPT":
+			to := smtpAddress(arg)
+			s.mu.Lock()
+			rejected := s.rejected[strings.ToLower(to)]
+			s.mu.Unlock()
+			if rejected {
+				c.PrintfLine("550 mailbox unavailable")
+				continue
+			}
+			mail.To = append(mail.To, to)
+			c.PrintfLine("250 OK")
+		case "DATA":
+			c.PrintfLine("354 end with <CRLF>.<CRLF>")
+			data, err := io.ReadAll(c.DotReader())
+			if err != nil {
+				return
+			}
+			mail.Data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, mail)
+			s.mu.Unlock()
+			mail = Mail{}
+			c.PrintfLine("250 OK")
+		case "QUIT":
+			c.PrintfLine("221 bye")
+			return
+		default:
+			c.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+// smtpAddress extracts the address from "FROM:<a@b>" or "TO:<a@b>"
+func smtpAddress(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr, _, _ = strings.Cut(strings.TrimSpace(addr), " ")
+	return strings.Trim(addr, "<>")
+}
+
+// Request is a request received by HTTPSink
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// HTTPSink is a local HTTP endpoint standing in for webhook receivers and
+// SMS and pager providers. It records every request and answers 200 unless
+// told to fail.
+type HTTPSink struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []Request
+	failures []int
+}
+
+func NewHTTPSink() *HTTPSink {
+	s := &HTTPSink{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// FailNext answers the next requests with statuses, one each, in order
+func (s *HTTPSink) FailNext(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, statuses...)
+}
+
+// Requests returns a copy of every request received, oldest first
+func (s *HTTPSink) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *HTTPSink) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+	status := http.StatusOK
+	if len(s.failures) > 0 {
+		status, s.failures = s.failures[0], s.failures[1:]
+	}
+	s.mu.Unlock()
+	w.WriteHeader(status)
+}
@@ -0,0 +1,53 @@
+// Package app wires the processing service from its repository dependencies
+// so it can be run by cmd or embedded in another process.
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/repository"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/mlclient"
+	"github.com/lioarce01/remote-patient-monitoring-system/processing-service/internal/application"
+)
+
+type Processor struct {
+	service *application.ProcessService
+}
+
+// NewProcessor builds the observation pipeline. mlClient may be nil to
+// disable ML predictions.
+func NewProcessor(publisher repository.Publisher, alertRepo repository.AlertRepository, obsRepo repository.ObservationRepository, mlClient *mlclient.Client) *Processor {
+	return &Processor{
+		service: application.NewProcessService(publisher, alertRepo, obsRepo, mlClient),
+	}
+}
+
+// Run consumes observations until ctx is cancelled. The observation being
+// handled when ctx is cancelled is allowed to finish.
+func (p *Processor) Run(ctx context.Context, consumer repository.Subscriber) error {
+	// in-flight observations keep running after the signal so they can finish
+	// writing metrics and alerts; the caller's shutdown deadline bounds the wait
+	workCtx := context.WithoutCancel(ctx)
+
+	return consumer.Consume(ctx, func(key, msg []byte) error {
+		var obs entities.Observation
+		if err := json.Unmarshal(msg, &obs); err != nil {
+			log.Printf("invalid observation message: %v", err)
+			return nil
+		}
+
+		record, err := entities.ToObservationRecord(&obs)
+		if err != nil {
+			log.Printf("error converting to ObservationRecord: %v", err)
+			return nil
+		}
+
+		if err := p.service.HandleObservation(workCtx, record); err != nil {
+			log.Printf("error processing observation %s: %v", obs.ID, err)
+		}
+		return nil
+	})
+}
@@ -2,41 +2,51 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/broker"
 	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db"
-	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/kafka"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/lifecycle"
 	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/mlclient"
-	"github.com/lioarce01/remote-patient-monitoring-system/processing-service/internal/application"
+	"github.com/lioarce01/remote-patient-monitoring-system/processing-service/app"
 )
 
 func main() {
-	brokers := strings.Split(os.Getenv("KAFKA_BROKERS"), ",")
+	// "migrate ..." manages the Postgres schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := db.Migrate(context.Background(), os.Getenv("POSTGRES_CONN"), os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	brokerCfg := broker.ConfigFromEnv()
 	obsTopic := os.Getenv("OBS_TOPIC")
 	alertTopic := os.Getenv("ALERT_TOPIC")
 	conn := os.Getenv("POSTGRES_CONN")
-	influxAddr := os.Getenv("INFLUX_ADDR")
-	influxDB := os.Getenv("INFLUX_DB")
-	influxUser := os.Getenv("INFLUX_USER")
-	influxPass := os.Getenv("INFLUX_PASS")
+	obsCfg := db.ObservationConfigFromEnv()
 	groupID := os.Getenv("GROUP_ID")
+	shutdown := lifecycle.NewDeadline(lifecycle.ShutdownTimeout())
 	mlClient := mlclient.NewClient("http://ml-service:8000")
 
-	// initialize kafka consumer
-	consumer := kafka.NewKafkaConsumer(brokers, obsTopic, groupID)
+	// context configuration to handler signals
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
 
-	obsRepo, err := db.NewInfluxRepo(influxAddr, influxDB, influxUser, influxPass)
+	// initialize observation subscriber
+	consumer, err := broker.NewSubscriber(ctx, brokerCfg, obsTopic, groupID)
 	if err != nil {
-		log.Fatalf("error initializing InfluxDB: %v", err)
+		log.Fatalf("error initializing subscriber: %v", err)
+	}
+
+	obsRepo, err := db.NewObservationStore(obsCfg, true)
+	if err != nil {
+		log.Fatalf("error initializing observation store: %v", err)
 	}
 
 	alertRepo, err := db.NewPostgresRepo(conn)
@@ -45,48 +55,45 @@ func main() {
 	}
 
 	// initialize publisher
-	publisher := kafka.NewKafkaPublisher(brokers, alertTopic)
+	publisher, err := broker.NewPublisher(ctx, brokerCfg, alertTopic)
+	if err != nil {
+		log.Fatalf("error initializing publisher: %v", err)
+	}
 
 	// initialize processing service
-	processingService := application.NewProcessService(publisher, alertRepo, obsRepo, mlClient)
-
-	// context configuration to handler signals
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
+	processor := app.NewProcessor(publisher, alertRepo, obsRepo, mlClient)
 
 	// initialize message consumption
+	consumerDone := make(chan struct{})
 	go func() {
-		consumer.Consume(ctx, func(ket, msg []byte) {
-			var obs entities.Observation
-			if err := json.Unmarshal(msg, &obs); err != nil {
-				log.Printf("invalid observation message: %v", err)
-				return
-			}
-
-			record, err := entities.ToObservationRecord(&obs)
-			if err != nil {
-				log.Printf("error converting to ObservationRecord: %v", err)
-				return
-			}
-
-			if err := processingService.HandleObservation(ctx, record); err != nil {
-				log.Printf("error processing observation %s: %v", obs.ID, err)
-			}
-		})
+		defer close(consumerDone)
+		err := processor.Run(ctx, consumer)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("consumer stopped: %v", err)
+		}
 	}()
 
 	// healthcheck
-	go func() {
-		r := gin.Default()
-		r.GET("/health", func(c *gin.Context) {
-			c.String(http.StatusOK, "OK")
-		})
-		r.Run(":9090")
-	}()
+	r := gin.Default()
+	r.GET("/health", func(c *gin.Context) {
+		c.String(http.StatusOK, "OK")
+	})
+	srv := &http.Server{Addr: ":9090", Handler: r}
+
+	if err := lifecycle.Serve(ctx, srv, shutdown); err != nil {
+		log.Printf("health server error: %v", err)
+		cancel()
+	}
 
 	// signal finisher
-	<-ctx.Done()
-	log.Printf("signal finisher received, waiting to finalize processes...")
-	time.Sleep(2 * time.Second)
+	log.Printf("signal finisher received, waiting up to %s to finalize processes...", shutdown.Remaining())
+	if !lifecycle.Wait(consumerDone, shutdown.Remaining()) {
+		log.Printf("shutdown deadline exceeded, in-flight observation may be redelivered")
+	}
+
+	lifecycle.Close("subscriber", consumer)
+	lifecycle.Close("publisher", publisher)
+	lifecycle.Close("observation store", obsRepo)
+	lifecycle.Close("Postgres pool", alertRepo)
 	log.Println("processing service stopped")
 }
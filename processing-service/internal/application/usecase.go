@@ -4,8 +4,6 @@ import (
 	"context"
 	"fmt"
 	"log"
-
-	"strings"
 	"time"
 
 	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
@@ -39,17 +37,20 @@ func NewProcessService(publisher repository.Publisher, alertRepo repository.Aler
 }
 
 func (svc *ProcessService) HandleObservation(ctx context.Context, obs *entities.ObservationRecord) error {
-	// 1. Check thresholds
-	alertTypes, triggered := rules.CheckThresholds(obs, svc.Thresholds)
-	if triggered {
-		alertTypeStr := strings.Join(alertTypes, ", ")
-
+	// 1. Check thresholds, one alert per rule
+	for _, v := range rules.CheckThresholds(obs, svc.Thresholds) {
 		alert := entities.Alert{
 			ID:            svc.generateID(),
 			PatientID:     obs.PatientID,
 			ObservationID: obs.ID,
-			Type:          alertTypeStr,
-			Message:       fmt.Sprintf("Alerts: %s at %s", alertTypeStr, obs.EffectiveDateTime),
+			Type:          v.Type,
+			Severity:      v.Severity,
+			Source:        entities.SourceRule,
+			RuleID:        v.RuleID,
+			Code:          v.Code,
+			Value:         v.Value,
+			Threshold:     v.Threshold,
+			Message:       fmt.Sprintf("Alerts: %s at %s", v.Type, obs.EffectiveDateTime),
 			Timestamp:     time.Now(),
 		}
 		if err := svc.publishAndSaveAlert(ctx, &alert); err != nil {
@@ -58,13 +59,29 @@ func (svc *ProcessService) HandleObservation(ctx context.Context, obs *entities.
 	}
 
 	// 2. Z-Score detection
-	zAnomaly := svc.ZDetector.Add(obs.Value)
-
-	var (
-		mlAnomaly bool
-		mlScore   float64
-	)
+	if zScore, zAnomaly := svc.ZDetector.Add(obs.Value); zAnomaly {
+		alert := entities.Alert{
+			ID:            svc.generateID(),
+			PatientID:     obs.PatientID,
+			ObservationID: obs.ID,
+			Type:          "Anomaly",
+			Severity:      entities.SeverityInfo,
+			Source:        entities.SourceZScore,
+			RuleID:        "zscore",
+			Code:          obs.CodeText,
+			Value:         obs.Value,
+			Threshold:     svc.ZDetector.Threshold,
+			Score:         zScore,
+			Message:       fmt.Sprintf("Anomaly detected by Z-Score: value=%.2f at %s", obs.Value, obs.EffectiveDateTime),
+			Timestamp:     time.Now(),
+		}
+		log.Printf("Anomaly alert for patient %s detected by Z-Score", obs.PatientID)
+		if err := svc.publishAndSaveAlert(ctx, &alert); err != nil {
+			return fmt.Errorf("failed to handle z-score alert: %v", err)
+		}
+	}
 
+	// 3. ML detection
 	if svc.MLClient != nil {
 		mlObs := mlclient.MLObservation{
 			ID:                obs.ID,
@@ -79,42 +96,28 @@ func (svc *ProcessService) HandleObservation(ctx context.Context, obs *entities.
 		if err != nil {
 			log.Printf("ML service error for obs %s: %v", obs.ID, err)
 		} else if resp.Prediction {
-			mlAnomaly = true
-			mlScore = resp.AnomalyScore
-		}
-	}
-
-	// 4. Alert if any anomaly is detected
-	if zAnomaly || mlAnomaly {
-		source := "Z-Score"
-		if zAnomaly && mlAnomaly {
-			source = "Z-Score and ML"
-		} else if mlAnomaly {
-			source = "ML"
-		}
-
-		message := fmt.Sprintf("Anomaly detected by %s: value=%.2f at %s", source, obs.Value, obs.EffectiveDateTime)
-		if mlAnomaly {
-			message += fmt.Sprintf(", ML anomaly score %.2f", mlScore)
-		}
-
-		alert := entities.Alert{
-			ID:            svc.generateID(),
-			PatientID:     obs.PatientID,
-			ObservationID: obs.ID,
-			Type:          "Anomaly",
-			Message:       message,
-			Timestamp:     time.Now(),
-		}
-
-		log.Printf("Anomaly alert for patient %s detected by %s", obs.PatientID, source)
-
-		if err := svc.publishAndSaveAlert(ctx, &alert); err != nil {
-			return fmt.Errorf("failed to handle anomaly alert: %v", err)
+			alert := entities.Alert{
+				ID:            svc.generateID(),
+				PatientID:     obs.PatientID,
+				ObservationID: obs.ID,
+				Type:          "Anomaly",
+				Severity:      entities.SeverityWarning,
+				Source:        entities.SourceML,
+				RuleID:        "ml-anomaly",
+				Code:          obs.CodeText,
+				Value:         obs.Value,
+				Score:         resp.AnomalyScore,
+				Message:       fmt.Sprintf("Anomaly detected by ML: value=%.2f at %s, ML anomaly score %.2f", obs.Value, obs.EffectiveDateTime, resp.AnomalyScore),
+				Timestamp:     time.Now(),
+			}
+			log.Printf("Anomaly alert for patient %s detected by ML", obs.PatientID)
+			if err := svc.publishAndSaveAlert(ctx, &alert); err != nil {
+				return fmt.Errorf("failed to handle ML alert: %v", err)
+			}
 		}
 	}
 
-	// 5. Save metrics
+	// 4. Save metrics
 	if err := svc.MetricsRepo.Save(ctx, obs); err != nil {
 		return fmt.Errorf("failed to store metrics for patient %s: %v", obs.PatientID, err)
 	}
@@ -122,15 +125,16 @@ func (svc *ProcessService) HandleObservation(ctx context.Context, obs *entities.
 	return nil
 }
 
+// publishAndSaveAlert stores the alert first so it carries its Seq when
+// published; an alert that fails to publish can still be replayed
 func (svc *ProcessService) publishAndSaveAlert(ctx context.Context, alert *entities.Alert) error {
-	log.Printf("Publishing alert type %s for patient %s", alert.Type, alert.PatientID)
-	if err := svc.AlertPublisher.PublishAlert(ctx, alert); err != nil {
-		return fmt.Errorf("failed to publish alert: %v", err)
-	}
-	log.Printf("Alert published, saving in Postgres...")
+	log.Printf("Saving alert type %s for patient %s in Postgres...", alert.Type, alert.PatientID)
 	if err := svc.AlertRepo.Save(ctx, alert); err != nil {
 		return fmt.Errorf("failed to save alert: %v", err)
 	}
-	log.Printf("Alert published in postgres with id %s", alert.ID)
+	log.Printf("Alert saved with id %s and seq %d, publishing...", alert.ID, alert.Seq)
+	if err := svc.AlertPublisher.PublishAlert(ctx, alert); err != nil {
+		return fmt.Errorf("failed to publish alert: %v", err)
+	}
 	return nil
 }
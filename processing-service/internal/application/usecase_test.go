@@ -0,0 +1,68 @@
+package application_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/domain/entities"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/mlclient"
+	rpmtesting "github.com/lioarce01/remote-patient-monitoring-system/pkg/common/testing"
+	"github.com/lioarce01/remote-patient-monitoring-system/processing-service/internal/application"
+)
+
+func TestHandleObservationRaisesOneAlertPerDetector(t *testing.T) {
+	ml := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var obs mlclient.MLObservation
+		json.NewDecoder(r.Body).Decode(&obs)
+		json.NewEncoder(w).Encode(mlclient.MLAnomalyResult{Prediction: obs.HeartRate > 90, AnomalyScore: 0.8})
+	}))
+	defer ml.Close()
+
+	ctx := context.Background()
+	alerts := rpmtesting.NewAlertRepo()
+	svc := application.NewProcessService(rpmtesting.NewBus().Publisher("alerts"), alerts, rpmtesting.NewObservationRepo(), mlclient.NewClient(ml.URL))
+
+	// a steady baseline, then a spike both detectors flag
+	values := make([]float64, 0, 21)
+	for i := 0; i < 20; i++ {
+		values = append(values, float64(70+i%4))
+	}
+	values = append(values, 95)
+
+	start := time.Date(2025, 5, 19, 22, 0, 0, 0, time.UTC)
+	for i, value := range values {
+		obs := &entities.ObservationRecord{
+			ID:                fmt.Sprintf("obs-%d", i),
+			PatientID:         "patient-1",
+			CodeText:          "heart-rate",
+			Value:             value,
+			EffectiveDateTime: start.Add(time.Duration(i) * time.Minute),
+		}
+		if err := svc.HandleObservation(ctx, obs); err != nil {
+			t.Fatalf("HandleObservation(%v): %v", value, err)
+		}
+	}
+
+	got, err := alerts.FetchByPatient(ctx, "patient-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bySource := make(map[string]entities.Alert)
+	for _, a := range got {
+		bySource[a.Source] = a
+	}
+	if len(got) != 2 || len(bySource) != 2 {
+		t.Fatalf("got %d alerts from %d detectors, want one z-score and one ML alert: %+v", len(got), len(bySource), got)
+	}
+	if z := bySource[entities.SourceZScore]; z.RuleID != "zscore" || z.Severity != entities.SeverityInfo || z.Threshold != 3.0 || z.Score <= 3.0 {
+		t.Errorf("z-score alert = %+v", z)
+	}
+	if m := bySource[entities.SourceML]; m.RuleID != "ml-anomaly" || m.Severity != entities.SeverityWarning || m.Threshold != 0 || m.Score != 0.8 {
+		t.Errorf("ML alert = %+v", m)
+	}
+}
@@ -22,8 +22,8 @@ func NewZScoreDetector(windowSize int, threshold float64, minStdDev float64) *ZS
 	}
 }
 
-// add a new data point and returns true if its an anomaly
-func (z *ZScoreDetector) Add(value float64) bool {
+// add a new data point and returns its z-score and true if its an anomaly
+func (z *ZScoreDetector) Add(value float64) (float64, bool) {
 	z.mu.Lock()
 	defer z.mu.Unlock()
 	z.window = append(z.window, value)
@@ -41,7 +41,7 @@ func (z *ZScoreDetector) Add(value float64) bool {
 	n := float64(len(z.window))
 
 	if n < 2 {
-		return false // not enough data
+		return 0, false // not enough data
 	}
 	mean := sum / n
 	variance := (sqSum / n) - (mean * mean)
@@ -51,5 +51,5 @@ func (z *ZScoreDetector) Add(value float64) bool {
 	}
 
 	zScore := math.Abs(value-mean) / stdev
-	return zScore > z.Threshold
+	return zScore, zScore > z.Threshold
 }
@@ -9,22 +9,41 @@ type Thresholds struct {
 	// add more thresholds if needed
 }
 
-// CheckThresholds check an observation and send an alert
-func CheckThresholds(obs *entities.ObservationRecord, th *Thresholds) (alertTypes []string, triggered bool) {
+// Violation is a threshold rule fired by an observation
+type Violation struct {
+	RuleID    string
+	Type      string
+	Severity  string
+	Code      string
+	Value     float64
+	Threshold float64
+}
+
+// CheckThresholds returns one violation per rule the observation breaks
+func CheckThresholds(obs *entities.ObservationRecord, th *Thresholds) []Violation {
+	var violations []Violation
+	fired := func(ruleID, alertType, severity string, threshold float64) {
+		violations = append(violations, Violation{
+			RuleID:    ruleID,
+			Type:      alertType,
+			Severity:  severity,
+			Code:      obs.CodeText,
+			Value:     obs.Value,
+			Threshold: threshold,
+		})
+	}
+
 	switch obs.CodeText {
 	case "heart-rate":
 		if obs.Value > th.HeartRateMax {
-			alertTypes = append(alertTypes, "HighHeartRate")
+			fired("heart-rate-max", "HighHeartRate", entities.SeverityWarning, th.HeartRateMax)
 		}
 	case "spo2":
 		if obs.Value < th.SpO2Min {
-			alertTypes = append(alertTypes, "LowSpO2")
+			fired("spo2-min", "LowSpO2", entities.SeverityCritical, th.SpO2Min)
 		}
 		// add more metrics
 	}
 
-	if len(alertTypes) > 0 {
-		return alertTypes, true
-	}
-	return nil, false
+	return violations
 }
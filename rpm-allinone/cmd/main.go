@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	apiapp "github.com/lioarce01/remote-patient-monitoring-system/api-service/app"
+	ingestapp "github.com/lioarce01/remote-patient-monitoring-system/ingest-service/app"
+	notificationapp "github.com/lioarce01/remote-patient-monitoring-system/notification-service/app"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/auth"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/bus"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/db/sqlite"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/lifecycle"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/mlclient"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/notify"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/webhook"
+	"github.com/lioarce01/remote-patient-monitoring-system/pkg/common/infrastructure/ws"
+	processingapp "github.com/lioarce01/remote-patient-monitoring-system/processing-service/app"
+)
+
+const (
+	obsTopic   = "observations"
+	alertTopic = "alerts"
+)
+
+func main() {
+	apiPort := getenv("API_PORT", "8080")
+	ingestPort := getenv("INGEST_PORT", "8081")
+	dataDir := getenv("DATA_DIR", "data")
+	mlURL := os.Getenv("ML_URL")
+	notifyConfig := os.Getenv("NOTIFY_CONFIG")
+	shutdown := lifecycle.NewDeadline(lifecycle.ShutdownTimeout())
+
+	if err := os.MkdirAll(dataDir, 0o750); err != nil {
+		log.Fatalf("cannot create data dir %s: %v", dataDir, err)
+	}
+
+	// embedded store for alerts, patients and observations
+	store, err := sqlite.Open(filepath.Join(dataDir, "rpm.db"))
+	if err != nil {
+		log.Fatalf("cannot open embedded store: %v", err)
+	}
+	alertRepo := sqlite.NewAlertRepo(store)
+	obsRepo := sqlite.NewObservationRepo(store)
+	patientRepo := sqlite.NewPatientRepo(store)
+	auditLog := sqlite.NewAuditLog(store)
+
+	// authentication is off unless AUTH_MODE says otherwise
+	authCfg := auth.ConfigFromEnv()
+	if os.Getenv("AUTH_MODE") == "" {
+		authCfg.Mode = auth.ModeOff
+	}
+	verifier, err := auth.NewVerifier(context.Background(), authCfg)
+	if err != nil {
+		log.Fatalf("cannot initialize authentication: %v", err)
+	}
+
+	// devices are not authenticated unless a registry is configured
+	deviceCfg := auth.DeviceConfigFromEnv()
+	if os.Getenv("DEVICE_AUTH") == "" && deviceCfg.Registry == "" {
+		deviceCfg.Mode = auth.DeviceAuthOff
+	}
+	deviceCfg.Nonces = sqlite.NewNonceRepo(store)
+	devices, err := auth.NewDeviceAuthenticator(deviceCfg)
+	if err != nil {
+		log.Fatalf("cannot initialize device authentication: %v", err)
+	}
+
+	// the ML service is optional here; without it only thresholds and Z-Score run
+	var mlClient *mlclient.Client
+	if mlURL != "" {
+		mlClient = mlclient.NewClient(mlURL)
+	}
+
+	// notifications are only sent when a routing file is configured;
+	// without one the notifier only publishes alerts to webhooks
+	var notifyCfg notificationapp.Config
+	var channels map[string]notify.Channel
+	if notifyConfig != "" {
+		if notifyCfg, err = notificationapp.LoadConfig(notifyConfig); err != nil {
+			log.Fatalf("cannot load notification config: %v", err)
+		}
+		if channels, err = notify.ChannelsFromEnv(); err != nil {
+			log.Fatalf("cannot initialize notification channels: %v", err)
+		}
+	}
+	webhookRepo := sqlite.NewWebhookRepo(store)
+	notifier, err := notificationapp.NewNotifier(notificationapp.Stores{
+		Deliveries:  sqlite.NewNotificationRepo(store),
+		Escalations: sqlite.NewEscalationRepo(store),
+		Alerts:      alertRepo,
+		Patients:    patientRepo,
+		CareTeams:   patientRepo,
+		Webhooks:    webhookRepo,
+	}, channels, notifyCfg)
+	if err != nil {
+		log.Fatalf("cannot initialize notifier: %v", err)
+	}
+	sender := webhook.NewSender(webhookRepo, webhook.ConfigFromEnv())
+
+	// in-process event bus replaces Kafka; subscribe before serving traffic
+	eventBus := bus.New()
+	obsSubscriber := eventBus.Subscriber(obsTopic, "processing")
+	alertSubscriber := eventBus.Subscriber(alertTopic, "api")
+	vitalsSubscriber := eventBus.Subscriber(obsTopic, "api-vitals")
+	notifySubscriber := eventBus.Subscriber(alertTopic, "notifications")
+
+	processor := processingapp.NewProcessor(eventBus.Publisher(alertTopic), alertRepo, obsRepo, mlClient)
+	api := apiapp.New(obsRepo, alertRepo, apiapp.Security{
+		Verifier:       verifier,
+		CareTeams:      patientRepo,
+		AllowedOrigins: authCfg.AllowedOrigins,
+		Audit:          auditLog,
+		Patients:       patientRepo,
+		Webhooks:       webhookRepo,
+	}, ws.WithConfig(ws.ConfigFromEnv()))
+	ingestRouter := ingestapp.NewRouter(eventBus.Publisher(obsTopic), obsRepo, devices, auditLog)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	consumersDone := make(chan struct{})
+	var consumers sync.WaitGroup
+	consumers.Add(5)
+	go func() {
+		defer consumers.Done()
+		processor.Run(ctx, obsSubscriber)
+	}()
+	go func() {
+		defer consumers.Done()
+		api.RelayAlerts(ctx, alertSubscriber)
+	}()
+	go func() {
+		defer consumers.Done()
+		api.RelayObservations(ctx, vitalsSubscriber)
+	}()
+	go func() {
+		defer consumers.Done()
+		if err := notifier.Run(ctx, notifySubscriber); err != nil && ctx.Err() == nil {
+			log.Printf("notifier stopped: %v", err)
+		}
+	}()
+	go func() {
+		defer consumers.Done()
+		sender.Run(ctx)
+	}()
+	go func() {
+		consumers.Wait()
+		close(consumersDone)
+	}()
+
+	apiSrv := &http.Server{Addr: ":" + apiPort, Handler: api.Router}
+	apiSrv.RegisterOnShutdown(func() { api.Close() })
+	ingestSrv := &http.Server{Addr: ":" + ingestPort, Handler: ingestRouter}
+
+	var servers sync.WaitGroup
+	for name, srv := range map[string]*http.Server{"API": apiSrv, "ingest": ingestSrv} {
+		servers.Add(1)
+		go func() {
+			defer servers.Done()
+			log.Printf("%s listening on %s", name, srv.Addr)
+			if err := lifecycle.Serve(ctx, srv, shutdown); err != nil {
+				log.Printf("%s server error: %v", name, err)
+				cancel()
+			}
+		}()
+	}
+
+	servers.Wait()
+	if !lifecycle.Wait(consumersDone, shutdown.Remaining()) {
+		log.Printf("shutdown deadline exceeded while draining the event bus")
+	}
+
+	if err := sqlite.Close(store); err != nil {
+		log.Printf("error closing embedded store: %v", err)
+	}
+	log.Println("rpm-allinone stopped")
+}
+
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}